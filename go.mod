@@ -12,6 +12,7 @@ require (
 	github.com/lithammer/fuzzysearch v1.1.3
 	github.com/mvisonneau/go-helpers v0.0.1
 	github.com/openlyinc/pointy v1.1.2
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/slack-go/slack v0.10.1
 	github.com/stretchr/testify v1.7.0
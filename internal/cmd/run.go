@@ -45,6 +45,10 @@ func getHTTPServer(listenAddress string, c controller.Controller) *http.Server {
 	router.HandleFunc("/slack/slash", c.SlashHandler)
 	router.HandleFunc("/slack/modal", c.ModalHandler)
 	router.HandleFunc("/slack/select", c.SelectHandler)
+	router.HandleFunc("/slack/events", c.EventsHandler)
+
+	// api endpoints, disabled unless a token is configured
+	router.HandleFunc("/api/audit", c.AuditAPIHandler).Methods(http.MethodGet)
 
 	return &http.Server{
 		Addr:    listenAddress,
@@ -55,7 +59,13 @@ func getHTTPServer(listenAddress string, c controller.Controller) *http.Server {
 // Run launches the exporter
 func Run(cliContext *cli.Context) (int, error) {
 	cfg := configure(cliContext)
-	c, err := controller.New(context.Background(), cfg)
+
+	// Cancelling the context stops the scheduling of the tasks and aborts the
+	// calls they are making to the providers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := controller.New(ctx, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -88,6 +98,11 @@ func Run(cliContext *cli.Context) (int, error) {
 		log.WithError(err).Fatalf("metrics server shutdown failed")
 	}
 
+	cancel()
+	if err := c.TaskController.Queue.CloseTimeout(5 * time.Second); err != nil {
+		log.WithError(err).Warning("stopping the tasks")
+	}
+
 	log.Info("stopped!")
 	return 0, nil
 }
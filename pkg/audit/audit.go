@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sources of the comparisons
+const (
+	SourceSlashCommand  = "slash_command"
+	SourceModal         = "modal"
+	SourceHomeTab       = "home_tab"
+	SourceMessageAction = "message_action"
+	SourceWatch         = "watch"
+
+	// SourceMessageRefresh records the refreshes of the posted comparisons, by
+	// whoever clicked the button, as opposed to their initial requester
+	SourceMessageRefresh = "message_refresh"
+)
+
+// Record holds the details of a comparison requested by a user, or posted by a watch
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+
+	// Source is where the comparison got requested from (eg: slash_command)
+	Source      string `json:"source"`
+	SlackUserID string `json:"slack_user_id,omitempty"`
+	ChannelID   string `json:"channel_id"`
+
+	Provider   string `json:"provider"`
+	Repository string `json:"repository"`
+	FromRef    string `json:"from_ref"`
+	FromSHA    string `json:"from_sha,omitempty"`
+	ToRef      string `json:"to_ref"`
+	ToSHA      string `json:"to_sha,omitempty"`
+
+	CommitCount uint   `json:"commit_count"`
+	WebURL      string `json:"web_url"`
+
+	// Posted is whether the comparison got posted onto the channel, as opposed
+	// to being displayed in the modal or as an ephemeral preview
+	Posted bool `json:"posted"`
+}
+
+// Records is a slice of Record, oldest first
+type Records []Record
+
+// Query filters the Records, empty fields match any value
+type Query struct {
+	Repository  string
+	SlackUserID string
+	ChannelID   string
+	Since       time.Time
+	Until       time.Time
+
+	// Limit is the maximum amount of Records to return, 0 meaning no limit
+	Limit int
+}
+
+// Logger writes the Records onto the configured Sinks
+type Logger struct {
+	Sinks []Sink
+
+	// Reader is the first of the Sinks the Records can be queried from
+	Reader Reader
+}
+
+// NewRecord returns the Record of a comparison
+func NewRecord(source, slackUserID, channelID string, repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, posted bool) Record {
+	return Record{
+		Timestamp:   time.Now(),
+		Source:      source,
+		SlackUserID: slackUserID,
+		ChannelID:   channelID,
+		Provider:    repo.ProviderType.String(),
+		Repository:  repo.Name,
+		FromRef:     fromRef.Name,
+		FromSHA:     cmp.FromStatus.SHA,
+		ToRef:       toRef.Name,
+		ToSHA:       cmp.ToStatus.SHA,
+		CommitCount: cmp.CommitCount(),
+		WebURL:      cmp.WebURL,
+		Posted:      posted,
+	}
+}
+
+// Matches returns whether the Record matches the Query
+func (q Query) Matches(r Record) bool {
+	return (q.Repository == "" || q.Repository == r.Repository) &&
+		(q.SlackUserID == "" || q.SlackUserID == r.SlackUserID) &&
+		(q.ChannelID == "" || q.ChannelID == r.ChannelID) &&
+		(q.Since.IsZero() || !r.Timestamp.Before(q.Since)) &&
+		(q.Until.IsZero() || r.Timestamp.Before(q.Until))
+}
+
+// Filter returns the Records matching the Query, most recent first
+func (rs Records) Filter(q Query) (filtered Records) {
+	for i := len(rs) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(filtered) >= q.Limit {
+			break
+		}
+
+		if q.Matches(rs[i]) {
+			filtered = append(filtered, rs[i])
+		}
+	}
+	return
+}
+
+// NewLogger returns a Logger writing onto the configured sinks. The Records are
+// kept in the store when no sinks are configured
+func NewLogger(cfg config.Audit, s RecordsStore) (l *Logger, err error) {
+	l = &Logger{}
+
+	sinks := cfg.Sinks
+	if len(sinks) == 0 {
+		sinks = config.AuditSinks{{Type: "store"}}
+	}
+
+	for _, sc := range sinks {
+		var sink Sink
+		switch sc.Type {
+		case "file":
+			if sink, err = NewFileSink(sc.Path, cfg.FileReadMaxRecords); err != nil {
+				return nil, err
+			}
+		case "stdout":
+			sink = NewStreamSink(os.Stdout)
+		case "store":
+			sink = StoreSink{Store: s, MaxRecords: cfg.StoreMaxRecords}
+		default:
+			return nil, fmt.Errorf("invalid audit sink type '%s'", sc.Type)
+		}
+
+		l.Sinks = append(l.Sinks, sink)
+		if r, ok := sink.(Reader); ok && l.Reader == nil {
+			l.Reader = r
+		}
+	}
+
+	return
+}
+
+// Log writes the Record onto all the Sinks, failing to write onto one of them
+// does not prevent the others from getting it
+func (l *Logger) Log(r Record) {
+	for _, s := range l.Sinks {
+		if err := s.Write(r); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"repository":    r.Repository,
+				"slack_user_id": r.SlackUserID,
+			}).Error("writing audit record")
+		}
+	}
+}
+
+// Read returns the Records matching the Query, most recent first
+func (l *Logger) Read(q Query) (Records, error) {
+	if l.Reader == nil {
+		return nil, fmt.Errorf("none of the configured audit sinks can be queried")
+	}
+	return l.Reader.Read(q)
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRecordsStore struct {
+	records Records
+}
+
+func (s *testRecordsStore) AddAuditRecord(r Record, _ int) {
+	s.records = append(s.records, r)
+}
+
+func (s *testRecordsStore) GetAuditRecords() Records {
+	return s.records
+}
+
+func TestNewRecord(t *testing.T) {
+	r := NewRecord(
+		"modal",
+		"U1",
+		"C1",
+		providers.Repository{ProviderType: providers.ProviderTypeGitLab, Name: "foo/bar"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Ref{Name: "main"},
+		providers.Comparison{
+			Commits:    providers.Commits{{ID: "a"}, {ID: "b"}},
+			FromStatus: providers.CommitStatus{SHA: "abc"},
+			ToStatus:   providers.CommitStatus{SHA: "def"},
+			WebURL:     "https://gitlab.com/foo/bar/-/compare/v1.0.0...main",
+		},
+		true,
+	)
+
+	assert.False(t, r.Timestamp.IsZero())
+	r.Timestamp = time.Time{}
+	assert.Equal(t, Record{
+		Source:      "modal",
+		SlackUserID: "U1",
+		ChannelID:   "C1",
+		Provider:    "gitlab",
+		Repository:  "foo/bar",
+		FromRef:     "v1.0.0",
+		FromSHA:     "abc",
+		ToRef:       "main",
+		ToSHA:       "def",
+		CommitCount: 2,
+		WebURL:      "https://gitlab.com/foo/bar/-/compare/v1.0.0...main",
+		Posted:      true,
+	}, r)
+}
+
+func TestRecordsFilter(t *testing.T) {
+	now := time.Now()
+	rs := Records{
+		{Timestamp: now.Add(-3 * time.Hour), Repository: "foo/a", SlackUserID: "U1", ChannelID: "C1"},
+		{Timestamp: now.Add(-2 * time.Hour), Repository: "foo/b", SlackUserID: "U2", ChannelID: "C1"},
+		{Timestamp: now.Add(-1 * time.Hour), Repository: "foo/a", SlackUserID: "U2", ChannelID: "C2"},
+	}
+
+	// Most recent first
+	assert.Equal(t, Records{rs[2], rs[1], rs[0]}, rs.Filter(Query{}))
+	assert.Equal(t, Records{rs[2]}, rs.Filter(Query{Limit: 1}))
+	assert.Equal(t, Records{rs[2], rs[0]}, rs.Filter(Query{Repository: "foo/a"}))
+	assert.Equal(t, Records{rs[2], rs[1]}, rs.Filter(Query{SlackUserID: "U2"}))
+	assert.Equal(t, Records{rs[1], rs[0]}, rs.Filter(Query{ChannelID: "C1"}))
+	assert.Equal(t, Records{rs[1]}, rs.Filter(Query{Since: now.Add(-2 * time.Hour), Until: now.Add(-1 * time.Hour)}))
+	assert.Empty(t, rs.Filter(Query{Repository: "foo/c"}))
+}
+
+func TestNewLogger(t *testing.T) {
+	s := &testRecordsStore{}
+
+	// Records are kept in the store by default
+	l, err := NewLogger(config.Audit{StoreMaxRecords: 10}, s)
+	assert.NoError(t, err)
+	assert.Len(t, l.Sinks, 1)
+
+	l.Log(Record{Repository: "foo/bar"})
+	rs, err := l.Read(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, Records{{Repository: "foo/bar"}}, rs)
+
+	// Streams cannot be queried
+	l, err = NewLogger(config.Audit{Sinks: config.AuditSinks{{Type: "stdout"}}}, s)
+	assert.NoError(t, err)
+	_, err = l.Read(Query{})
+	assert.Error(t, err)
+
+	// Invalid file
+	_, err = NewLogger(config.Audit{Sinks: config.AuditSinks{{Type: "file", Path: "/nonexistent/audit.log"}}}, s)
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink is where the Records get written to
+type Sink interface {
+	Write(Record) error
+}
+
+// Reader is implemented by the Sinks the Records can be queried from
+type Reader interface {
+	Read(Query) (Records, error)
+}
+
+// RecordsStore keeps the Records in memory
+type RecordsStore interface {
+	AddAuditRecord(r Record, limit int)
+	GetAuditRecords() Records
+}
+
+// FileSink appends the Records as JSON lines onto a file
+type FileSink struct {
+	// Path of the file, it gets opened in append mode on each write in order
+	// to play nicely with log rotation tools
+	Path string
+
+	// ReadMaxRecords is the amount of the latest Records which can be queried,
+	// the file getting read from its end. 0 means all of them
+	ReadMaxRecords int
+
+	mutex *sync.Mutex
+}
+
+// StreamSink writes the Records as JSON lines onto a stream (eg: stdout)
+type StreamSink struct {
+	Writer io.Writer
+
+	mutex *sync.Mutex
+}
+
+// StoreSink keeps the latest Records in the store
+type StoreSink struct {
+	Store RecordsStore
+
+	// MaxRecords is the amount of Records we keep, the oldest ones being evicted first
+	MaxRecords int
+}
+
+// NewFileSink returns a FileSink, ensuring the file can be written to
+func NewFileSink(path string, readMaxRecords int) (s FileSink, err error) {
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640); err != nil {
+		return s, fmt.Errorf("opening audit file: %v", err)
+	}
+
+	return FileSink{Path: path, ReadMaxRecords: readMaxRecords, mutex: &sync.Mutex{}}, f.Close()
+}
+
+// NewStreamSink returns a StreamSink writing onto w
+func NewStreamSink(w io.Writer) StreamSink {
+	return StreamSink{Writer: w, mutex: &sync.Mutex{}}
+}
+
+// Write implements the Sink interface
+func (s FileSink) Write(r Record) (err error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var f *os.File
+	if f, err = os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640); err != nil {
+		return
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return
+	}
+
+	return f.Close()
+}
+
+// Read implements the Reader interface, only the ReadMaxRecords latest Records
+// of the current file can be queried. The file gets read from its end, until
+// enough Records matched the Query
+func (s FileSink) Read(q Query) (rs Records, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	read := 0
+	var parseErr error
+	err = readLinesBackwards(f, info.Size(), func(line []byte) bool {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return true
+		}
+
+		if s.ReadMaxRecords > 0 && read >= s.ReadMaxRecords {
+			return false
+		}
+		read++
+
+		var r Record
+		if parseErr = json.Unmarshal(line, &r); parseErr != nil {
+			return false
+		}
+
+		if q.Matches(r) {
+			rs = append(rs, r)
+		}
+		return q.Limit == 0 || len(rs) < q.Limit
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if parseErr != nil {
+		return nil, fmt.Errorf("parsing audit file: %v", parseErr)
+	}
+
+	return rs, nil
+}
+
+// fileReadChunkSize is the amount of bytes read at once when reading a file
+// from its end
+const fileReadChunkSize = 64 * 1024
+
+// readLinesBackwards calls fn for each line of r, last one first, until it
+// returns false
+func readLinesBackwards(r io.ReaderAt, size int64, fn func(line []byte) bool) error {
+	// The beginning of the line which spans over the previously read chunk
+	var partial []byte
+	for offset := size; offset > 0; {
+		n := int64(fileReadChunkSize)
+		if n > offset {
+			n = offset
+		}
+		offset -= n
+
+		chunk := make([]byte, n, n+int64(len(partial)))
+		if _, err := r.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return err
+		}
+		chunk = append(chunk, partial...)
+
+		for i := bytes.LastIndexByte(chunk, '\n'); i >= 0; i = bytes.LastIndexByte(chunk, '\n') {
+			if !fn(chunk[i+1:]) {
+				return nil
+			}
+			chunk = chunk[:i]
+		}
+		partial = chunk
+	}
+
+	if len(partial) > 0 {
+		fn(partial)
+	}
+	return nil
+}
+
+// Write implements the Sink interface
+func (s StreamSink) Write(r Record) (err error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err = s.Writer.Write(append(b, '\n'))
+	return
+}
+
+// Write implements the Sink interface
+func (s StoreSink) Write(r Record) error {
+	s.Store.AddAuditRecord(r, s.MaxRecords)
+	return nil
+}
+
+// Read implements the Reader interface
+func (s StoreSink) Read(q Query) (Records, error) {
+	return s.Store.GetAuditRecords().Filter(q), nil
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	s, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0)
+	assert.NoError(t, err)
+
+	rs, err := s.Read(Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, rs)
+
+	assert.NoError(t, s.Write(Record{Repository: "foo/a"}))
+	assert.NoError(t, s.Write(Record{Repository: "foo/b"}))
+
+	rs, err = s.Read(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, Records{{Repository: "foo/b"}, {Repository: "foo/a"}}, rs)
+}
+
+func TestFileSinkReadFromTheEnd(t *testing.T) {
+	s, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0)
+	assert.NoError(t, err)
+
+	// Spanning over several chunks
+	long := strings.Repeat("x", fileReadChunkSize/3)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.Write(Record{Repository: fmt.Sprintf("foo/%d", i), WebURL: long}))
+	}
+
+	rs, err := s.Read(Query{})
+	assert.NoError(t, err)
+	assert.Len(t, rs, 10)
+	for i, r := range rs {
+		assert.Equal(t, fmt.Sprintf("foo/%d", 9-i), r.Repository)
+		assert.Equal(t, long, r.WebURL)
+	}
+
+	rs, err = s.Read(Query{Repository: "foo/3", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "foo/3", rs[0].Repository)
+
+	// Only the latest records can be queried
+	s.ReadMaxRecords = 4
+	rs, err = s.Read(Query{})
+	assert.NoError(t, err)
+	assert.Len(t, rs, 4)
+	assert.Equal(t, "foo/6", rs[3].Repository)
+
+	rs, err = s.Read(Query{Repository: "foo/3"})
+	assert.NoError(t, err)
+	assert.Empty(t, rs)
+}
+
+func TestReadLinesBackwards(t *testing.T) {
+	var lines []string
+	content := "a\nbb\n\nccc"
+	assert.NoError(t, readLinesBackwards(strings.NewReader(content), int64(len(content)), func(line []byte) bool {
+		lines = append(lines, string(line))
+		return len(lines) < 3
+	}))
+	assert.Equal(t, []string{"ccc", "", "bb"}, lines)
+}
+
+func TestStreamSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStreamSink(&buf)
+
+	assert.NoError(t, s.Write(Record{Repository: "foo/a", Posted: true}))
+	assert.Contains(t, buf.String(), `"repository":"foo/a"`)
+	assert.Contains(t, buf.String(), `"posted":true`)
+	assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+}
@@ -7,10 +7,51 @@ import (
 
 var validate *validator.Validate
 
+// API holds the configuration of the HTTP API
+type API struct {
+	// Token is expected as a bearer token by the endpoints of the API, which are
+	// disabled when it is left empty
+	Token string
+}
+
+// Audit holds the configuration of the audit log of the comparisons
+type Audit struct {
+	// Sinks the records get written to, they are kept in the store when none
+	// are configured
+	Sinks AuditSinks `validate:"dive"`
+
+	// StoreMaxRecords is the amount of records kept by the "store" sink
+	StoreMaxRecords int `default:"10000" validate:"gt=0" json:"store_max_records" yaml:"store_max_records"`
+
+	// FileReadMaxRecords is the amount of the latest records of the "file" sink
+	// which can be queried, 0 meaning all of them
+	FileReadMaxRecords int `default:"10000" validate:"gte=0" json:"file_read_max_records" yaml:"file_read_max_records"`
+}
+
+// AuditSink holds the configuration of a destination of the audit records
+type AuditSink struct {
+	// Type can be "file" (JSON lines appended to Path), "stdout" (JSON lines) or
+	// "store" (in memory). The records can be queried from "file" and "store" sinks
+	Type string `validate:"oneof=file stdout store"`
+	Path string `validate:"required_if=Type file"`
+}
+
+// AuditSinks is a slice of AuditSink
+type AuditSinks []AuditSink
+
 // Cache holds the configuration regarding the scheduling of cache updates
 type Cache struct {
-	Providers CacheProviders
-	Slack     CacheSlack
+	Comparisons CacheComparisons
+	Providers   CacheProviders
+	Slack       CacheSlack
+}
+
+// CacheComparisons bounds the cache of the comparisons, which are identified by
+// the commits they are made of and therefore never get stale. Setting any of the
+// limits to 0 disables it
+type CacheComparisons struct {
+	MaxEntries int `default:"1000" validate:"gte=0" json:"max_entries" yaml:"max_entries"`
+	MaxSizeMB  int `default:"64" validate:"gte=0" json:"max_size_mb" yaml:"max_size_mb"`
 }
 
 // CacheProviders ..
@@ -21,7 +62,8 @@ type CacheProviders struct {
 
 // CacheSlack ..
 type CacheSlack struct {
-	UpdateUsersEmails CacheSlackUpdateUsersEmails `json:"update_users_emails" yaml:"update_users_emails"`
+	UpdateUsersEmails  CacheSlackUpdateUsersEmails  `json:"update_users_emails" yaml:"update_users_emails"`
+	LookupUsersByEmail CacheSlackLookupUsersByEmail `json:"lookup_users_by_email" yaml:"lookup_users_by_email"`
 }
 
 // CacheProvidersUpdateRepositories ..
@@ -34,6 +76,14 @@ type CacheProvidersUpdateRepositories struct {
 type CacheProvidersUpdateRepositoriesRefs struct {
 	OnStart      bool `default:"false" json:"on_start" yaml:"on_start"`
 	EverySeconds int  `json:"every_seconds" yaml:"on_schedule"`
+
+	// Concurrency is the amount of repositories whose refs get updated at once
+	Concurrency int `default:"4" validate:"gt=0" json:"concurrency" yaml:"concurrency"`
+
+	// StateFile is where the progress of the runs and the failures of the
+	// repositories get persisted, for an interrupted run to be resumed on startup.
+	// They are only held in memory when empty
+	StateFile string `json:"state_file" yaml:"state_file"`
 }
 
 // CacheSlackUpdateUsersEmails ..
@@ -42,6 +92,27 @@ type CacheSlackUpdateUsersEmails struct {
 	EverySeconds int  `default:"86400" json:"every_seconds" yaml:"on_schedule"`
 }
 
+// CacheSlackLookupUsersByEmail configures the lookup of the Slack users whose email
+// addresses could not be found in the cached mapping
+type CacheSlackLookupUsersByEmail struct {
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// Users which could be found are kept for PositiveTTLSeconds, the email
+	// addresses which could not be resolved for NegativeTTLSeconds
+	PositiveTTLSeconds int `default:"86400" json:"positive_ttl_seconds" yaml:"positive_ttl_seconds"`
+	NegativeTTLSeconds int `default:"3600" json:"negative_ttl_seconds" yaml:"negative_ttl_seconds"`
+
+	// ProviderProfiles also looks up the email addresses of the provider account
+	// behind the commits (eg: when authored with noreply addresses)
+	ProviderProfiles bool `default:"true" json:"provider_profiles" yaml:"provider_profiles"`
+
+	// MaxEntries bounds the amount of lookups kept, the oldest ones getting evicted first
+	MaxEntries int `default:"10000" validate:"gt=0" json:"max_entries" yaml:"max_entries"`
+
+	// Concurrency is the amount of commit authors looked up at once
+	Concurrency int `default:"4" validate:"gt=0" json:"concurrency" yaml:"concurrency"`
+}
+
 // Provider holds the configuration of a git provider
 type Provider struct {
 	Type   string `validate:"oneof=github gitlab"`
@@ -53,16 +124,109 @@ type Provider struct {
 // Providers is a slice of Provider
 type Providers []Provider
 
+// Channel holds the configuration of a Slack channel
+type Channel struct {
+	ID string `validate:"required"`
+
+	// Repositories bound to the channel, they get preselected or searched
+	// first when the command is invoked from it
+	Repositories []string `validate:"gt=0"`
+
+	// Restrict the repositories which can be compared from the channel to
+	// the ones which are bound to it
+	Restrict bool
+}
+
+// Channels is a slice of Channel
+type Channels []Channel
+
+// AccessRule grants some Slack channels, user groups or users access to the
+// repositories matching its patterns. When access rules are configured, the
+// repositories which are not matched by any applicable rule cannot be compared
+type AccessRule struct {
+	// Channels, UserGroups and Users are Slack IDs, a rule without any of them
+	// applies to everyone
+	Channels   []string
+	UserGroups []string `json:"user_groups" yaml:"user_groups"`
+	Users      []string
+
+	// Repositories are glob patterns of repository names, '*' does not match
+	// the '/' separator whereas '**' does (eg: "foo/*", "bar/**")
+	Repositories []string `validate:"gt=0"`
+}
+
+// AccessRules is a slice of AccessRule
+type AccessRules []AccessRule
+
+// IssueTracker holds the configuration of an issue tracker, used to extract
+// issue references from commit messages
+type IssueTracker struct {
+	// Type can be "jira", "provider" (#456 & group/project#789 references onto the
+	// git provider of the repository) or "custom"
+	Type string `validate:"oneof=jira provider custom"`
+
+	// URL is the base URL of the Jira instance, or the URL template of the issue
+	// for "custom" trackers (eg: https://tracker.example.com/issues/$1)
+	URL string `validate:"required_unless=Type provider"`
+
+	// Pattern is the regular expression used to match issue references for "custom"
+	// trackers, a group named "key" can be used to customize the rendered key
+	Pattern string `validate:"required_if=Type custom"`
+
+	// Projects restricts "jira" trackers to the issues of these project keys (eg: ABC).
+	// Otherwise, any uppercase identifier followed by a number (eg: UTF-8) is linked
+	Projects []string `validate:"dive,required,uppercase"`
+}
+
+// IssueTrackers is a slice of IssueTracker
+type IssueTrackers []IssueTracker
+
 // Log holds runtime logging configuration
 type Log struct {
 	Level  string `default:"info" validate:"required,oneof=trace debug info warning error fatal panic"`
 	Format string `default:"text" validate:"oneof=text json"`
 }
 
+// RateLimits holds the configuration of the throttling of the calls made to
+// the APIs of the providers
+type RateLimits struct {
+	// ReservePercent of the budget of each provider the background tasks leave
+	// for the interactive calls (eg: comparisons), they get paused below it
+	ReservePercent int `default:"20" validate:"gte=0,lte=100" json:"reserve_percent" yaml:"reserve_percent"`
+
+	// MaxRetries of the calls which got rate-limited or failed with a 5xx
+	MaxRetries int `default:"3" validate:"gte=0" json:"max_retries" yaml:"max_retries"`
+
+	// MaxRetryWaitSeconds is the longest we wait before retrying a call, they
+	// fail straight away when a longer wait is required
+	MaxRetryWaitSeconds int `default:"30" validate:"gte=0" json:"max_retry_wait_seconds" yaml:"max_retry_wait_seconds"`
+}
+
 // Slack holds Slack related configuration
 type Slack struct {
 	Token         string `validate:"required"`
 	SigningSecret string `validate:"required" json:"signing_secret" yaml:"signing_secret"`
+	Templates     SlackTemplates
+}
+
+// SlackTemplates can be used to override the default rendering of the comparisons
+type SlackTemplates struct {
+	// ComparisonMessage renders the comparisons posted onto the channels
+	ComparisonMessage SlackTemplate `json:"comparison_message" yaml:"comparison_message"`
+
+	// ModalSummary renders the summary of the comparison displayed in the modal
+	ModalSummary SlackTemplate `json:"modal_summary" yaml:"modal_summary"`
+}
+
+// SlackTemplate holds a Go text/template
+type SlackTemplate struct {
+	// Format can be "mrkdwn" (the output is rendered as the text of a section) or
+	// "blocks" (the output is parsed as a JSON array of Block Kit blocks)
+	Format string `default:"mrkdwn" validate:"oneof=mrkdwn blocks"`
+
+	// Template is rendered against the data model documented in the README, it
+	// is not used when left empty
+	Template string
 }
 
 // User can be used to alias email addresses for a Slack user
@@ -74,14 +238,61 @@ type User struct {
 // Users is a slice of User
 type Users []User
 
+// Watch holds the configuration of a scheduled comparison between two refs of
+// a repository, its digest gets posted onto a Slack channel when the drift
+// between the refs crosses the configured thresholds
+type Watch struct {
+	Provider   string `validate:"oneof=github gitlab"`
+	Repository string `validate:"required"`
+	FromRef    string `validate:"required" json:"from_ref" yaml:"from_ref"`
+	ToRef      string `validate:"required" json:"to_ref" yaml:"to_ref"`
+
+	// Schedule is a standard cron expression (eg: "0 9 * * MON")
+	Schedule string `validate:"required"`
+
+	// Channel is the ID of the Slack channel to post the digest onto
+	Channel    string `validate:"required"`
+	Thresholds WatchThresholds
+}
+
+// WatchThresholds defines from when the drift of a Watch is worth a digest,
+// it gets posted if any of them is crossed. When none are defined, any difference
+// between the refs triggers a digest
+type WatchThresholds struct {
+	Commits    uint `json:"commits" yaml:"commits"`
+	AgeSeconds int  `json:"age_seconds" yaml:"age_seconds"`
+}
+
+// Watches is a slice of Watch
+type Watches []Watch
+
+// Timeouts bounds the calls made to the APIs of the providers
+type Timeouts struct {
+	// ProviderCallSeconds bounds each call made to the APIs of the providers,
+	// its retries included
+	ProviderCallSeconds int `default:"30" validate:"gt=0" json:"provider_call_seconds" yaml:"provider_call_seconds"`
+
+	// InteractionSeconds bounds the work done in the background once a Slack
+	// interaction got acknowledged (eg: comparing the refs before posting them)
+	InteractionSeconds int `default:"120" validate:"gt=0" json:"interaction_seconds" yaml:"interaction_seconds"`
+}
+
 // Config represents all the parameters required for the app to be configured properly
 type Config struct {
+	AccessRules   AccessRules `validate:"dive" json:"access_rules" yaml:"access_rules"`
+	API           API
+	Audit         Audit
 	Cache         Cache
-	Providers     Providers `validate:"gt=0,unique=Type"`
-	ListenAddress string    `default:":8080" validate:"required"`
+	Channels      Channels      `validate:"dive"`
+	IssueTrackers IssueTrackers `validate:"dive" json:"issue_trackers" yaml:"issue_trackers"`
+	Providers     Providers     `validate:"gt=0,unique=Type"`
+	ListenAddress string        `default:":8080" validate:"required"`
 	Log           Log
+	RateLimits    RateLimits `json:"rate_limits" yaml:"rate_limits"`
 	Slack         Slack
+	Timeouts      Timeouts
 	Users         Users
+	Watches       Watches `validate:"dive"`
 }
 
 // NewConfig returns a new Config with default values
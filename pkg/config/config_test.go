@@ -8,7 +8,15 @@ import (
 
 func TestNewConfig(t *testing.T) {
 	assert.Equal(t, Config{
+		Audit: Audit{
+			StoreMaxRecords:    10000,
+			FileReadMaxRecords: 10000,
+		},
 		Cache: Cache{
+			Comparisons: CacheComparisons{
+				MaxEntries: 1000,
+				MaxSizeMB:  64,
+			},
 			Providers: CacheProviders{
 				UpdateRepositories: CacheProvidersUpdateRepositories{
 					OnStart:      true,
@@ -17,6 +25,7 @@ func TestNewConfig(t *testing.T) {
 				UpdateRepositoriesRefs: CacheProvidersUpdateRepositoriesRefs{
 					OnStart:      false,
 					EverySeconds: 0,
+					Concurrency:  4,
 				},
 			},
 			Slack: CacheSlack{
@@ -24,6 +33,14 @@ func TestNewConfig(t *testing.T) {
 					OnStart:      true,
 					EverySeconds: 86400,
 				},
+				LookupUsersByEmail: CacheSlackLookupUsersByEmail{
+					Enabled:            true,
+					PositiveTTLSeconds: 86400,
+					NegativeTTLSeconds: 3600,
+					ProviderProfiles:   true,
+					MaxEntries:         10000,
+					Concurrency:        4,
+				},
 			},
 		},
 		ListenAddress: ":8080",
@@ -31,6 +48,21 @@ func TestNewConfig(t *testing.T) {
 			Level:  "info",
 			Format: "text",
 		},
+		RateLimits: RateLimits{
+			ReservePercent:      20,
+			MaxRetries:          3,
+			MaxRetryWaitSeconds: 30,
+		},
+		Slack: Slack{
+			Templates: SlackTemplates{
+				ComparisonMessage: SlackTemplate{Format: "mrkdwn"},
+				ModalSummary:      SlackTemplate{Format: "mrkdwn"},
+			},
+		},
+		Timeouts: Timeouts{
+			ProviderCallSeconds: 30,
+			InteractionSeconds:  120,
+		},
 	}, NewConfig())
 }
 
@@ -50,3 +82,33 @@ func TestValidConfig(t *testing.T) {
 
 	assert.NoError(t, cfg.Validate())
 }
+
+func TestValidConfigIssueTrackers(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Providers = Providers{
+		Provider{
+			Type:   "github",
+			Token:  "xxx",
+			Owners: []string{"foo"},
+		},
+	}
+	cfg.Slack.Token = "xxx"
+	cfg.Slack.SigningSecret = "xxx"
+
+	cfg.IssueTrackers = IssueTrackers{
+		{Type: "provider"},
+		{Type: "jira", URL: "https://jira.example.com"},
+		{Type: "jira", URL: "https://jira.example.com", Projects: []string{"ABC", "DEF2"}},
+		{Type: "custom", URL: "https://tracker.example.com/$1", Pattern: `INC(\d+)`},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.IssueTrackers = IssueTrackers{{Type: "jira"}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.IssueTrackers = IssueTrackers{{Type: "jira", URL: "https://jira.example.com", Projects: []string{"abc"}}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.IssueTrackers = IssueTrackers{{Type: "custom", URL: "https://tracker.example.com/$1"}}
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// userGroupMembersTTL is the duration for which we keep the members of the
+// Slack user groups referenced in the access rules
+const userGroupMembersTTL = 10 * time.Minute
+
+// AccessRule grants access to the repositories matching its patterns to some
+// Slack channels, user groups or users
+type AccessRule struct {
+	Channels     []string
+	UserGroups   []string
+	Users        []string
+	Repositories []*regexp.Regexp
+}
+
+// AccessRules is a slice of AccessRule
+type AccessRules []AccessRule
+
+// AccessDeniedError is returned when a user is not allowed to compare a repository
+type AccessDeniedError struct {
+	Repository providers.Repository
+}
+
+// Error implements the error interface
+func (e AccessDeniedError) Error() string {
+	// The name of the repository is not disclosed, as it is what the restriction protects
+	return ":no_entry: you are not allowed to compare this repository from here, please reach out to the administrators of the app if you believe you should"
+}
+
+// NewAccessRules compiles the access rules of the configuration
+func NewAccessRules(cfg config.AccessRules) (rules AccessRules) {
+	for _, r := range cfg {
+		rule := AccessRule{
+			Channels:   r.Channels,
+			UserGroups: r.UserGroups,
+			Users:      r.Users,
+		}
+
+		for _, glob := range r.Repositories {
+			rule.Repositories = append(rule.Repositories, compileRepositoryGlob(glob))
+		}
+
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// compileRepositoryGlob returns a regular expression matching the repository names
+// given a glob pattern. '*' and '?' do not match the '/' separator, whereas '**'
+// does (eg: 'foo/**' matches 'foo/bar/baz')
+func compileRepositoryGlob(glob string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*\*`, `.*`)
+	pattern = strings.ReplaceAll(pattern, `\*`, `[^/]*`)
+	pattern = strings.ReplaceAll(pattern, `\?`, `[^/]`)
+	// The pattern is always valid as the glob got quoted beforehand
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// matchesRepository returns whether the rule grants access to the repository
+func (r AccessRule) matchesRepository(repo providers.Repository) bool {
+	for _, re := range r.Repositories {
+		if re.MatchString(repo.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccessRuleAppliedTo returns whether the rule applies to the user in the
+// channel, rules without any channel, user group or user apply to everyone
+func (c Controller) isAccessRuleAppliedTo(r AccessRule, userID, channelID string) bool {
+	if len(r.Channels) == 0 && len(r.UserGroups) == 0 && len(r.Users) == 0 {
+		return true
+	}
+
+	for _, id := range r.Channels {
+		if id == channelID {
+			return true
+		}
+	}
+
+	for _, id := range r.Users {
+		if id == userID {
+			return true
+		}
+	}
+
+	for _, id := range r.UserGroups {
+		for _, memberID := range c.getUserGroupMembers(id) {
+			if memberID == userID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isRepositoryAllowed returns whether the user is allowed to compare the repository
+// from the channel. Everything is allowed when no access rules are configured
+func (c Controller) isRepositoryAllowed(userID, channelID string, repo providers.Repository) bool {
+	if len(c.AccessRules) == 0 {
+		return true
+	}
+
+	for _, r := range c.AccessRules {
+		if r.matchesRepository(repo) && c.isAccessRuleAppliedTo(r, userID, channelID) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRepositoryAccess returns an AccessDeniedError if the user is not allowed to
+// compare the repository from the channel
+func (c Controller) checkRepositoryAccess(userID, channelID string, repo providers.Repository) error {
+	if repo.IsEmpty() || c.isRepositoryAllowed(userID, channelID, repo) {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":    userID,
+		"channel_id": channelID,
+		"repository": repo.Name,
+	}).Info("denied access to repository")
+
+	return AccessDeniedError{Repository: repo}
+}
+
+// filterAllowedRepositories returns the repositories the user is allowed to compare
+// from the channel. It must be applied before looking up for repositories by name,
+// so that the restricted ones can neither shadow nor disclose anything
+func (c Controller) filterAllowedRepositories(userID, channelID string, repos providers.Repositories) providers.Repositories {
+	if len(c.AccessRules) == 0 {
+		return repos
+	}
+
+	allowed := make(providers.Repositories)
+	for k, r := range repos {
+		if c.isRepositoryAllowed(userID, channelID, r) {
+			allowed[k] = r
+		}
+	}
+	return allowed
+}
+
+// getUserGroupMembers returns the IDs of the members of a Slack user group
+func (c Controller) getUserGroupMembers(userGroupID string) []string {
+	if members, found := c.Store.GetSlackUserGroupMembers(userGroupID, userGroupMembersTTL); found {
+		return members
+	}
+
+	members, err := c.Slack.Client.GetUserGroupMembers(userGroupID)
+	if err != nil {
+		log.WithError(err).WithField("user_group_id", userGroupID).Warning("fetching user group members")
+		return nil
+	}
+
+	c.Store.SetSlackUserGroupMembers(userGroupID, members)
+	return members
+}
+
+// respondAccessDenied explains to the user, with an ephemeral message, why the
+// interaction got denied
+func (c Controller) respondAccessDenied(channelID, userID string, err error) {
+	if _, postErr := c.Slack.Client.PostEphemeral(channelID, userID, goSlack.MsgOptionText(err.Error(), false)); postErr != nil {
+		log.WithError(postErr).Warning("explaining access denial")
+	}
+}
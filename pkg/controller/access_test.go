@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileRepositoryGlob(t *testing.T) {
+	for glob, expected := range map[string]map[string]bool{
+		"foo/*": {
+			"foo/bar":     true,
+			"foo/bar/baz": false,
+			"foo":         false,
+			"foobar/baz":  false,
+		},
+		"foo/**": {
+			"foo/bar":     true,
+			"foo/bar/baz": true,
+			"bar/foo/baz": false,
+		},
+		"*/api-?": {
+			"foo/api-1":  true,
+			"foo/api-10": false,
+			"foo/api.1":  false,
+		},
+		"foo.bar/baz": {
+			"foo.bar/baz": true,
+			"fooxbar/baz": false,
+		},
+	} {
+		re := compileRepositoryGlob(glob)
+		for name, match := range expected {
+			assert.Equal(t, match, re.MatchString(name), "%s ~ %s", glob, name)
+		}
+	}
+}
+
+func TestCheckRepositoryAccess(t *testing.T) {
+	c := Controller{Store: &store.Store{}}
+	foo := providers.Repository{Name: "foo/api", ProviderType: providers.ProviderTypeGitHub}
+	bar := providers.Repository{Name: "bar/api", ProviderType: providers.ProviderTypeGitHub}
+	pub := providers.Repository{Name: "public/docs", ProviderType: providers.ProviderTypeGitHub}
+
+	// No rules, everything is allowed
+	assert.NoError(t, c.checkRepositoryAccess("U1", "C1", foo))
+
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Channels: []string{"C1"}, Repositories: []string{"foo/*"}},
+		{UserGroups: []string{"S1"}, Repositories: []string{"bar/**"}},
+		{Users: []string{"U3"}, Repositories: []string{"**"}},
+		{Repositories: []string{"public/*"}},
+	})
+	c.Store.SetSlackUserGroupMembers("S1", []string{"U2"})
+
+	assert.NoError(t, c.checkRepositoryAccess("U1", "C1", foo))
+	assert.Equal(t, AccessDeniedError{Repository: foo}, c.checkRepositoryAccess("U1", "C2", foo))
+	assert.Equal(t, AccessDeniedError{Repository: bar}, c.checkRepositoryAccess("U1", "C1", bar))
+	assert.NoError(t, c.checkRepositoryAccess("U2", "C2", bar))
+	assert.NoError(t, c.checkRepositoryAccess("U3", "C2", foo))
+	assert.NoError(t, c.checkRepositoryAccess("U1", "C2", pub))
+
+	// Nothing to check until a repository gets selected
+	assert.NoError(t, c.checkRepositoryAccess("U1", "C2", providers.Repository{}))
+
+	allowed := c.filterAllowedRepositories("U1", "C1", providers.Repositories{
+		foo.Key(): foo,
+		bar.Key(): bar,
+		pub.Key(): pub,
+	})
+	assert.Equal(t, providers.Repositories{foo.Key(): foo, pub.Key(): pub}, allowed)
+
+	// The denial does not disclose the name of the repository
+	assert.NotContains(t, AccessDeniedError{Repository: foo}.Error(), foo.Name)
+}
+
+func TestSearchAllowedRepositories(t *testing.T) {
+	c := newTestControllerWithRepositories("secret/api", "public/api-docs")
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Repositories: []string{"public/*"}},
+	})
+
+	// The restricted repository is the closest match, but not allowed
+	assert.Equal(t, "public/api-docs", c.getChannelRepositoryByClosestNameMatch("U1", "C1", "api").Name)
+
+	repos := c.searchChannelRepositories("U1", "C1", "api", 20)
+	assert.Len(t, repos, 1)
+	assert.Equal(t, "public/api-docs", repos[0].Name)
+}
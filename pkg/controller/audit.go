@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// historyCommandLimit is the amount of records listed by the history command
+const historyCommandLimit = 10
+
+// auditComparison writes the comparison onto the audit log
+func (c Controller) auditComparison(source, userID, channelID string, opts slack.ModalRequestOptions, posted bool) {
+	if c.Audit == nil || opts.Comparison == nil {
+		return
+	}
+
+	c.Audit.Log(audit.NewRecord(source, userID, channelID, opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, posted))
+}
+
+// handleHistoryCommand lists the latest comparisons requested from the channel,
+// optionally for a given repository
+func (c Controller) handleHistoryCommand(w http.ResponseWriter, sc goSlack.SlashCommand, cmd slack.Command) {
+	q := audit.Query{ChannelID: sc.ChannelID}
+	if len(cmd.Args) > 0 {
+		repo := c.filterAllowedRepositories(sc.UserID, sc.ChannelID, c.Store.GetRepositories()).GetByClosestNameMatch(cmd.Args[0])
+		if repo.IsEmpty() {
+			respondEphemeral(w, fmt.Sprintf(":warning: could not find any repository matching `%s`", cmd.Args[0]))
+			return
+		}
+		q.Repository = repo.Name
+	}
+
+	records, err := c.Audit.Read(q)
+	if err != nil {
+		log.WithError(err).Warning("reading audit records")
+		respondEphemeral(w, ":warning: the history of the comparisons is not available")
+		return
+	}
+
+	var lines []string
+	for _, r := range records {
+		if len(lines) >= historyCommandLimit {
+			break
+		}
+
+		// The history must not disclose the repositories the user cannot compare
+		if len(c.AccessRules) > 0 && !c.isRepositoryAllowed(sc.UserID, sc.ChannelID, c.getAuditedRepository(r)) {
+			continue
+		}
+
+		lines = append(lines, auditRecordLine(r))
+	}
+
+	if len(lines) == 0 {
+		respondEphemeral(w, ":shrug: nothing has been compared from this channel yet")
+		return
+	}
+
+	respondEphemeral(w, ":scroll: latest comparisons requested from this channel\n"+strings.Join(lines, "\n"))
+}
+
+// getAuditedRepository returns the repository referenced by a record, falling
+// back onto its name if it is not cached anymore
+func (c Controller) getAuditedRepository(r audit.Record) (repo providers.Repository) {
+	for _, cached := range c.Store.GetRepositories() {
+		if cached.Name == r.Repository && cached.ProviderType.String() == r.Provider {
+			return cached
+		}
+	}
+	return providers.Repository{Name: r.Repository}
+}
+
+// auditRecordLine renders an audit record as a line of the history command
+func auditRecordLine(r audit.Record) string {
+	requester := "a watch"
+	if r.SlackUserID != "" {
+		requester = fmt.Sprintf("<@%s>", r.SlackUserID)
+	}
+
+	action := "viewed"
+	if r.Posted {
+		action = "posted"
+	}
+
+	return fmt.Sprintf(
+		"• <!date^%d^{date_short_pretty} {time}|%s> %s %s <%s|`%s` %s → %s> (%d commits)",
+		r.Timestamp.Unix(),
+		r.Timestamp.UTC().Format(time.RFC3339),
+		requester,
+		action,
+		r.WebURL,
+		r.Repository,
+		auditRefString(r.FromRef, r.FromSHA),
+		auditRefString(r.ToRef, r.ToSHA),
+		r.CommitCount,
+	)
+}
+
+// auditRefString renders a ref along with the SHA it got resolved to
+func auditRefString(name, sha string) string {
+	if len(sha) > 9 {
+		sha = sha[:9]
+	}
+
+	if sha == "" || sha == name {
+		return fmt.Sprintf("`%s`", name)
+	}
+	return fmt.Sprintf("`%s` (%s)", name, sha)
+}
+
+// AuditAPIHandler returns the audit records matching the query parameters
+// (repository, slack_user_id, channel_id, since, until and limit) as JSON
+func (c Controller) AuditAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if c.APIToken == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.APIToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := c.Audit.Read(q)
+	if err != nil {
+		log.WithError(err).Error("reading audit records")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = audit.Records{}
+	}
+
+	resp, _ := json.Marshal(records)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		log.WithError(err).Error()
+	}
+}
+
+// parseAuditQuery returns the audit.Query given the parameters of the request,
+// since and until are RFC3339 timestamps and limit defaults to 100
+func parseAuditQuery(r *http.Request) (q audit.Query, err error) {
+	params := r.URL.Query()
+	q.Repository = params.Get("repository")
+	q.SlackUserID = params.Get("slack_user_id")
+	q.ChannelID = params.Get("channel_id")
+	q.Limit = 100
+
+	if v := params.Get("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid 'since' parameter: %v", err)
+		}
+	}
+
+	if v := params.Get("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid 'until' parameter: %v", err)
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid 'limit' parameter: %s", v)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRecordLine(t *testing.T) {
+	ts := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t,
+		"• <!date^1622548800^{date_short_pretty} {time}|2021-06-01T12:00:00Z> <@U1> posted <https://github.com/foo/bar/compare/v1.0.0...main|`foo/bar` `v1.0.0` (012345678) → `main` (abcdef012)> (3 commits)",
+		auditRecordLine(audit.Record{
+			Timestamp:   ts,
+			SlackUserID: "U1",
+			Repository:  "foo/bar",
+			FromRef:     "v1.0.0",
+			FromSHA:     "0123456789abcdef",
+			ToRef:       "main",
+			ToSHA:       "abcdef0123456789",
+			CommitCount: 3,
+			WebURL:      "https://github.com/foo/bar/compare/v1.0.0...main",
+			Posted:      true,
+		}),
+	)
+
+	assert.Equal(t,
+		"• <!date^1622548800^{date_short_pretty} {time}|2021-06-01T12:00:00Z> a watch viewed <https://example.com|`foo/bar` `v1.0.0` → `main`> (0 commits)",
+		auditRecordLine(audit.Record{
+			Timestamp:  ts,
+			Repository: "foo/bar",
+			FromRef:    "v1.0.0",
+			ToRef:      "main",
+			WebURL:     "https://example.com",
+		}),
+	)
+}
+
+func TestParseAuditQuery(t *testing.T) {
+	q, err := parseAuditQuery(httptest.NewRequest(http.MethodGet, "/api/audit?repository=foo/bar&channel_id=C1&since=2021-06-01T00:00:00Z&limit=5", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, audit.Query{
+		Repository: "foo/bar",
+		ChannelID:  "C1",
+		Since:      time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		Limit:      5,
+	}, q)
+
+	q, err = parseAuditQuery(httptest.NewRequest(http.MethodGet, "/api/audit", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, q.Limit)
+
+	for _, params := range []string{"since=yesterday", "until=1", "limit=foo", "limit=-1"} {
+		_, err = parseAuditQuery(httptest.NewRequest(http.MethodGet, "/api/audit?"+params, nil))
+		assert.Error(t, err, params)
+	}
+}
+
+func TestAuditAPIHandler(t *testing.T) {
+	c := Controller{Store: &store.Store{}}
+
+	var err error
+	c.Audit, err = audit.NewLogger(config.Audit{StoreMaxRecords: 10}, c.Store)
+	assert.NoError(t, err)
+	c.Audit.Log(audit.Record{Repository: "foo/a"})
+	c.Audit.Log(audit.Record{Repository: "foo/b"})
+
+	request := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/audit?repository=foo/b", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		c.AuditAPIHandler(w, r)
+		return w
+	}
+
+	// Disabled
+	assert.Equal(t, http.StatusNotFound, request("").Code)
+
+	c.APIToken = "secret"
+	assert.Equal(t, http.StatusUnauthorized, request("").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("foo").Code)
+
+	w := request("secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var records audit.Records
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &records))
+	assert.Len(t, records, 1)
+	assert.Equal(t, "foo/b", records[0].Repository)
+}
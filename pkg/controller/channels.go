@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// getChannelRepositories returns the repositories bound to a channel, either
+// through the configuration or the bind command, and whether the channel
+// is restricted to them
+func (c Controller) getChannelRepositories(channelID string) (repos providers.Repositories, restricted bool) {
+	repos = make(providers.Repositories)
+	allRepos := c.Store.GetRepositories()
+
+	for _, ch := range c.Channels {
+		if ch.ID != channelID {
+			continue
+		}
+
+		restricted = restricted || ch.Restrict
+		for _, name := range ch.Repositories {
+			for k, r := range allRepos {
+				if r.Name == name {
+					repos[k] = r
+				}
+			}
+		}
+	}
+
+	for _, rk := range c.Store.GetChannelRepositories(channelID) {
+		if r, found := allRepos.GetByKey(rk); found {
+			repos[rk] = r
+		}
+	}
+
+	return
+}
+
+// searchChannelRepositories looks up for the repositories the user is allowed to
+// compare, taking into account the ones which are bound to the channel. They are
+// returned first, or exclusively if the channel is restricted to them. The ones
+// the most used by the user, and overall, are ranked first
+func (c Controller) searchChannelRepositories(userID, channelID, filter string, limit int) (repos providers.RankedRepositories) {
+	usage := c.Store.GetRepositoriesUsage(userID)
+	allRepos := c.filterAllowedRepositories(userID, channelID, c.Store.GetRepositories())
+	boundRepos, restricted := c.getChannelRepositories(channelID)
+	boundRepos = c.filterAllowedRepositories(userID, channelID, boundRepos)
+	if len(boundRepos) == 0 && !restricted {
+		return allRepos.SearchWithUsage(filter, limit, usage)
+	}
+
+	repos = boundRepos.SearchWithUsage(filter, limit, usage)
+	if restricted {
+		return
+	}
+
+	for _, r := range allRepos.SearchWithUsage(filter, limit, usage) {
+		if len(repos) >= limit {
+			break
+		}
+
+		if _, found := boundRepos[r.Key()]; !found {
+			repos = append(repos, r)
+		}
+	}
+
+	return
+}
+
+// getChannelRepositoryByClosestNameMatch returns the most pertinent repository
+// the user is allowed to compare given its name and the repositories bound to the
+// channel. If no name is provided and a single repository is bound to the channel,
+// it gets returned
+func (c Controller) getChannelRepositoryByClosestNameMatch(userID, channelID, name string) (repo providers.Repository) {
+	if len(name) == 0 {
+		boundRepos, _ := c.getChannelRepositories(channelID)
+		if boundRepos = c.filterAllowedRepositories(userID, channelID, boundRepos); len(boundRepos) == 1 {
+			for _, r := range boundRepos {
+				repo = r
+			}
+		}
+		return
+	}
+
+	for _, r := range c.searchChannelRepositories(userID, channelID, name, 1) {
+		repo = r.Repository
+	}
+	return
+}
+
+// handleBindCommand binds or unbinds a repository to/from a channel, or lists
+// the repositories bound to it if none is given. Only the repositories the user
+// is allowed to compare from the channel can be looked up
+func (c Controller) handleBindCommand(w http.ResponseWriter, sc goSlack.SlashCommand, cmd slack.Command) {
+	channelID := sc.ChannelID
+	if len(cmd.Args) == 0 {
+		boundRepos, restricted := c.getChannelRepositories(channelID)
+		if boundRepos = c.filterAllowedRepositories(sc.UserID, channelID, boundRepos); len(boundRepos) == 0 {
+			respondEphemeral(w, ":shrug: there are no repositories bound to this channel")
+			return
+		}
+
+		var names []string
+		for _, r := range boundRepos {
+			names = append(names, fmt.Sprintf("`%s`", r.Name))
+		}
+		sort.Strings(names)
+
+		msg := fmt.Sprintf(":link: repositories bound to this channel: %s", strings.Join(names, ", "))
+		if restricted {
+			msg += "\n_this channel is restricted to them_"
+		}
+
+		respondEphemeral(w, msg)
+		return
+	}
+
+	repo := c.filterAllowedRepositories(sc.UserID, channelID, c.Store.GetRepositories()).GetByClosestNameMatch(cmd.Args[0])
+	if repo.IsEmpty() {
+		respondEphemeral(w, fmt.Sprintf(":warning: could not find any repository matching `%s`", cmd.Args[0]))
+		return
+	}
+
+	if cmd.Type == slack.CommandTypeUnbind {
+		c.Store.UnbindChannelRepository(channelID, repo.Key())
+		respondEphemeral(w, fmt.Sprintf(":link: `%s` is not bound to this channel anymore", repo.Name))
+	} else {
+		c.Store.BindChannelRepository(channelID, repo.Key())
+		respondEphemeral(w, fmt.Sprintf(":link: `%s` is now bound to this channel", repo.Name))
+	}
+
+	log.WithFields(log.Fields{
+		"channel_id":      channelID,
+		"action":          cmd.Type.String(),
+		"repository_name": repo.Name,
+	}).Info("updated channel repositories bindings")
+}
+
+// handleFavoritesCommand lists the comparisons pinned to the channel which the
+// user is allowed to compare from it
+func (c Controller) handleFavoritesCommand(w http.ResponseWriter, sc goSlack.SlashCommand) {
+	var lines []string
+	for _, uc := range c.Store.GetChannelFavorites(sc.ChannelID) {
+		repo, fromRef, toRef, found := c.resolveUserComparison(uc)
+		if !found || !c.isRepositoryAllowed(sc.UserID, sc.ChannelID, repo) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("> `/compare %s %s %s`", repo.Name, fromRef.Name, toRef.Name))
+	}
+
+	if len(lines) == 0 {
+		respondEphemeral(w, ":shrug: there are no comparisons pinned to this channel, pin them from the App Home tab")
+		return
+	}
+
+	respondEphemeral(w, ":star: comparisons pinned to this channel\n"+strings.Join(lines, "\n"))
+}
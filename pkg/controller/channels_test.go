@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+
+	goSlack "github.com/slack-go/slack"
+)
+
+func newTestControllerWithRepositories(names ...string) Controller {
+	c := Controller{Store: &store.Store{}}
+	repos := make(providers.Repositories)
+	for _, name := range names {
+		r := providers.Repository{Name: name, ProviderType: providers.ProviderTypeGitHub}
+		repos[r.Key()] = r
+	}
+	c.Store.UpdateRepositories(repos)
+	return c
+}
+
+func TestSearchChannelRepositories(t *testing.T) {
+	c := newTestControllerWithRepositories("foo/api", "foo/api-fork", "bar/api")
+	c.Channels = config.Channels{
+		{ID: "C1", Repositories: []string{"bar/api"}},
+		{ID: "C2", Repositories: []string{"bar/api"}, Restrict: true},
+	}
+
+	// Unbound channel
+	assert.Len(t, c.searchChannelRepositories("", "C0", "api", 20), 3)
+
+	// Bound repositories are returned first
+	repos := c.searchChannelRepositories("", "C1", "api", 20)
+	assert.Len(t, repos, 3)
+	assert.Equal(t, "bar/api", repos[0].Name)
+
+	// Restricted channel
+	repos = c.searchChannelRepositories("", "C2", "api", 20)
+	assert.Len(t, repos, 1)
+	assert.Equal(t, "bar/api", repos[0].Name)
+
+	// Bindings from the store
+	c.Store.BindChannelRepository("C0", providers.Repository{Name: "foo/api-fork", ProviderType: providers.ProviderTypeGitHub}.Key())
+	assert.Equal(t, "foo/api-fork", c.searchChannelRepositories("", "C0", "api", 20)[0].Name)
+}
+
+func TestSearchChannelRepositoriesUsage(t *testing.T) {
+	c := newTestControllerWithRepositories("platform/api", "foo/api")
+	platformAPI := providers.Repository{Name: "platform/api", ProviderType: providers.ProviderTypeGitHub}
+	assert.Equal(t, "foo/api", c.searchChannelRepositories("U1", "C0", "api", 20)[0].Name)
+
+	c.Store.RecordUsage("U1", store.UserComparison{RepositoryKey: platformAPI.Key()})
+	assert.Equal(t, "platform/api", c.searchChannelRepositories("U1", "C0", "api", 20)[0].Name)
+
+	// The usage of the other users is taken into account as well
+	c.Store.RecordUsage("U1", store.UserComparison{RepositoryKey: platformAPI.Key()})
+	assert.Equal(t, "platform/api", c.searchChannelRepositories("U2", "C0", "api", 20)[0].Name)
+	assert.Equal(t, "platform/api", c.searchChannelRepositories("", "C0", "api", 20)[0].Name)
+}
+
+func TestGetChannelRepositoryByClosestNameMatch(t *testing.T) {
+	c := newTestControllerWithRepositories("foo/api", "bar/api")
+	c.Channels = config.Channels{
+		{ID: "C1", Repositories: []string{"bar/api"}},
+	}
+
+	assert.Equal(t, "bar/api", c.getChannelRepositoryByClosestNameMatch("U1", "C1", "").Name)
+	assert.True(t, c.getChannelRepositoryByClosestNameMatch("U1", "C0", "").IsEmpty())
+	assert.Equal(t, "bar/api", c.getChannelRepositoryByClosestNameMatch("U1", "C1", "api").Name)
+}
+
+func TestHandleBindCommandRestrictedRepository(t *testing.T) {
+	c := newTestControllerWithRepositories("secret/api", "public/docs")
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Repositories: []string{"public/*"}},
+	})
+
+	w := httptest.NewRecorder()
+	c.handleBindCommand(w, goSlack.SlashCommand{UserID: "U1", ChannelID: "C1"}, slack.Command{Type: slack.CommandTypeBind, Args: []string{"secret/api"}})
+	assert.NotContains(t, w.Body.String(), "secret/api` is now bound")
+	assert.NotContains(t, c.Store.GetChannelRepositories("C1"), providers.Repository{Name: "secret/api", ProviderType: providers.ProviderTypeGitHub}.Key())
+}
+
+func TestHandleFavoritesCommand(t *testing.T) {
+	c := newTestControllerWithRepositories()
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Repositories: []string{"public/*"}},
+	})
+
+	main := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	tag := providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag}
+	repos := make(providers.Repositories)
+	for _, name := range []string{"secret/api", "public/docs"} {
+		r := providers.Repository{
+			Name:         name,
+			ProviderType: providers.ProviderTypeGitHub,
+			Refs:         providers.Refs{main.Key(): main, tag.Key(): tag},
+		}
+		repos[r.Key()] = r
+		c.Store.PinChannelFavorite("C1", store.UserComparison{RepositoryKey: r.Key(), FromRefKey: tag.Key(), ToRefKey: main.Key()})
+	}
+	c.Store.UpdateRepositories(repos)
+
+	w := httptest.NewRecorder()
+	c.handleFavoritesCommand(w, goSlack.SlashCommand{UserID: "U1", ChannelID: "C1"})
+	assert.Contains(t, w.Body.String(), "/compare public/docs v1.0.0 main")
+	assert.NotContains(t, w.Body.String(), "secret/api")
+
+	w = httptest.NewRecorder()
+	c.handleFavoritesCommand(w, goSlack.SlashCommand{UserID: "U1", ChannelID: "C2"})
+	assert.Contains(t, w.Body.String(), "there are no comparisons pinned to this channel")
+}
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// handleCompareCommand resolves the repository and refs given as arguments and
+// whether opens the modal prefilled with them, or posts the comparison
+func (c Controller) handleCompareCommand(w http.ResponseWriter, sc goSlack.SlashCommand, cmd slack.Command) {
+	opts := slack.ModalRequestOptions{
+		ConversationID:           sc.ChannelID,
+		LastRepositoriesUpdate:   c.Store.GetRepositoriesLastUpdate(),
+		StaleRepositoriesSources: c.Store.GetStaleRepositoriesSources(),
+	}
+
+	// Whether the arguments could match several repositories or refs equally
+	var ambiguous bool
+
+	if len(c.Store.GetRepositories()) == 0 ||
+		opts.LastRepositoriesUpdate.IsZero() {
+		opts.CurrentlyUpdatingRepositories = true
+	} else {
+		var name string
+		if len(cmd.Args) > 0 {
+			name = cmd.Args[0]
+		}
+
+		opts.Repository = c.getChannelRepositoryByClosestNameMatch(sc.UserID, sc.ChannelID, name)
+		if err := c.checkRepositoryAccess(sc.UserID, sc.ChannelID, opts.Repository); err != nil {
+			respondEphemeral(w, err.Error())
+			return
+		}
+
+		if len(name) > 0 {
+			ambiguous = c.searchChannelRepositories(sc.UserID, sc.ChannelID, name, 2).IsAmbiguous()
+		}
+		if !opts.Repository.IsEmpty() {
+			// Check if it could be worth to trigger an update of the repository's refs
+			if opts.Repository.RefsLastUpdate.IsZero() ||
+				len(opts.Repository.Refs) == 0 {
+				opts.CurrentlyUpdatingRepositoryRefs = true
+			}
+
+			refs := opts.Repository.Refs
+			if cmd.Flags.RefType != nil {
+				refs = refs.FilterByType(*cmd.Flags.RefType)
+			}
+
+			if len(refs) > 0 && len(cmd.Args) > 1 {
+				opts.FromRef = refs.GetByClosestNameMatch(cmd.Args[1])
+				ambiguous = ambiguous || refs.Search(cmd.Args[1], 2).IsAmbiguous()
+				if len(cmd.Args) > 2 {
+					opts.ToRef = refs.GetByClosestNameMatch(cmd.Args[2])
+					ambiguous = ambiguous || refs.Search(cmd.Args[2], 2).IsAmbiguous()
+					// Slack expects the command to be acknowledged within 3 seconds,
+					// the comparison gets computed in the background
+					opts.CurrentlyComparing = !opts.FromRef.IsEmpty() && !opts.ToRef.IsEmpty()
+				}
+			}
+		}
+	}
+
+	// Let the user pick the right repository or refs from the modal
+	if ambiguous {
+		c.openModal(sc.TriggerID, sc.UserID, audit.SourceSlashCommand, opts)
+		return
+	}
+
+	if opts.CurrentlyComparing && !cmd.Flags.Ephemeral &&
+		c.Store.GetUserPreferences(sc.UserID).DirectPost {
+		cmd.Flags.Post = true
+	}
+
+	if cmd.Flags.Post || cmd.Flags.Ephemeral {
+		if !opts.CurrentlyComparing {
+			msg := "the repository and both refs must be resolved to post the comparison"
+			if opts.CurrentlyUpdatingRepositories || opts.CurrentlyUpdatingRepositoryRefs {
+				msg += ", the cached lists may be outdated (see `/compare refresh`)"
+			}
+
+			respondEphemeral(w, slack.CommandUsageError{
+				Type:    cmd.Type,
+				Message: msg,
+			}.Error())
+			return
+		}
+
+		go c.postComparison(sc.UserID, sc.ResponseURL, audit.SourceSlashCommand, cmd.Flags.Ephemeral, opts)
+		return
+	}
+
+	c.openModal(sc.TriggerID, sc.UserID, audit.SourceSlashCommand, opts)
+}
+
+// handleLastCommand compares again the last refs compared by the user
+func (c Controller) handleLastCommand(w http.ResponseWriter, sc goSlack.SlashCommand, cmd slack.Command) {
+	history := c.Store.GetUserComparisons(sc.UserID)
+	if len(history) == 0 {
+		respondEphemeral(w, ":shrug: you have not compared anything yet")
+		return
+	}
+
+	opts := slack.ModalRequestOptions{
+		ConversationID:           sc.ChannelID,
+		LastRepositoriesUpdate:   c.Store.GetRepositoriesLastUpdate(),
+		StaleRepositoriesSources: c.Store.GetStaleRepositoriesSources(),
+	}
+
+	var found bool
+	opts.Repository, opts.FromRef, opts.ToRef, found = c.resolveUserComparison(history[0])
+	if !found {
+		respondEphemeral(w, ":warning: your last comparison could not be found anymore")
+		return
+	}
+
+	err := c.checkRepositoryAccess(sc.UserID, sc.ChannelID, opts.Repository)
+	if err != nil {
+		respondEphemeral(w, err.Error())
+		return
+	}
+
+	// The comparison gets computed in the background
+	opts.CurrentlyComparing = true
+	if cmd.Flags.Post || cmd.Flags.Ephemeral {
+		go c.postComparison(sc.UserID, sc.ResponseURL, audit.SourceSlashCommand, cmd.Flags.Ephemeral, opts)
+		return
+	}
+
+	c.openModal(sc.TriggerID, sc.UserID, audit.SourceSlashCommand, opts)
+}
+
+// handleRefreshCommand triggers an update of the repositories list, or of the refs
+// of a given repository amongst the ones the user is allowed to compare
+func (c Controller) handleRefreshCommand(w http.ResponseWriter, sc goSlack.SlashCommand, cmd slack.Command) {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	if len(cmd.Args) == 0 {
+		c.ScheduleTask(TaskTypeRepositoriesUpdate, &wg)
+		respondEphemeral(w, ":repeat: updating repositories list..")
+		return
+	}
+
+	repo := c.filterAllowedRepositories(sc.UserID, sc.ChannelID, c.Store.GetRepositories()).GetByClosestNameMatch(cmd.Args[0])
+	if repo.IsEmpty() {
+		respondEphemeral(w, fmt.Sprintf(":warning: could not find any repository matching `%s`", cmd.Args[0]))
+		return
+	}
+
+	c.ScheduleTask(TaskTypeRepositoryRefsUpdate, &wg, repo.Key())
+	respondEphemeral(w, fmt.Sprintf(":repeat: updating refs list of `%s`..", repo.Name))
+}
+
+// handleWatchCommand lists or runs the watches posting in the channel
+func (c Controller) handleWatchCommand(w http.ResponseWriter, channelID string, cmd slack.Command) {
+	var lines []string
+	for id, d := range c.WatchDigests {
+		if d.Channel != channelID {
+			continue
+		}
+
+		if len(cmd.Args) > 0 && cmd.Args[0] == "run" {
+			c.ScheduleTask(TaskTypeWatchCompare, id)
+		}
+
+		for _, watchID := range d.WatchIDs {
+			watch := c.Watches[watchID]
+			lines = append(lines, fmt.Sprintf("> `%s` `%s` :arrow_right: `%s` _(%s)_", watch.Repository, watch.FromRef, watch.ToRef, watch.Schedule))
+		}
+	}
+
+	if len(lines) == 0 {
+		respondEphemeral(w, ":shrug: there are no watches configured for this channel")
+		return
+	}
+
+	header := "*watches posting in this channel*"
+	if len(cmd.Args) > 0 && cmd.Args[0] == "run" {
+		header = "*running the watches posting in this channel*"
+	}
+
+	respondEphemeral(w, header+"\n"+strings.Join(lines, "\n"))
+}
+
+// openModal opens the modal and triggers the data fetches it may require, the
+// comparisons computed in the background get audited for the user and source
+func (c Controller) openModal(triggerID, userID, source string, opts slack.ModalRequestOptions) {
+	resp, err := c.Slack.Client.OpenView(triggerID, c.Slack.GetModalRequest(opts))
+	if err != nil {
+		log.WithError(fmt.Errorf("opening view: %s -> %v", err.Error(), resp.ResponseMetadata)).Error()
+		return
+	}
+
+	c.handleRequiredDataFetchesAndUpdateModalAfterCompletion(resp.ID, resp.Hash, userID, source, opts)
+}
+
+// postComparison compares the refs and posts the comparison into the conversation
+// of the options, or as a preview only visible to the requester if ephemeral is
+// set. If the bot is not a member of the channel, it falls back onto the
+// responseURL, when provided. It is meant to run in the background once the
+// request got acknowledged, failures get reported to the requester
+func (c Controller) postComparison(userID, responseURL, source string, ephemeral bool, opts slack.ModalRequestOptions) {
+	ctx, cancel := c.interactionContext()
+	defer cancel()
+
+	var err error
+	if opts.Comparison, err = c.compare(ctx, opts.Repository, opts.FromRef, opts.ToRef); err != nil {
+		log.WithError(err).Warning("comparing refs")
+		c.respondComparisonError(opts.ConversationID, opts.ThreadTS, userID, responseURL, err)
+		return
+	}
+
+	var blocks goSlack.Blocks
+	if ephemeral {
+		blocks = c.Slack.GenerateComparisonPreviewMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, userID, newMessageActionValue(opts, userID).String())
+	} else {
+		blocks = c.Slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, userID, newMessageActionValue(opts, userID).String())
+	}
+
+	if err = c.sendMessage(opts.ConversationID, opts.ThreadTS, userID, responseURL, ephemeral, blocks); err != nil {
+		log.WithError(err).Error()
+		return
+	}
+
+	c.recordUserComparison(userID, opts)
+	c.auditComparison(source, userID, opts.ConversationID, opts, !ephemeral)
+}
+
+// sendMessage posts the blocks into the channel (or as a reply to the thread if
+// threadTS is set), or as a message only visible to the user if ephemeral is set.
+// If the bot is not a member of the channel, it falls back onto the responseURL,
+// when provided
+func (c Controller) sendMessage(channelID, threadTS, userID, responseURL string, ephemeral bool, blocks goSlack.Blocks) (err error) {
+	msgOpts := []goSlack.MsgOption{goSlack.MsgOptionBlocks(blocks.BlockSet...)}
+	if threadTS != "" {
+		msgOpts = append(msgOpts, goSlack.MsgOptionTS(threadTS))
+	}
+
+	if ephemeral {
+		_, err = c.Slack.Client.PostEphemeral(channelID, userID, msgOpts...)
+	} else {
+		_, _, err = c.Slack.Client.PostMessage(channelID, msgOpts...)
+	}
+
+	if err != nil && isNotInChannelError(err) && responseURL != "" {
+		log.WithError(err).WithField("channel_id", channelID).Debug("falling back onto response_url")
+
+		responseType := goSlack.ResponseTypeInChannel
+		if ephemeral {
+			responseType = goSlack.ResponseTypeEphemeral
+		}
+
+		err = goSlack.PostWebhook(responseURL, &goSlack.WebhookMessage{
+			ResponseType:    responseType,
+			ThreadTimestamp: threadTS,
+			Blocks:          &blocks,
+		})
+	}
+
+	return
+}
+
+// isNotInChannelError returns whether the error was caused by the bot not being able
+// to post in the channel
+func isNotInChannelError(err error) bool {
+	switch err.Error() {
+	case "not_in_channel", "channel_not_found":
+		return true
+	}
+	return false
+}
+
+// handlePreferCommand sets the preferred behavior of the user when all the
+// arguments of the command are given
+func (c Controller) handlePreferCommand(w http.ResponseWriter, userID string, cmd slack.Command) {
+	prefs := c.Store.GetUserPreferences(userID)
+	prefs.DirectPost = cmd.Args[0] == "post"
+	c.Store.SetUserPreferences(userID, prefs)
+
+	if prefs.DirectPost {
+		respondEphemeral(w, ":ok_hand: comparisons will now be posted directly when the repository and refs are given unambiguously")
+		return
+	}
+
+	respondEphemeral(w, ":ok_hand: the modal will now always be opened")
+}
+
+// recordUserComparison adds the comparison to the history of the user and
+// counts the use of its repository and refs
+func (c Controller) recordUserComparison(userID string, opts slack.ModalRequestOptions) {
+	uc := newUserComparison(opts)
+	c.Store.AddUserComparison(userID, uc)
+	c.Store.RecordUsage(userID, uc)
+}
+
+// newUserComparison returns a UserComparison referencing the repository and refs
+// of the options, as well as the conversation they got compared from
+func newUserComparison(opts slack.ModalRequestOptions) store.UserComparison {
+	return store.UserComparison{
+		RepositoryKey: opts.Repository.Key(),
+		FromRefKey:    opts.FromRef.Key(),
+		ToRefKey:      opts.ToRef.Key(),
+		ComparedAt:    time.Now(),
+		ChannelID:     opts.ConversationID,
+	}
+}
@@ -3,15 +3,18 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
 	"github.com/mvisonneau/slack-git-compare/pkg/config"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers/github"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers/gitlab"
 	"github.com/mvisonneau/slack-git-compare/pkg/slack"
 	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	"github.com/vmihailenco/taskq/v3"
 )
@@ -19,20 +22,72 @@ import (
 // Controller holds the necessary clients to run the app and handle requests
 type Controller struct {
 	Context        context.Context
+	Channels       config.Channels
 	Providers      providers.Providers
+	IssueTrackers  map[providers.ProviderType]providers.IssueTrackers
 	Store          *store.Store
 	Slack          slack.Slack
 	TaskController TaskController
+	Watches        config.Watches
+	WatchDigests   []WatchDigest
+	Cron           *cron.Cron
+	AccessRules    AccessRules
+	Audit          *audit.Logger
+
+	// RefsUpdateConcurrency is the amount of repositories whose refs get updated
+	// at once when refreshing all of them
+	RefsUpdateConcurrency int
+
+	// RefsUpdateState persists the progress of the refreshes of the refs, nil
+	// when they are only held in memory
+	RefsUpdateState *RefsUpdateStateFile
+
+	// APIToken is expected as a bearer token by the API endpoints, they are
+	// disabled when it is empty
+	APIToken string
+
+	// InteractionTimeout bounds the background jobs of the interactions, they
+	// are only bound to the lifetime of the process when 0
+	InteractionTimeout time.Duration
+
+	// SlackUsersLookup configures the lookup of the commit authors whose email
+	// addresses are not part of the cached Slack users mapping
+	SlackUsersLookup config.CacheSlackLookupUsersByEmail
 }
 
 // New creates a new controller
 func New(ctx context.Context, cfg config.Config) (c Controller, err error) {
 	c.Context = ctx
-	c.Slack = slack.New(cfg.Slack, cfg.Users)
+	c.Channels = cfg.Channels
+	c.SlackUsersLookup = cfg.Cache.Slack.LookupUsersByEmail
+	c.APIToken = cfg.API.Token
+	c.InteractionTimeout = time.Duration(cfg.Timeouts.InteractionSeconds) * time.Second
+	if c.Slack, err = slack.New(cfg.Slack, cfg.Users); err != nil {
+		return
+	}
+	c.AccessRules = NewAccessRules(cfg.AccessRules)
 	c.Store = &store.Store{}
-	c.TaskController = NewTaskController()
+	c.Store.SetComparisonsCacheLimits(cfg.Cache.Comparisons.MaxEntries, cfg.Cache.Comparisons.MaxSizeMB*1024*1024)
+	c.Store.SetSlackUserLookupsLimit(cfg.Cache.Slack.LookupUsersByEmail.MaxEntries)
+	if c.Audit, err = audit.NewLogger(cfg.Audit, c.Store); err != nil {
+		return
+	}
+
+	c.RefsUpdateConcurrency = cfg.Cache.Providers.UpdateRepositoriesRefs.Concurrency
+	c.RefsUpdateState = NewRefsUpdateStateFile(cfg.Cache.Providers.UpdateRepositoriesRefs.StateFile)
+	var refsUpdateState store.RefsUpdateState
+	if refsUpdateState, err = c.RefsUpdateState.Load(); err != nil {
+		return
+	}
+	c.Store.RestoreRefsUpdateState(refsUpdateState)
+	c.TaskController = NewTaskController(c.RefsUpdateConcurrency)
+
+	err = c.configureProviders(cfg.Providers, cfg.RateLimits, time.Duration(cfg.Timeouts.ProviderCallSeconds)*time.Second)
+	if err != nil {
+		return
+	}
 
-	err = c.configureProviders(cfg.Providers)
+	err = c.configureIssueTrackers(cfg.IssueTrackers)
 	if err != nil {
 		return
 	}
@@ -57,13 +112,21 @@ func New(ctx context.Context, cfg config.Config) (c Controller, err error) {
 		Handler: c.TaskHandlerSlackUsersEmailsUpdate,
 	})
 
+	_, _ = c.TaskController.TaskMap.Register(&taskq.TaskOptions{
+		Name:    string(TaskTypeWatchCompare),
+		Handler: c.TaskHandlerWatchCompare,
+	})
+
 	// cache updates
 	c.scheduleCacheUpdateTasks(cfg.Cache)
 
+	// watches
+	err = c.scheduleWatches(cfg.Watches)
+
 	return
 }
 
-func (c *Controller) configureProviders(cfg config.Providers) error {
+func (c *Controller) configureProviders(cfg config.Providers, rlCfg config.RateLimits, timeout time.Duration) error {
 	c.Providers = make(providers.Providers)
 
 	if len(cfg) == 0 {
@@ -80,11 +143,18 @@ func (c *Controller) configureProviders(cfg config.Providers) error {
 			return err
 		}
 
+		rl := providers.NewRateLimiter(
+			rlCfg.ReservePercent,
+			rlCfg.MaxRetries,
+			time.Duration(rlCfg.MaxRetryWaitSeconds)*time.Second,
+			http.DefaultTransport,
+		)
+
 		switch pt {
 		case providers.ProviderTypeGitHub:
-			c.Providers[pt], err = github.NewProvider(c.Context, p.Token, p.URL, p.Owners)
+			c.Providers[pt], err = github.NewProvider(c.Context, p.Token, p.URL, p.Owners, rl, timeout)
 		case providers.ProviderTypeGitLab:
-			c.Providers[pt], err = gitlab.NewProvider(p.Token, p.URL, p.Owners)
+			c.Providers[pt], err = gitlab.NewProvider(p.Token, p.URL, p.Owners, rl, timeout)
 		}
 
 		if err != nil {
@@ -100,15 +170,57 @@ func (c *Controller) configureProviders(cfg config.Providers) error {
 	return nil
 }
 
+func (c *Controller) configureIssueTrackers(cfg config.IssueTrackers) error {
+	c.IssueTrackers = make(map[providers.ProviderType]providers.IssueTrackers)
+
+	for _, it := range cfg {
+		for pt, p := range c.Providers {
+			switch it.Type {
+			case "jira":
+				c.IssueTrackers[pt] = append(c.IssueTrackers[pt], providers.NewJiraIssueTracker(it.URL, it.Projects))
+			case "provider":
+				c.IssueTrackers[pt] = append(c.IssueTrackers[pt], providers.NewProviderIssueTrackers(pt, p.WebBaseURL())...)
+			case "custom":
+				tracker, err := providers.NewIssueTracker(it.Pattern, it.URL)
+				if err != nil {
+					return err
+				}
+				c.IssueTrackers[pt] = append(c.IssueTrackers[pt], tracker)
+			default:
+				return fmt.Errorf("invalid issue tracker type '%s'", it.Type)
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"type": it.Type,
+			"url":  it.URL,
+		}).Debug("configured issue tracker")
+	}
+
+	return nil
+}
+
+// interactionContext returns the context the background job of an interaction
+// is bound to, it has to be cancelled once the job is done
+func (c Controller) interactionContext() (context.Context, context.CancelFunc) {
+	if c.InteractionTimeout <= 0 {
+		return context.WithCancel(c.Context)
+	}
+	return context.WithTimeout(c.Context, c.InteractionTimeout)
+}
+
 // ScheduleTask ..
 func (c Controller) ScheduleTask(tt TaskType, args ...interface{}) {
-	task := c.TaskController.TaskMap.Get(string(tt))
-	msg := task.WithArgs(c.Context, args...)
-	if err := c.TaskController.Queue.Add(msg); err != nil {
+	if err := c.scheduleTask(tt, args...); err != nil {
 		log.WithError(err).Warning("scheduling task")
 	}
 }
 
+func (c Controller) scheduleTask(tt TaskType, args ...interface{}) error {
+	task := c.TaskController.TaskMap.Get(string(tt))
+	return c.TaskController.Queue.Add(task.WithArgs(c.Context, args...))
+}
+
 func (c Controller) scheduleCacheUpdateTasks(cfg config.Cache) {
 	// Initialize local cache
 	go func() {
@@ -122,7 +234,8 @@ func (c Controller) scheduleCacheUpdateTasks(cfg config.Cache) {
 			c.ScheduleTask(TaskTypeRepositoriesUpdate, &wg)
 		}
 
-		if cfg.Providers.UpdateRepositoriesRefs.OnStart {
+		// Resume the run a previous process got interrupted in the middle of
+		if cfg.Providers.UpdateRepositoriesRefs.OnStart || len(c.Store.GetRefsUpdateRun().Pending) > 0 {
 			wg.Wait()
 			c.ScheduleTask(TaskTypeRepositoriesRefsUpdate)
 		}
@@ -164,3 +277,38 @@ func (c Controller) scheduleCacheUpdateTaskWithTicker(tt TaskType, interval int)
 		}
 	}(c.Context)
 }
+
+func (c *Controller) scheduleWatches(watches config.Watches) error {
+	c.Watches = watches
+	c.WatchDigests = groupWatches(watches)
+	c.Cron = cron.New()
+
+	for id, d := range c.WatchDigests {
+		digestID := id
+		if _, err := c.Cron.AddFunc(d.Schedule, func() {
+			c.ScheduleTask(TaskTypeWatchCompare, digestID)
+		}); err != nil {
+			return fmt.Errorf("invalid schedule '%s' for watch on '%s': %v", d.Schedule, watches[d.WatchIDs[0]].Repository, err)
+		}
+
+		for _, watchID := range d.WatchIDs {
+			w := watches[watchID]
+			log.WithFields(log.Fields{
+				"repository": w.Repository,
+				"from_ref":   w.FromRef,
+				"to_ref":     w.ToRef,
+				"schedule":   w.Schedule,
+				"channel":    w.Channel,
+			}).Info("watch scheduled")
+		}
+	}
+
+	c.Cron.Start()
+	go func(ctx context.Context) {
+		<-ctx.Done()
+		c.Cron.Stop()
+		log.Info("scheduling of watches stopped")
+	}(c.Context)
+
+	return nil
+}
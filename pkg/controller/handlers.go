@@ -1,17 +1,25 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
 
 	log "github.com/sirupsen/logrus"
 	goSlack "github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
 )
 
 // SlashHandler handles slash command payloads
@@ -32,59 +40,35 @@ func (c Controller) SlashHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch cmd.Command {
 	case "/compare":
-		opts := slack.ModalRequestOptions{
-			ConversationID:         cmd.ChannelID,
-			LastRepositoriesUpdate: c.Store.GetRepositoriesLastUpdate(),
-		}
-
-		if len(c.Store.GetRepositories()) == 0 ||
-			opts.LastRepositoriesUpdate.IsZero() {
-			opts.CurrentlyUpdatingRepositories = true
-		} else {
-			params := strings.Split(cmd.Text, " ")
-			if length := len(params); length > 0 {
-				opts.Repository = c.Store.GetRepositories().GetByClosestNameMatch(params[0])
-				if !opts.Repository.IsEmpty() {
-					// Check if it could be worth to trigger an update of the repository's refs
-					if opts.Repository.RefsLastUpdate.IsZero() ||
-						len(opts.Repository.Refs) == 0 {
-						opts.CurrentlyUpdatingRepositoryRefs = true
-					}
-
-					if len(opts.Repository.Refs) > 0 && length > 1 {
-						opts.FromRef = opts.Repository.Refs.GetByClosestNameMatch(params[1])
-						if length > 2 {
-							opts.ToRef = opts.Repository.Refs.GetByClosestNameMatch(params[2])
-							if !opts.FromRef.IsEmpty() && !opts.ToRef.IsEmpty() {
-								opts.Comparison, err = c.Providers[opts.Repository.ProviderType].Compare(opts.Repository.Name, opts.FromRef, opts.ToRef)
-								if err != nil {
-									log.WithError(err).Error()
-									w.WriteHeader(http.StatusInternalServerError)
-									return
-								}
-								opts.Comparison.HydrateCommitsAuthorsWithSlackUserID(c.Store.GetSlackUsersEmails())
-							}
-						}
-					}
-				}
-			}
-		}
-
-		// Generate and submit the request to open the modal
-		resp, err := c.Slack.Client.OpenView(
-			cmd.TriggerID,
-			slack.GetModalRequest(opts),
-		)
+		command, err := slack.ParseCommand(cmd.Text)
 		if err != nil {
-			log.WithError(fmt.Errorf("opening view: %s -> %v", err.Error(), resp.ResponseMetadata)).Error()
+			respondEphemeral(w, err.Error())
 			return
 		}
 
-		c.handleRequiredDataFetchesAndUpdateModalAfterCompletion(resp.ID, resp.Hash, opts)
+		switch command.Type {
+		case slack.CommandTypeHelp:
+			respondEphemeral(w, slack.CommandHelp())
+		case slack.CommandTypeRefresh:
+			c.handleRefreshCommand(w, cmd, command)
+		case slack.CommandTypeWatch:
+			c.handleWatchCommand(w, cmd.ChannelID, command)
+		case slack.CommandTypeBind, slack.CommandTypeUnbind:
+			c.handleBindCommand(w, cmd, command)
+		case slack.CommandTypeLast:
+			c.handleLastCommand(w, cmd, command)
+		case slack.CommandTypePrefer:
+			c.handlePreferCommand(w, cmd.UserID, command)
+		case slack.CommandTypeHistory:
+			c.handleHistoryCommand(w, cmd, command)
+		case slack.CommandTypeFavorites:
+			c.handleFavoritesCommand(w, cmd)
+		default:
+			c.handleCompareCommand(w, cmd, command)
+		}
 	default:
-		log.WithError(fmt.Errorf("unhandled command '%s'", cmd.Command)).Error()
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		log.WithField("command", cmd.Command).Warning("unhandled command")
+		respondEphemeral(w, fmt.Sprintf(":warning: unsupported command '%s'", cmd.Command))
 	}
 }
 
@@ -105,6 +89,28 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if i.View.Type == goSlack.VTHomeTab {
+		c.handleHomeTabActions(w, i)
+		return
+	}
+
+	if i.Type == goSlack.InteractionTypeBlockActions && i.Container.Type == "message" {
+		c.handleMessageActions(w, i)
+		return
+	}
+
+	if i.Type == goSlack.InteractionTypeMessageAction {
+		switch i.CallbackID {
+		case "compare_in_thread":
+			c.openMessageShortcutModal(i, false)
+		case "compare_from_message":
+			c.openMessageShortcutModal(i, true)
+		default:
+			log.WithField("callback_id", i.CallbackID).Warning("unsupported message shortcut")
+		}
+		return
+	}
+
 	// If no state values are being passed, it means it has probably be a link being clicked
 	// We simply ignore the call.
 	if i.View.State != nil {
@@ -118,8 +124,10 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := slack.ModalRequestOptions{
-		ConversationID:         i.View.CallbackID,
-		LastRepositoriesUpdate: c.Store.GetRepositoriesLastUpdate(),
+		ConversationID:           i.View.CallbackID,
+		ThreadTS:                 i.View.PrivateMetadata,
+		LastRepositoriesUpdate:   c.Store.GetRepositoriesLastUpdate(),
+		StaleRepositoriesSources: c.Store.GetStaleRepositoriesSources(),
 	}
 
 	if len(c.Store.GetRepositories()) == 0 ||
@@ -136,9 +144,21 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if err = c.checkRepositoryAccess(i.User.ID, opts.ConversationID, opts.Repository); err != nil {
+				if i.Type == goSlack.InteractionTypeViewSubmission {
+					respondViewSubmissionErrors(w, map[string]string{
+						"repositories": "You are not allowed to compare this repository from here",
+					})
+					return
+				}
+
+				c.respondAccessDenied(opts.ConversationID, i.User.ID, err)
+				opts.Repository = providers.Repository{}
+			}
+
 			// Check if it could be worth to trigger an update of the repository's refs
-			if opts.Repository.RefsLastUpdate.IsZero() ||
-				len(opts.Repository.Refs) == 0 {
+			if !opts.Repository.IsEmpty() &&
+				(opts.Repository.RefsLastUpdate.IsZero() || len(opts.Repository.Refs) == 0) {
 				opts.CurrentlyUpdatingRepositoryRefs = true
 			}
 		}
@@ -155,18 +175,11 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 			// TODO: If last updated is quite old and ref is not found, trigger an update of the refs
 		}
 
-		if !opts.Repository.IsEmpty() &&
+		// Slack expects the interaction to be acknowledged within 3 seconds,
+		// the comparison gets computed in the background
+		opts.CurrentlyComparing = !opts.Repository.IsEmpty() &&
 			!opts.FromRef.IsEmpty() &&
-			!opts.ToRef.IsEmpty() {
-			log.Debug("comparing refs")
-			opts.Comparison, err = c.Providers[opts.Repository.ProviderType].Compare(opts.Repository.Name, opts.FromRef, opts.ToRef)
-			if err != nil {
-				log.WithError(err).Error()
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			opts.Comparison.HydrateCommitsAuthorsWithSlackUserID(c.Store.GetSlackUsersEmails())
-		}
+			!opts.ToRef.IsEmpty()
 	}
 
 	for _, a := range i.ActionCallback.BlockActions {
@@ -175,6 +188,7 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 			case "update_repositories":
 				log.Info("triggered an update of the repositories list")
 				opts.CurrentlyUpdatingRepositories = true
+				opts.CurrentlyComparing = false
 			case "update_refs":
 				log.WithField("repository_key", a.Value).Info("triggered an update of the refs list")
 				var found bool
@@ -185,6 +199,7 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 				opts.CurrentlyUpdatingRepositoryRefs = true
+				opts.CurrentlyComparing = false
 			}
 		}
 	}
@@ -192,11 +207,11 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 	// We only want to update the view when we change the repository select
 	switch i.Type {
 	case goSlack.InteractionTypeBlockActions:
-		resp, err := c.Slack.Client.UpdateView(slack.GetModalRequest(opts), "", i.View.Hash, i.View.ID)
+		resp, err := c.Slack.Client.UpdateView(c.Slack.GetModalRequest(opts), "", i.View.Hash, i.View.ID)
 		if err != nil {
 			log.WithError(fmt.Errorf("updating view: %s -> %v", err.Error(), resp.ResponseMetadata)).Error()
 		}
-		c.handleRequiredDataFetchesAndUpdateModalAfterCompletion(resp.ID, resp.Hash, opts)
+		c.handleRequiredDataFetchesAndUpdateModalAfterCompletion(resp.ID, resp.Hash, i.User.ID, audit.SourceModal, opts)
 	case goSlack.InteractionTypeViewSubmission:
 		errors := map[string]string{}
 
@@ -208,40 +223,87 @@ func (c Controller) ModalHandler(w http.ResponseWriter, r *http.Request) {
 			if opts.FromRef.IsEmpty() {
 				errors["from_ref"] = "Please select a base ref"
 			}
-			if opts.FromRef.IsEmpty() {
+			if opts.ToRef.IsEmpty() {
 				errors["to_ref"] = "Please select a head ref"
 			}
 		}
 
 		if len(errors) > 0 {
-			vsr := slack.ViewSubmissionResponse{
-				ResponseType: "errors",
-				Errors:       errors,
-			}
-
-			resp, _ := json.Marshal(vsr)
-			_, _ = w.Write(resp)
+			respondViewSubmissionErrors(w, errors)
 			return
 		}
 
-		if opts.Comparison == nil {
-			log.Error("comparison was not available between the 2 provided refs")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		var preview bool
+		for _, o := range i.View.State.Values["options"]["preview"].SelectedOptions {
+			preview = preview || o.Value == "preview"
 		}
 
-		if _, _, err := c.Slack.Client.PostMessage(i.View.CallbackID, goSlack.MsgOptionBlocks(slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, i.User.ID).BlockSet...)); err != nil {
+		// The modal gets closed straight away, the comparison is posted once
+		// computed in the background
+		go c.postComparison(i.User.ID, "", audit.SourceModal, preview, opts)
+	default:
+		log.Warningf("unsupported interaction type '%v'", i.Type)
+	}
+}
+
+// EventsHandler handles slack events API payloads
+func (c Controller) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	err := c.Slack.VerifySigningSecret(r)
+	if err != nil {
+		log.WithError(err).Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.WithError(err).Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		log.WithError(err).Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err = json.Unmarshal(body, &challenge); err != nil {
 			log.WithError(err).Error()
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		if _, err = w.Write([]byte(challenge.Challenge)); err != nil {
+			log.WithError(err).Error()
+		}
+	case slackevents.CallbackEvent:
+		switch ev := event.InnerEvent.Data.(type) {
+		case *slackevents.AppHomeOpenedEvent:
+			if ev.Tab == "home" {
+				c.publishHomeTab(ev.User)
+			}
+		default:
+			log.WithField("event_type", event.InnerEvent.Type).Debug("ignoring unsupported event")
+		}
 	default:
-		log.Warningf("unsupported interaction type '%v'", i.Type)
+		log.WithField("event_type", event.Type).Debug("ignoring unsupported event")
 	}
 }
 
 // SelectHandler handles slack selector payloads
 func (c Controller) SelectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := c.Slack.VerifySigningSecret(r); err != nil {
+		log.WithError(err).Error()
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	i := &goSlack.InteractionCallback{}
 	if err := json.Unmarshal([]byte(r.FormValue("payload")), i); err != nil {
 		log.WithError(err).Error()
@@ -265,7 +327,7 @@ func (c Controller) SelectHandler(w http.ResponseWriter, r *http.Request) {
 	resp := goSlack.OptionsResponse{}
 	switch actionID {
 	case "repository":
-		for _, r := range c.Store.GetRepositories().Search(i.Value, 20) {
+		for _, r := range c.searchChannelRepositories(i.User.ID, i.View.CallbackID, i.Value, 20) {
 			resp.Options = append(resp.Options, goSlack.NewOptionBlockObject(fmt.Sprintf("%d/%s", r.Rank, r.Key()), goSlack.NewTextBlockObject("plain_text", fmt.Sprintf(":%s: %s", r.ProviderType, r.Name), true, false), nil))
 		}
 	case "from_ref", "to_ref":
@@ -276,8 +338,14 @@ func (c Controller) SelectHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		for _, r := range repo.Refs.Search(i.Value, 20) {
-			resp.Options = append(resp.Options, goSlack.NewOptionBlockObject(fmt.Sprintf("%d/%s", r.Rank, r.Key()), goSlack.NewTextBlockObject("plain_text", fmt.Sprintf("%s/%s", r.Type, r.Name), true, false), nil))
+		// The refs of the repositories the user cannot compare are not disclosed either
+		if err := c.checkRepositoryAccess(i.User.ID, i.View.CallbackID, repo); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		for _, r := range repo.Refs.SearchWithUsage(i.Value, 20, c.Store.GetRefsUsage(i.User.ID, repoKey)) {
+			resp.Options = append(resp.Options, slack.NewRefOptionBlockObject(fmt.Sprintf("%d/%s", r.Rank, r.Key()), r.Ref))
 		}
 	default:
 		log.WithField("action_id", i.ActionID).Error("unsupported action_id")
@@ -290,6 +358,293 @@ func (c Controller) SelectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// compare calculates the diff between two refs of a repository and hydrates
+// the comparison with the slack users and issues references. The calls made to
+// the provider are aborted once the context is done. The commits are cached given
+// the SHAs the refs currently resolve to, and refs resolving to the same commit are
+// not compared at all. The CI statuses get fetched alongside
+func (c Controller) compare(ctx context.Context, repo providers.Repository, fromRef, toRef providers.Ref) (cmp *providers.Comparison, err error) {
+	p := c.Providers[repo.ProviderType]
+
+	key := store.ComparisonKey{
+		ProviderType: repo.ProviderType,
+		Repository:   repo.Name,
+		FromSHA:      resolveCommitSHA(ctx, p, repo.Name, fromRef),
+		ToSHA:        resolveCommitSHA(ctx, p, repo.Name, toRef),
+	}
+	cacheable := key.FromSHA != "" && key.ToSHA != ""
+
+	var fromStatus, toStatus providers.CommitStatus
+	statuses := sync.WaitGroup{}
+	statuses.Add(2)
+	go func() {
+		defer statuses.Done()
+		fromStatus = getCommitStatus(ctx, p, repo.Name, fromRef, key.FromSHA)
+	}()
+	go func() {
+		defer statuses.Done()
+		toStatus = getCommitStatus(ctx, p, repo.Name, toRef, key.ToSHA)
+	}()
+	defer statuses.Wait()
+
+	// The SHAs of the refs in the store may be outdated, hence relying on the resolved ones
+	resolvedFromRef, resolvedToRef := fromRef, toRef
+	resolvedFromRef.SHA, resolvedToRef.SHA = key.FromSHA, key.ToSHA
+
+	if commits, found := c.Store.GetComparison(key); resolvedFromRef.IsIdenticalTo(resolvedToRef) || (cacheable && found) {
+		log.WithFields(log.Fields{
+			"repository": repo.Name,
+			"from_sha":   key.FromSHA,
+			"to_sha":     key.ToSHA,
+		}).Debug("comparison resolved without calling the provider")
+
+		cmp = &providers.Comparison{
+			Commits: commits,
+			WebURL:  p.CompareWebURL(repo.Name, fromRef, toRef),
+		}
+	} else if cacheable {
+		// Comparing the resolved commits rather than the refs, which may have moved
+		// since, guarantees that the cached commits match the key
+		if cmp, err = p.CompareWithContext(ctx, repo.Name, commitRef(key.FromSHA), commitRef(key.ToSHA)); err != nil {
+			return
+		}
+
+		cmp.WebURL = p.CompareWebURL(repo.Name, fromRef, toRef)
+		c.Store.SetComparison(key, cmp.Commits)
+	} else if cmp, err = p.CompareWithContext(ctx, repo.Name, fromRef, toRef); err != nil {
+		return
+	}
+
+	statuses.Wait()
+	cmp.FromStatus = fromStatus
+	cmp.ToStatus = toStatus
+
+	cmp.HydrateCommitsCoAuthors()
+
+	mapping := c.Store.GetSlackUsersEmails()
+	var lookup providers.SlackUserIDLookup
+	if c.SlackUsersLookup.Enabled || c.SlackUsersLookup.ProviderProfiles {
+		slackUserIDs := c.lookupSlackUserIDs(ctx, repo.ProviderType, cmp.UnmappedAuthors(mapping))
+		lookup = func(author providers.Author) string {
+			return slackUserIDs[slackUserLookupKey(repo.ProviderType, author)]
+		}
+	}
+
+	cmp.HydrateCommitsAuthorsWithSlackUserID(mapping, lookup)
+	cmp.HydrateCommitsIssues(c.IssueTrackers[repo.ProviderType], repo)
+
+	return cmp, nil
+}
+
+// resolveCommitSHA returns the SHA of the commit a ref currently points to, or an
+// empty string if it could not be resolved. The SHAs of the refs in the store are
+// not relied upon as they may be outdated
+func resolveCommitSHA(ctx context.Context, p providers.Provider, project string, ref providers.Ref) string {
+	if ref.Type == providers.RefTypeCommit {
+		return ref.Name
+	}
+
+	sha, err := p.GetCommitSHAWithContext(ctx, project, ref)
+	if err != nil {
+		log.WithError(err).WithField("ref", ref.Name).Warning("resolving commit sha")
+		return ""
+	}
+	return sha
+}
+
+// getCommitStatus returns the CI status of the commit a ref resolved to, failing
+// to fetch it should not prevent the comparison from being rendered
+func getCommitStatus(ctx context.Context, p providers.Provider, project string, ref providers.Ref, sha string) providers.CommitStatus {
+	if sha != "" {
+		ref = commitRef(sha)
+	}
+
+	cs, err := p.GetCommitStatusWithContext(ctx, project, ref)
+	if err != nil {
+		log.WithError(err).WithField("ref", ref.Name).Warning("fetching commit status")
+	}
+
+	// The SHAs get referenced by the buttons of the posted comparisons
+	if cs.SHA == "" {
+		cs.SHA = sha
+	}
+	return cs
+}
+
+// commitRef returns a Ref pointing to a given commit
+func commitRef(sha string) providers.Ref {
+	return providers.Ref{
+		Name: sha,
+		Type: providers.RefTypeCommit,
+	}
+}
+
+// comparisonErrorMessage explains to the user why the comparison failed
+func comparisonErrorMessage(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "the provider took too long to respond, please try again later"
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return "the comparison got cancelled, please try again"
+	}
+
+	return fmt.Sprintf("the provider responded with an error: `%v`", err)
+}
+
+// respondComparisonError lets the user know that the comparison could not be
+// computed, through a message only visible to them
+func (c Controller) respondComparisonError(channelID, threadTS, userID, responseURL string, err error) {
+	blocks := goSlack.Blocks{
+		BlockSet: []goSlack.Block{
+			goSlack.NewSectionBlock(
+				goSlack.NewTextBlockObject(goSlack.MarkdownType, ":warning: *could not compare the refs*\n"+comparisonErrorMessage(err), false, false),
+				nil,
+				nil,
+			),
+		},
+	}
+
+	if err = c.sendMessage(channelID, threadTS, userID, responseURL, true, blocks); err != nil {
+		log.WithError(err).Error()
+	}
+}
+
+// lookupSlackUserIDs resolves the Slack users behind the commit authors, up to
+// SlackUsersLookup.Concurrency at once. The results are indexed by slackUserLookupKey
+func (c Controller) lookupSlackUserIDs(ctx context.Context, pt providers.ProviderType, authors providers.Authors) map[string]string {
+	slackUserIDs := make(map[string]string, len(authors))
+	mutex := sync.Mutex{}
+
+	concurrency := c.SlackUsersLookup.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for _, author := range authors {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(author providers.Author) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			slackUserID := c.lookupSlackUserID(ctx, pt, author)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			slackUserIDs[slackUserLookupKey(pt, author)] = slackUserID
+		}(author)
+	}
+
+	wg.Wait()
+	return slackUserIDs
+}
+
+// lookupSlackUserID resolves the Slack user behind a commit author through the
+// Slack API and the profile of the provider account it is attributed to. The
+// results are kept in the store
+func (c Controller) lookupSlackUserID(ctx context.Context, pt providers.ProviderType, author providers.Author) string {
+	if author.Email == "" && author.Login == "" {
+		return ""
+	}
+
+	key := slackUserLookupKey(pt, author)
+	if slackUserID, found := c.Store.GetSlackUserLookup(
+		key,
+		time.Duration(c.SlackUsersLookup.PositiveTTLSeconds)*time.Second,
+		time.Duration(c.SlackUsersLookup.NegativeTTLSeconds)*time.Second,
+	); found {
+		return slackUserID
+	}
+
+	var slackUserID string
+	var err error
+	if c.SlackUsersLookup.Enabled && author.Email != "" {
+		if slackUserID, err = c.Slack.LookupUserIDByEmail(author.Email); err != nil {
+			// Errors are not cached, we will try again next time
+			log.WithError(err).WithField("email", author.Email).Warning("looking up slack user by email")
+			return ""
+		}
+	}
+
+	if slackUserID == "" && c.SlackUsersLookup.ProviderProfiles {
+		var emails []string
+		if emails, err = c.Providers[pt].ListUserEmailsWithContext(ctx, author); err != nil {
+			log.WithError(err).WithField("email", author.Email).Warning("listing provider user emails")
+			return ""
+		}
+
+		mapping := c.Store.GetSlackUsersEmails()
+		for _, email := range emails {
+			if slackUserID = mapping[email]; slackUserID != "" {
+				break
+			}
+
+			if c.SlackUsersLookup.Enabled && email != author.Email {
+				if slackUserID, err = c.Slack.LookupUserIDByEmail(email); err != nil {
+					log.WithError(err).WithField("email", email).Warning("looking up slack user by email")
+					return ""
+				}
+
+				if slackUserID != "" {
+					break
+				}
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"email":         author.Email,
+		"login":         author.Login,
+		"slack_user_id": slackUserID,
+	}).Debug("looked up slack user")
+
+	c.Store.SetSlackUserLookup(key, slackUserID)
+	return slackUserID
+}
+
+// slackUserLookupKey identifies a commit author in the Slack user lookups: by its
+// email address or, when it has none, by its login on the provider
+func slackUserLookupKey(pt providers.ProviderType, author providers.Author) string {
+	if author.Email != "" {
+		return author.Email
+	}
+	return fmt.Sprintf("%s:%s", pt, author.Login)
+}
+
+// respondEphemeral replies to a slash command with a message which is only
+// visible to the user who invoked it
+func respondEphemeral(w http.ResponseWriter, text string) {
+	resp, _ := json.Marshal(goSlack.Msg{
+		ResponseType: goSlack.ResponseTypeEphemeral,
+		Text:         text,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		log.WithError(err).Error()
+	}
+}
+
+// respondViewSubmissionErrors rejects the submission of a modal, displaying the
+// errors next to the blocks they relate to
+func respondViewSubmissionErrors(w http.ResponseWriter, errors map[string]string) {
+	resp, _ := json.Marshal(slack.ViewSubmissionResponse{
+		ResponseType: "errors",
+		Errors:       errors,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		log.WithError(err).Error()
+	}
+}
+
 func stripRankFromValue(value string) string {
 	values := strings.Split(value, "/")
 	if len(values) != 2 {
@@ -298,7 +653,10 @@ func stripRankFromValue(value string) string {
 	return values[1]
 }
 
-func (c Controller) handleRequiredDataFetchesAndUpdateModalAfterCompletion(viewID, viewHash string, opts slack.ModalRequestOptions) {
+// handleRequiredDataFetchesAndUpdateModalAfterCompletion fetches the data the
+// modal is waiting for in the background and updates it once available. The
+// comparisons get audited for the user and source
+func (c Controller) handleRequiredDataFetchesAndUpdateModalAfterCompletion(viewID, viewHash, userID, source string, opts slack.ModalRequestOptions) {
 	if opts.CurrentlyUpdatingRepositories {
 		go func() {
 			wg := sync.WaitGroup{}
@@ -308,7 +666,8 @@ func (c Controller) handleRequiredDataFetchesAndUpdateModalAfterCompletion(viewI
 
 			opts.CurrentlyUpdatingRepositories = false
 			opts.LastRepositoriesUpdate = c.Store.GetRepositoriesLastUpdate()
-			r, err := c.Slack.Client.UpdateView(slack.GetModalRequest(opts), "", viewHash, viewID)
+			opts.StaleRepositoriesSources = c.Store.GetStaleRepositoriesSources()
+			r, err := c.Slack.Client.UpdateView(c.Slack.GetModalRequest(opts), "", viewHash, viewID)
 			if err != nil {
 				log.WithError(fmt.Errorf("updating view: %s -> %v", err.Error(), r.ResponseMetadata)).Error()
 			}
@@ -324,7 +683,29 @@ func (c Controller) handleRequiredDataFetchesAndUpdateModalAfterCompletion(viewI
 
 			opts.CurrentlyUpdatingRepositoryRefs = false
 			opts.Repository, _ = c.Store.GetRepository(opts.Repository.Key())
-			r, err := c.Slack.Client.UpdateView(slack.GetModalRequest(opts), "", viewHash, viewID)
+			r, err := c.Slack.Client.UpdateView(c.Slack.GetModalRequest(opts), "", viewHash, viewID)
+			if err != nil {
+				log.WithError(fmt.Errorf("updating view: %s -> %v", err.Error(), r.ResponseMetadata)).Error()
+			}
+		}()
+	}
+
+	if opts.CurrentlyComparing {
+		go func() {
+			opts.CurrentlyComparing = false
+
+			ctx, cancel := c.interactionContext()
+			defer cancel()
+
+			var err error
+			if opts.Comparison, err = c.compare(ctx, opts.Repository, opts.FromRef, opts.ToRef); err != nil {
+				log.WithError(err).Warning("comparing refs")
+				opts.ComparisonError = comparisonErrorMessage(err)
+			} else {
+				c.auditComparison(source, userID, opts.ConversationID, opts, false)
+			}
+
+			r, err := c.Slack.Client.UpdateView(c.Slack.GetModalRequest(opts), "", viewHash, viewID)
 			if err != nil {
 				log.WithError(fmt.Errorf("updating view: %s -> %v", err.Error(), r.ResponseMetadata)).Error()
 			}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type comparingProvider struct {
+	providers.Provider
+	shas            map[string]string
+	failingStatuses map[string]bool
+	compares        *int
+}
+
+func (p comparingProvider) GetCommitSHAWithContext(_ context.Context, _ string, ref providers.Ref) (string, error) {
+	if sha, found := p.shas[ref.Name]; found {
+		return sha, nil
+	}
+	return "", fmt.Errorf("404 Not Found")
+}
+
+func (p comparingProvider) GetCommitStatusWithContext(_ context.Context, _ string, ref providers.Ref) (providers.CommitStatus, error) {
+	if ref.Type != providers.RefTypeCommit {
+		return providers.CommitStatus{}, fmt.Errorf("statuses are only fetched for the resolved commits")
+	}
+
+	if p.failingStatuses[ref.Name] {
+		return providers.CommitStatus{}, fmt.Errorf("500 Internal Server Error")
+	}
+	return providers.CommitStatus{SHA: ref.Name, State: providers.CommitStatusStateSuccess}, nil
+}
+
+func (p comparingProvider) CompareWithContext(_ context.Context, _ string, _, toRef providers.Ref) (*providers.Comparison, error) {
+	*p.compares++
+
+	// The refs keep moving, only the commits are stable
+	id := "moved"
+	if toRef.Type == providers.RefTypeCommit {
+		id = toRef.Name
+	}
+
+	return &providers.Comparison{
+		Commits: providers.Commits{{ID: id, Message: "fix: foo\n\nCo-authored-by: Bob <bob@example.com>"}},
+		WebURL:  "http://foo",
+	}, nil
+}
+
+func (p comparingProvider) CompareWebURL(_ string, fromRef, toRef providers.Ref) string {
+	return fmt.Sprintf("http://foo/%s...%s", fromRef.Name, toRef.Name)
+}
+
+func TestCompareCache(t *testing.T) {
+	var compares int
+	p := comparingProvider{
+		shas: map[string]string{
+			"production": "aaa",
+			"main":       "bbb",
+			"v1.0.0":     "aaa",
+			"develop":    "ccc",
+		},
+		failingStatuses: map[string]bool{"ccc": true},
+		compares:        &compares,
+	}
+
+	c := Controller{
+		Store:     &store.Store{},
+		Providers: providers.Providers{providers.ProviderTypeGitHub: p},
+	}
+	c.Store.SetComparisonsCacheLimits(10, 1<<20)
+
+	repo := providers.Repository{ProviderType: providers.ProviderTypeGitHub, Name: "foo/bar"}
+	cmp, err := c.compare(context.Background(), repo, providers.Ref{Name: "production"}, providers.Ref{Name: "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, compares)
+	assert.Equal(t, "aaa", cmp.FromStatus.SHA)
+	assert.Equal(t, providers.CommitStatusStateSuccess, cmp.FromStatus.State)
+	assert.Equal(t, "http://foo/production...main", cmp.WebURL)
+	assert.Len(t, cmp.Commits[0].CoAuthors, 1)
+
+	// The resolved commits got compared instead of the refs
+	assert.Equal(t, "bbb", cmp.Commits[0].ID)
+
+	// Refs resolving to the same commits are served from the cache
+	cmp, err = c.compare(context.Background(), repo, providers.Ref{Name: "v1.0.0"}, providers.Ref{Name: "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, compares)
+	assert.Equal(t, "http://foo/v1.0.0...main", cmp.WebURL)
+	assert.Equal(t, "bbb", cmp.ToStatus.SHA)
+	assert.Len(t, cmp.Commits[0].CoAuthors, 1)
+
+	// Refs resolving to the same commit are not compared
+	cmp, err = c.compare(context.Background(), repo, providers.Ref{Name: "production"}, providers.Ref{Name: "v1.0.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, compares)
+	assert.Empty(t, cmp.Commits)
+
+	// Failing to fetch the statuses does not prevent the comparison from being cached
+	cmp, err = c.compare(context.Background(), repo, providers.Ref{Name: "production"}, providers.Ref{Name: "develop"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, compares)
+	assert.Equal(t, "ccc", cmp.ToStatus.SHA)
+	assert.True(t, cmp.ToStatus.IsEmpty())
+	entries, _ := c.Store.GetComparisonsCacheUsage()
+	assert.Equal(t, 2, entries)
+
+	// Unless the refs cannot be resolved, nothing gets cached then
+	cmp, err = c.compare(context.Background(), repo, providers.Ref{Name: "unknown"}, providers.Ref{Name: "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, compares)
+	assert.Equal(t, "moved", cmp.Commits[0].ID)
+	entries, _ = c.Store.GetComparisonsCacheUsage()
+	assert.Equal(t, 2, entries)
+}
+
+func TestComparisonErrorMessage(t *testing.T) {
+	assert.Equal(t, "the provider took too long to respond, please try again later", comparisonErrorMessage(fmt.Errorf("comparing: %w", context.DeadlineExceeded)))
+	assert.Equal(t, "the comparison got cancelled, please try again", comparisonErrorMessage(context.Canceled))
+	assert.Equal(t, "the provider responded with an error: `404 Not Found`", comparisonErrorMessage(fmt.Errorf("404 Not Found")))
+}
+
+func TestSlackUserLookupKey(t *testing.T) {
+	assert.Equal(t, "alice@foo.baz", slackUserLookupKey(providers.ProviderTypeGitHub, providers.Author{Email: "alice@foo.baz", Login: "alice"}))
+	assert.Equal(t, "github:alice", slackUserLookupKey(providers.ProviderTypeGitHub, providers.Author{Login: "alice"}))
+	assert.Equal(t, "gitlab:alice", slackUserLookupKey(providers.ProviderTypeGitLab, providers.Author{Login: "alice"}))
+}
+
+type lookingUpProvider struct {
+	providers.Provider
+	running    *int32
+	maxRunning *int32
+}
+
+func (p lookingUpProvider) ListUserEmailsWithContext(_ context.Context, author providers.Author) ([]string, error) {
+	running := atomic.AddInt32(p.running, 1)
+	defer atomic.AddInt32(p.running, -1)
+
+	for {
+		maxRunning := atomic.LoadInt32(p.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(p.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	return []string{author.Login + "@foo.baz"}, nil
+}
+
+func TestLookupSlackUserIDs(t *testing.T) {
+	var running, maxRunning int32
+	c := Controller{
+		Store:     &store.Store{},
+		Providers: providers.Providers{providers.ProviderTypeGitHub: lookingUpProvider{running: &running, maxRunning: &maxRunning}},
+		SlackUsersLookup: config.CacheSlackLookupUsersByEmail{
+			ProviderProfiles:   true,
+			PositiveTTLSeconds: 3600,
+			NegativeTTLSeconds: 3600,
+			Concurrency:        2,
+		},
+	}
+	c.Store.UpdateSlackUsersEmails(map[string]string{"alice@foo.baz": "U1", "bob@foo.baz": "U2"})
+
+	slackUserIDs := c.lookupSlackUserIDs(context.Background(), providers.ProviderTypeGitHub, providers.Authors{
+		{Login: "alice"},
+		{Login: "bob"},
+		{Login: "carol"},
+		{Email: "dave@users.noreply.github.com", Login: "dave"},
+	})
+
+	assert.Equal(t, map[string]string{
+		"github:alice":                  "U1",
+		"github:bob":                    "U2",
+		"github:carol":                  "",
+		"dave@users.noreply.github.com": "",
+	}, slackUserIDs)
+	assert.Equal(t, int32(2), maxRunning)
+
+	// The results got stored
+	slackUserID, found := c.Store.GetSlackUserLookup("github:bob", time.Hour, time.Hour)
+	assert.True(t, found)
+	assert.Equal(t, "U2", slackUserID)
+}
+
+// newSignedSlackRequest returns a request to the handlers, signed as Slack does
+func newSignedSlackRequest(signingSecret string, form url.Values) *http.Request {
+	body := form.Encode()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	_, _ = mac.Write([]byte("v0:" + ts + ":" + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/slack/select", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestSelectHandler(t *testing.T) {
+	c := newTestControllerWithRepositories("secret/api", "public/docs")
+	c.Slack.SigningSecret = "secret"
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Repositories: []string{"public/*"}},
+	})
+
+	secret := providers.Repository{Name: "secret/api", ProviderType: providers.ProviderTypeGitHub}
+	payload := func(actionID string) url.Values {
+		return url.Values{"payload": []string{fmt.Sprintf(`{"type":"block_suggestion","action_id":%q,"value":"","user":{"id":"U1"},"view":{"callback_id":"C1"}}`, actionID)}}
+	}
+
+	// Forged requests are rejected
+	w := httptest.NewRecorder()
+	r := newSignedSlackRequest("forged", payload("repository"))
+	c.SelectHandler(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	c.SelectHandler(w, newSignedSlackRequest("secret", payload("repository")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "public/docs")
+	assert.NotContains(t, w.Body.String(), "secret/api")
+
+	// As are the searches of the refs of the repositories which are not allowed
+	w = httptest.NewRecorder()
+	c.SelectHandler(w, newSignedSlackRequest("secret", payload("from_ref/"+string(secret.Key()))))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestInteractionContext(t *testing.T) {
+	c := Controller{Context: context.Background(), InteractionTimeout: time.Minute}
+	ctx, cancel := c.interactionContext()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	cancel()
+	assert.Error(t, ctx.Err())
+
+	// Only bound to the lifetime of the process
+	parent, stop := context.WithCancel(context.Background())
+	c = Controller{Context: parent}
+	ctx, cancel = c.interactionContext()
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+
+	stop()
+	assert.Error(t, ctx.Err())
+}
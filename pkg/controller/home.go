@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// publishHomeTab renders and publishes the App Home tab of a given user
+func (c Controller) publishHomeTab(userID string) {
+	opts := slack.HomeTabOptions{
+		Favorites:        c.getHomeTabComparisons(c.Store.GetUserFavorites(userID)),
+		ChannelFavorites: c.getHomeTabChannelFavorites(userID),
+		Recent:           c.getHomeTabComparisons(c.Store.GetUserComparisons(userID)),
+	}
+
+	resp, err := c.Slack.Client.PublishView(userID, slack.GetHomeTabRequest(opts), "")
+	if err != nil {
+		var metadata goSlack.ResponseMetadata
+		if resp != nil {
+			metadata = resp.ResponseMetadata
+		}
+		log.WithError(fmt.Errorf("publishing home tab: %s -> %v", err.Error(), metadata)).Error()
+	}
+}
+
+// getHomeTabComparisons resolves the repositories and refs of the given
+// UserComparisons, omitting the ones which cannot be found in the store anymore
+func (c Controller) getHomeTabComparisons(ucs store.UserComparisons) (hcs []slack.HomeTabComparison) {
+	for _, uc := range ucs {
+		repo, fromRef, toRef, found := c.resolveUserComparison(uc)
+		if !found {
+			continue
+		}
+
+		hcs = append(hcs, slack.HomeTabComparison{
+			Key:        uc.KeyWithChannel(),
+			Repository: repo,
+			FromRef:    fromRef,
+			ToRef:      toRef,
+			ComparedAt: uc.ComparedAt,
+			ChannelID:  uc.ChannelID,
+		})
+	}
+	return
+}
+
+// getHomeTabChannelFavorites returns the favorites pinned in the channels the
+// user compared from, which the user is allowed to compare from them
+func (c Controller) getHomeTabChannelFavorites(userID string) (hcs []slack.HomeTabComparison) {
+	seen := make(map[string]bool)
+	for _, uc := range append(c.Store.GetUserComparisons(userID), c.Store.GetUserFavorites(userID)...) {
+		if !slack.IsChannelID(uc.ChannelID) || seen[uc.ChannelID] {
+			continue
+		}
+		seen[uc.ChannelID] = true
+
+		for _, hc := range c.getHomeTabComparisons(c.Store.GetChannelFavorites(uc.ChannelID)) {
+			if c.isRepositoryAllowed(userID, hc.ChannelID, hc.Repository) {
+				hcs = append(hcs, hc)
+			}
+		}
+	}
+	return
+}
+
+// resolveUserComparison returns the Repository and Refs referenced by a UserComparison
+func (c Controller) resolveUserComparison(uc store.UserComparison) (repo providers.Repository, fromRef, toRef providers.Ref, found bool) {
+	if repo, found = c.Store.GetRepository(uc.RepositoryKey); !found {
+		return
+	}
+
+	if fromRef, found = repo.Refs.GetByKey(uc.FromRefKey); !found {
+		return
+	}
+
+	toRef, found = repo.Refs.GetByKey(uc.ToRefKey)
+	return
+}
+
+// handleHomeTabActions handles the interactions with the buttons of the App Home tab
+func (c Controller) handleHomeTabActions(w http.ResponseWriter, i goSlack.InteractionCallback) {
+	for _, a := range i.ActionCallback.BlockActions {
+		if a == nil {
+			continue
+		}
+
+		uc, ok := store.ParseUserComparisonKey(a.Value)
+		if !ok {
+			log.WithField("value", a.Value).WithError(fmt.Errorf("invalid comparison key")).Error()
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch a.ActionID {
+		case "home_compare":
+			opts := slack.ModalRequestOptions{
+				// The comparison gets posted in the channel it got requested from or
+				// pinned in, or in the App DM if unknown
+				ConversationID:           uc.ChannelID,
+				LastRepositoriesUpdate:   c.Store.GetRepositoriesLastUpdate(),
+				StaleRepositoriesSources: c.Store.GetStaleRepositoriesSources(),
+			}
+			if opts.ConversationID == "" {
+				opts.ConversationID = i.User.ID
+			}
+
+			var found bool
+			opts.Repository, opts.FromRef, opts.ToRef, found = c.resolveUserComparison(uc)
+			if !found {
+				log.WithField("comparison_key", a.Value).WithError(fmt.Errorf("comparison not found")).Error()
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			err := c.checkRepositoryAccess(i.User.ID, opts.ConversationID, opts.Repository)
+			if err != nil {
+				c.respondAccessDenied(i.User.ID, i.User.ID, err)
+				return
+			}
+
+			// The comparison gets computed in the background
+			opts.CurrentlyComparing = true
+			c.openModal(i.TriggerID, i.User.ID, audit.SourceHomeTab, opts)
+		case "home_pin":
+			c.Store.PinUserFavorite(i.User.ID, uc)
+			c.publishHomeTab(i.User.ID)
+		case "home_unpin":
+			c.Store.UnpinUserFavorite(i.User.ID, uc)
+			c.publishHomeTab(i.User.ID)
+		case "home_pin_channel", "home_unpin_channel":
+			if err := c.checkChannelFavoriteAccess(i.User.ID, uc); err != nil {
+				c.respondAccessDenied(i.User.ID, i.User.ID, err)
+				return
+			}
+
+			if a.ActionID == "home_pin_channel" {
+				c.Store.PinChannelFavorite(uc.ChannelID, uc)
+			} else {
+				c.Store.UnpinChannelFavorite(uc.ChannelID, uc)
+			}
+			c.publishHomeTab(i.User.ID)
+		default:
+			log.WithField("action_id", a.ActionID).Warning("unsupported home tab action")
+		}
+	}
+}
+
+// checkChannelFavoriteAccess returns an error if the user is not allowed to
+// compare the repository of a favorite from the channel it is pinned in
+func (c Controller) checkChannelFavoriteAccess(userID string, uc store.UserComparison) error {
+	if !slack.IsChannelID(uc.ChannelID) {
+		return fmt.Errorf(":warning: only the comparisons requested from a channel can be pinned to it")
+	}
+
+	repo, found := c.Store.GetRepository(uc.RepositoryKey)
+	if !found {
+		return fmt.Errorf(":warning: the repository of the comparison could not be found anymore")
+	}
+
+	return c.checkRepositoryAccess(userID, uc.ChannelID, repo)
+}
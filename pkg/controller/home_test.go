@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHomeTabChannelFavorites(t *testing.T) {
+	c := newTestControllerWithRepositories()
+	c.AccessRules = NewAccessRules(config.AccessRules{
+		{Repositories: []string{"public/*"}},
+	})
+
+	main := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	tag := providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag}
+	repos := make(providers.Repositories)
+	for _, name := range []string{"secret/api", "public/docs"} {
+		r := providers.Repository{
+			Name:         name,
+			ProviderType: providers.ProviderTypeGitHub,
+			Refs:         providers.Refs{main.Key(): main, tag.Key(): tag},
+		}
+		repos[r.Key()] = r
+	}
+	c.Store.UpdateRepositories(repos)
+
+	docs := store.UserComparison{
+		RepositoryKey: providers.Repository{Name: "public/docs", ProviderType: providers.ProviderTypeGitHub}.Key(),
+		FromRefKey:    tag.Key(),
+		ToRefKey:      main.Key(),
+	}
+	api := docs
+	api.RepositoryKey = providers.Repository{Name: "secret/api", ProviderType: providers.ProviderTypeGitHub}.Key()
+
+	c.Store.PinChannelFavorite("C1", docs)
+	c.Store.PinChannelFavorite("C1", api)
+	c.Store.PinChannelFavorite("C2", docs)
+
+	// Only the favorites of the channels the user compared from are listed
+	assert.Empty(t, c.getHomeTabChannelFavorites("U1"))
+
+	docs.ChannelID = "C1"
+	c.Store.AddUserComparison("U1", docs)
+	hcs := c.getHomeTabChannelFavorites("U1")
+	assert.Len(t, hcs, 1)
+	assert.Equal(t, "public/docs", hcs[0].Repository.Name)
+	assert.Equal(t, "C1", hcs[0].ChannelID)
+	assert.Equal(t, docs.KeyWithChannel(), hcs[0].Key)
+
+	// Pinning requires being allowed to compare the repository from the channel
+	assert.NoError(t, c.checkChannelFavoriteAccess("U1", docs))
+	api.ChannelID = "C1"
+	assert.Error(t, c.checkChannelFavoriteAccess("U1", api))
+	docs.ChannelID = "D1"
+	assert.Error(t, c.checkChannelFavoriteAccess("U1", docs))
+}
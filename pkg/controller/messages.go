@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+
+	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
+)
+
+// handleMessageActions handles the interactions with the buttons of the
+// messages we posted. As Slack expects them to be acknowledged within 3 seconds,
+// the comparisons they require get computed in the background
+func (c Controller) handleMessageActions(w http.ResponseWriter, i goSlack.InteractionCallback) {
+	for _, a := range i.ActionCallback.BlockActions {
+		if a == nil {
+			continue
+		}
+
+		switch a.ActionID {
+		case "preview_post", "refresh", "notify_authors":
+			v, ok := parseMessageActionValue(a.Value, i.User.ID)
+			if !ok {
+				log.WithField("value", a.Value).WithError(fmt.Errorf("invalid message action value")).Error()
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			go c.runMessageAction(a.ActionID, v, i)
+		case "preview_discard":
+			deleteOriginalMessage(i.ResponseURL)
+		default:
+			log.WithField("action_id", a.ActionID).Debug("ignoring unsupported message action")
+		}
+	}
+}
+
+// runMessageAction compares again the commits of a message in order to post it or
+// notify its authors, or its refs, as they may have moved since it got rendered,
+// in order to refresh it.
+// It is meant to run in the background once the interaction got acknowledged,
+// failures get reported to the user
+func (c Controller) runMessageAction(actionID string, v messageActionValue, i goSlack.InteractionCallback) {
+	ctx, cancel := c.interactionContext()
+	defer cancel()
+
+	var opts slack.ModalRequestOptions
+	var err error
+	switch actionID {
+	case "notify_authors", "preview_post":
+		// The authors get notified about the commits which got posted only, and
+		// the commits which got previewed are the ones which get posted
+		opts, err = c.compareMessageActionValue(ctx, i.User.ID, i.Container.ChannelID, v)
+	default:
+		opts, err = c.compareUserComparison(ctx, i.User.ID, i.Container.ChannelID, v.UserComparison)
+	}
+
+	var denied AccessDeniedError
+	if errors.As(err, &denied) {
+		c.respondAccessDenied(i.Container.ChannelID, i.User.ID, err)
+		return
+	}
+
+	if err != nil {
+		log.WithField("comparison_key", v.Key()).WithError(err).Warning("comparing refs")
+		c.respondComparisonError(i.Container.ChannelID, i.Container.ThreadTs, i.User.ID, i.ResponseURL, err)
+		return
+	}
+
+	switch actionID {
+	case "notify_authors":
+		c.notifyAuthors(i, opts)
+
+		// The authors can only be notified once, the button is not needed anymore
+		// unless none of them could be
+		if !c.Store.AuthorsNotified(i.Container.ChannelID, i.Container.MessageTs) {
+			return
+		}
+
+		blocks := slack.RemoveNotifyAuthorsButton(c.Slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, v.RequesterID, v.String()))
+		if _, _, _, err = c.Slack.Client.UpdateMessage(i.Container.ChannelID, i.Container.MessageTs, goSlack.MsgOptionBlocks(blocks.BlockSet...)); err != nil {
+			log.WithError(err).Warning("removing the notify authors button")
+		}
+	case "refresh":
+		// Refreshing the message must not alter who requested the comparison
+		blocks := c.Slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, v.RequesterID, newMessageActionValue(opts, v.RequesterID).String())
+		if c.Store.AuthorsNotified(i.Container.ChannelID, i.Container.MessageTs) {
+			blocks = slack.RemoveNotifyAuthorsButton(blocks)
+		}
+
+		if _, _, _, err = c.Slack.Client.UpdateMessage(i.Container.ChannelID, i.Container.MessageTs, goSlack.MsgOptionBlocks(blocks.BlockSet...)); err != nil {
+			log.WithError(err).Error()
+			return
+		}
+
+		// The refresh is recorded on its own, the comparison got posted by its requester
+		c.auditComparison(audit.SourceMessageRefresh, i.User.ID, i.Container.ChannelID, opts, false)
+	case "preview_post":
+		blocks := c.Slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, i.User.ID, newMessageActionValue(opts, i.User.ID).String())
+		if err = c.sendMessage(i.Container.ChannelID, i.Container.ThreadTs, i.User.ID, i.ResponseURL, false, blocks); err != nil {
+			log.WithError(err).Error()
+			return
+		}
+
+		c.recordUserComparison(i.User.ID, opts)
+		c.auditComparison(audit.SourceMessageAction, i.User.ID, i.Container.ChannelID, opts, true)
+		deleteOriginalMessage(i.ResponseURL)
+	}
+}
+
+// notifyAuthors sends a direct message to each author of the comparison which
+// could be resolved to a Slack user and has not been notified about the message
+// yet, listing their commits
+func (c Controller) notifyAuthors(i goSlack.InteractionCallback, opts slack.ModalRequestOptions) {
+	permalink, err := c.Slack.Client.GetPermalink(&goSlack.PermalinkParameters{
+		Channel: i.Container.ChannelID,
+		Ts:      i.Container.MessageTs,
+	})
+	if err != nil {
+		log.WithError(err).Warning("fetching message permalink")
+	}
+
+	var notified []string
+	for _, author := range opts.Comparison.GetAuthors() {
+		// Marking the author beforehand prevents concurrent clicks from notifying it twice
+		if author.SlackUserID == "" || !c.Store.MarkAuthorNotified(i.Container.ChannelID, i.Container.MessageTs, author.SlackUserID) {
+			continue
+		}
+
+		blocks := slack.GenerateAuthorNotificationMessage(opts.Repository, opts.FromRef, opts.ToRef, opts.Comparison.GetSlackUserCommits(author.SlackUserID), i.User.ID, permalink)
+		if _, _, err = c.Slack.Client.PostMessage(author.SlackUserID, goSlack.MsgOptionBlocks(blocks.BlockSet...)); err != nil {
+			log.WithError(err).WithField("slack_user_id", author.SlackUserID).Warning("notifying author")
+			c.Store.UnmarkAuthorNotified(i.Container.ChannelID, i.Container.MessageTs, author.SlackUserID)
+			continue
+		}
+
+		notified = append(notified, fmt.Sprintf("<@%s>", author.SlackUserID))
+	}
+
+	text := ":shrug: none of the authors could be notified"
+	if len(notified) > 0 {
+		text = fmt.Sprintf(":bell: notified %s", strings.Join(notified, ", "))
+	}
+
+	msgOpts := []goSlack.MsgOption{goSlack.MsgOptionText(text, false)}
+	if i.Container.ThreadTs != "" {
+		msgOpts = append(msgOpts, goSlack.MsgOptionTS(i.Container.ThreadTs))
+	}
+
+	if _, err = c.Slack.Client.PostEphemeral(i.Container.ChannelID, i.User.ID, msgOpts...); err != nil {
+		log.WithError(err).Warning("confirming authors notification")
+	}
+}
+
+// messageActionValue is the value of the buttons of the posted comparisons, it
+// references the comparison, the user who requested it (empty for the watches)
+// and the commits which got compared
+type messageActionValue struct {
+	store.UserComparison
+	RequesterID string
+	FromSHA     string
+	ToSHA       string
+}
+
+// newMessageActionValue returns the messageActionValue of a comparison
+func newMessageActionValue(opts slack.ModalRequestOptions, requesterID string) (v messageActionValue) {
+	v.UserComparison = newUserComparison(opts)
+	v.RequesterID = requesterID
+	if opts.Comparison != nil {
+		v.FromSHA = opts.Comparison.FromStatus.SHA
+		v.ToSHA = opts.Comparison.ToStatus.SHA
+	}
+	return
+}
+
+// String encodes the value as <comparison key>/<requester ID>/<from SHA>/<to SHA>
+func (v messageActionValue) String() string {
+	return strings.Join([]string{v.Key(), v.RequesterID, v.FromSHA, v.ToSHA}, "/")
+}
+
+// parseMessageActionValue decodes a messageActionValue. The messages posted
+// before the requester got encoded only reference the comparison, the given
+// requester is used for them
+func parseMessageActionValue(value, defaultRequesterID string) (v messageActionValue, ok bool) {
+	values := strings.Split(value, "/")
+	if len(values) != 3 && len(values) != 4 && len(values) != 6 {
+		return
+	}
+
+	if v.UserComparison, ok = store.ParseUserComparisonKey(strings.Join(values[:3], "/")); !ok {
+		return
+	}
+
+	v.RequesterID = defaultRequesterID
+	if len(values) > 3 {
+		v.RequesterID = values[3]
+	}
+
+	if len(values) == 6 {
+		v.FromSHA, v.ToSHA = values[4], values[5]
+	}
+	return
+}
+
+// compareUserComparison resolves the repository and refs referenced by a
+// UserComparison and compares them, provided the user is allowed to compare
+// the repository from the channel
+func (c Controller) compareUserComparison(ctx context.Context, userID, channelID string, uc store.UserComparison) (opts slack.ModalRequestOptions, err error) {
+	var found bool
+	opts.Repository, opts.FromRef, opts.ToRef, found = c.resolveUserComparison(uc)
+	if !found {
+		return opts, fmt.Errorf("comparison not found")
+	}
+
+	if err = c.checkRepositoryAccess(userID, channelID, opts.Repository); err != nil {
+		return
+	}
+
+	opts.Comparison, err = c.compare(ctx, opts.Repository, opts.FromRef, opts.ToRef)
+	return
+}
+
+// compareMessageActionValue compares the commits referenced by a message action
+// value, ie: the ones which got posted. The refs get compared instead for the
+// messages posted before the commits got encoded
+func (c Controller) compareMessageActionValue(ctx context.Context, userID, channelID string, v messageActionValue) (opts slack.ModalRequestOptions, err error) {
+	if v.FromSHA == "" || v.ToSHA == "" {
+		return c.compareUserComparison(ctx, userID, channelID, v.UserComparison)
+	}
+
+	var found bool
+	opts.Repository, opts.FromRef, opts.ToRef, found = c.resolveUserComparison(v.UserComparison)
+	if !found {
+		return opts, fmt.Errorf("comparison not found")
+	}
+
+	if err = c.checkRepositoryAccess(userID, channelID, opts.Repository); err != nil {
+		return
+	}
+
+	if opts.Comparison, err = c.compare(ctx, opts.Repository, commitRef(v.FromSHA), commitRef(v.ToSHA)); err != nil {
+		return
+	}
+
+	// The link has to point to the refs, as in the posted message
+	opts.Comparison.WebURL = c.Providers[opts.Repository.ProviderType].CompareWebURL(opts.Repository.Name, opts.FromRef, opts.ToRef)
+	return
+}
+
+// deleteOriginalMessage removes the message from which an interaction originated,
+// ephemeral ones included
+func deleteOriginalMessage(responseURL string) {
+	if err := goSlack.PostWebhook(responseURL, &goSlack.WebhookMessage{
+		DeleteOriginal: true,
+	}); err != nil {
+		log.WithError(err).Warning("deleting original message")
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageActionValue(t *testing.T) {
+	opts := slack.ModalRequestOptions{
+		Repository: providers.Repository{Name: "foo/bar"},
+		FromRef:    providers.Ref{Name: "main"},
+		ToRef:      providers.Ref{Name: "v1.0.0"},
+		Comparison: &providers.Comparison{
+			FromStatus: providers.CommitStatus{SHA: "abc"},
+			ToStatus:   providers.CommitStatus{SHA: "def"},
+		},
+	}
+	uc := newUserComparison(opts)
+
+	v, ok := parseMessageActionValue(newMessageActionValue(opts, "U1").String(), "U2")
+	assert.True(t, ok)
+	assert.Equal(t, uc.Key(), v.Key())
+	assert.Equal(t, "U1", v.RequesterID)
+	assert.Equal(t, "abc", v.FromSHA)
+	assert.Equal(t, "def", v.ToSHA)
+
+	// Watches do not have any requester
+	v, ok = parseMessageActionValue(newMessageActionValue(opts, "").String(), "U2")
+	assert.True(t, ok)
+	assert.Empty(t, v.RequesterID)
+
+	// Messages posted before the commits got encoded
+	v, ok = parseMessageActionValue(uc.Key()+"/U1", "U2")
+	assert.True(t, ok)
+	assert.Equal(t, "U1", v.RequesterID)
+	assert.Empty(t, v.FromSHA)
+
+	// Messages posted before the requester got encoded
+	v, ok = parseMessageActionValue(uc.Key(), "U2")
+	assert.True(t, ok)
+	assert.Equal(t, "U2", v.RequesterID)
+
+	_, ok = parseMessageActionValue("foo", "U2")
+	assert.False(t, ok)
+
+	_, ok = parseMessageActionValue(store.UserComparison{}.Key()+"/U1/abc", "U2")
+	assert.False(t, ok)
+}
+
+func TestCompareMessageActionValue(t *testing.T) {
+	var compares int
+	p := comparingProvider{
+		shas: map[string]string{
+			"main":   "aaa",
+			"v1.0.0": "ccc",
+		},
+		compares: &compares,
+	}
+
+	c := Controller{
+		Store:     &store.Store{},
+		Providers: providers.Providers{providers.ProviderTypeGitHub: p},
+	}
+
+	fromRef := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	toRef := providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag}
+	repo := providers.Repository{
+		ProviderType: providers.ProviderTypeGitHub,
+		Name:         "foo/bar",
+		Refs:         providers.Refs{fromRef.Key(): fromRef, toRef.Key(): toRef},
+	}
+	c.Store.UpdateRepositories(providers.Repositories{repo.Key(): repo})
+
+	// The refs moved since the comparison got posted
+	v := newMessageActionValue(slack.ModalRequestOptions{
+		Repository: repo,
+		FromRef:    fromRef,
+		ToRef:      toRef,
+		Comparison: &providers.Comparison{
+			FromStatus: providers.CommitStatus{SHA: "aaa"},
+			ToStatus:   providers.CommitStatus{SHA: "bbb"},
+		},
+	}, "U1")
+
+	opts, err := c.compareMessageActionValue(context.Background(), "U1", "C1", v)
+	assert.NoError(t, err)
+	assert.Equal(t, "bbb", opts.Comparison.Commits[0].ID)
+	assert.Equal(t, "http://foo/main...v1.0.0", opts.Comparison.WebURL)
+	assert.Equal(t, "v1.0.0", opts.ToRef.Name)
+
+	// Without the commits, the refs get compared
+	v.FromSHA, v.ToSHA = "", ""
+	opts, err = c.compareMessageActionValue(context.Background(), "U1", "C1", v)
+	assert.NoError(t, err)
+	assert.Equal(t, "ccc", opts.Comparison.Commits[0].ID)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
+
+	goSlack "github.com/slack-go/slack"
+)
+
+// openMessageShortcutModal opens the modal from a message shortcut, the comparison
+// will then be posted as a reply in the thread of the message. If guess is set,
+// the modal gets prefilled with the repository and refs mentioned in the message
+func (c Controller) openMessageShortcutModal(i goSlack.InteractionCallback, guess bool) {
+	opts := slack.ModalRequestOptions{
+		ConversationID:           i.Channel.ID,
+		ThreadTS:                 i.Message.ThreadTimestamp,
+		LastRepositoriesUpdate:   c.Store.GetRepositoriesLastUpdate(),
+		StaleRepositoriesSources: c.Store.GetStaleRepositoriesSources(),
+	}
+
+	if opts.ThreadTS == "" {
+		opts.ThreadTS = i.Message.Timestamp
+	}
+
+	if len(c.Store.GetRepositories()) == 0 ||
+		opts.LastRepositoriesUpdate.IsZero() {
+		opts.CurrentlyUpdatingRepositories = true
+		c.openModal(i.TriggerID, i.User.ID, audit.SourceMessageAction, opts)
+		return
+	}
+
+	if guess {
+		opts.Repository, opts.FromRef, opts.ToRef = c.guessComparisonFromText(i.User.ID, i.Channel.ID, i.Message.Text)
+	} else {
+		opts.Repository = c.getChannelRepositoryByClosestNameMatch(i.User.ID, i.Channel.ID, "")
+	}
+
+	// Let the user pick one of the repositories they are allowed to compare instead
+	if !c.isRepositoryAllowed(i.User.ID, i.Channel.ID, opts.Repository) {
+		opts.Repository, opts.FromRef, opts.ToRef = providers.Repository{}, providers.Ref{}, providers.Ref{}
+	}
+
+	if !opts.Repository.IsEmpty() &&
+		(opts.Repository.RefsLastUpdate.IsZero() || len(opts.Repository.Refs) == 0) {
+		opts.CurrentlyUpdatingRepositoryRefs = true
+	}
+
+	c.openModal(i.TriggerID, i.User.ID, audit.SourceMessageAction, opts)
+}
+
+// guessComparisonFromText returns the repository and refs which are the most
+// likely mentioned in the text, a compare URL taking precedence over the names.
+// Only the repositories the user is allowed to compare are considered
+func (c Controller) guessComparisonFromText(userID, channelID, text string) (repo providers.Repository, fromRef, toRef providers.Ref) {
+	boundRepos, restricted := c.getChannelRepositories(channelID)
+	boundRepos = c.filterAllowedRepositories(userID, channelID, boundRepos)
+	repos := c.filterAllowedRepositories(userID, channelID, c.Store.GetRepositories())
+	if restricted {
+		repos = boundRepos
+	}
+
+	if ch, found := providers.ExtractCompareURL(text); found {
+		for _, r := range repos {
+			if r.Name == ch.Repository {
+				repo = r
+				break
+			}
+		}
+
+		if repo.IsEmpty() {
+			repo = c.getChannelRepositoryByClosestNameMatch(userID, channelID, ch.Repository)
+		}
+
+		if ref, found := repo.Refs.GetByName(ch.FromRef); found {
+			fromRef = ref
+		}
+
+		if ref, found := repo.Refs.GetByName(ch.ToRef); found {
+			toRef = ref
+		}
+
+		return
+	}
+
+	tokens := providers.ExtractTokens(text)
+
+	// Repositories bound to the channel are preferred
+	var repoToken string
+	repo, repoToken = boundRepos.GuessFromTokens(tokens)
+	if repo.IsEmpty() {
+		repo, repoToken = repos.GuessFromTokens(tokens)
+	}
+
+	if repo.IsEmpty() {
+		repo = c.getChannelRepositoryByClosestNameMatch(userID, channelID, "")
+	}
+
+	var refTokens []string
+	for _, token := range tokens {
+		if token != repoToken {
+			refTokens = append(refTokens, token)
+		}
+	}
+
+	fromRef, toRef = repo.Refs.GuessFromTokens(refTokens)
+	return
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessComparisonFromText(t *testing.T) {
+	refs := providers.Refs{}
+	for _, r := range []providers.Ref{
+		{Name: "main", Type: providers.RefTypeBranch},
+		{Name: "v1.0.0", Type: providers.RefTypeTag},
+	} {
+		refs[r.Key()] = r
+	}
+
+	c := Controller{Store: &store.Store{}}
+	repos := make(providers.Repositories)
+	for _, name := range []string{"foo/api", "bar/api"} {
+		r := providers.Repository{Name: name, ProviderType: providers.ProviderTypeGitHub, Refs: refs}
+		repos[r.Key()] = r
+	}
+	c.Store.UpdateRepositories(repos)
+	c.Channels = config.Channels{
+		{ID: "C1", Repositories: []string{"bar/api"}},
+	}
+
+	// Compare URL
+	repo, fromRef, toRef := c.guessComparisonFromText("U1", "C0", "<https://github.com/foo/api/compare/v1.0.0...main>")
+	assert.Equal(t, "foo/api", repo.Name)
+	assert.Equal(t, "v1.0.0", fromRef.Name)
+	assert.Equal(t, "main", toRef.Name)
+
+	// Names, the repositories bound to the channel being preferred
+	repo, fromRef, toRef = c.guessComparisonFromText("U1", "C1", "deployed *api* `v1.0.0` (main)")
+	assert.Equal(t, "bar/api", repo.Name)
+	assert.Equal(t, "v1.0.0", fromRef.Name)
+	assert.Equal(t, "main", toRef.Name)
+
+	// Nothing relevant
+	repo, fromRef, toRef = c.guessComparisonFromText("U1", "C0", "hello world")
+	assert.True(t, repo.IsEmpty())
+	assert.True(t, fromRef.IsEmpty())
+	assert.True(t, toRef.IsEmpty())
+}
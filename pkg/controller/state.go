@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// refsUpdateStateSaveInterval throttles the writes of the state file while a
+// run is in progress, a resumed run may therefore refresh a few repositories again
+const refsUpdateStateSaveInterval = 5 * time.Second
+
+// RefsUpdateStateFile persists the state of the refs updates onto a file, for
+// an interrupted run to be resumed after a restart
+type RefsUpdateStateFile struct {
+	Path string
+
+	interval time.Duration
+	lastSave time.Time
+	mutex    sync.Mutex
+}
+
+// NewRefsUpdateStateFile returns a RefsUpdateStateFile, nil if path is empty
+func NewRefsUpdateStateFile(path string) *RefsUpdateStateFile {
+	if path == "" {
+		return nil
+	}
+
+	return &RefsUpdateStateFile{
+		Path:     path,
+		interval: refsUpdateStateSaveInterval,
+	}
+}
+
+// Load returns the persisted state, an empty one if it has not been saved yet
+func (f *RefsUpdateStateFile) Load() (state store.RefsUpdateState, err error) {
+	if f == nil {
+		return
+	}
+
+	b, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, fmt.Errorf("reading refs update state file: %v", err)
+	}
+
+	if err = json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("parsing refs update state file: %v", err)
+	}
+
+	return
+}
+
+// Save persists the state, unless it has been saved less than the interval ago
+// and force is false. The file gets replaced atomically
+func (f *RefsUpdateStateFile) Save(state store.RefsUpdateState, force bool) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !force && time.Since(f.lastSave) < f.interval {
+		return nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing refs update state file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing refs update state file: %v", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("writing refs update state file: %v", err)
+	}
+
+	if err = os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("writing refs update state file: %v", err)
+	}
+
+	f.lastSave = time.Now()
+	return nil
+}
+
+func (c *Controller) saveRefsUpdateState(force bool) {
+	if c.RefsUpdateState == nil {
+		return
+	}
+
+	if err := c.RefsUpdateState.Save(c.Store.GetRefsUpdateState(), force); err != nil {
+		log.WithError(err).Warning("saving refs update state")
+	}
+}
+
+func (c *Controller) completeRefsUpdateRunItem(rk providers.RepositoryKey, failed bool) {
+	c.Store.CompleteRefsUpdateRunItem(rk, failed)
+	c.saveRefsUpdateState(false)
+}
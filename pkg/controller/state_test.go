@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefsUpdateStateFile(t *testing.T) {
+	assert.Nil(t, NewRefsUpdateStateFile(""))
+
+	f := NewRefsUpdateStateFile(filepath.Join(t.TempDir(), "state.json"))
+
+	// Not saved yet
+	state, err := f.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Run.Pending)
+
+	saved := store.RefsUpdateState{
+		Run: store.RefsUpdateRun{
+			Pending: []providers.RepositoryKey{"b"},
+			Updated: 1,
+			Running: true,
+		},
+		Failures: map[providers.RepositoryKey]store.RefsFailure{
+			"b": {LastError: "boom", Failures: 2},
+		},
+	}
+	assert.NoError(t, f.Save(saved, true))
+
+	// Throttled
+	assert.NoError(t, f.Save(store.RefsUpdateState{}, false))
+
+	state, err = f.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved.Run.Pending, state.Run.Pending)
+	assert.Equal(t, 1, state.Run.Updated)
+	assert.False(t, state.Run.Running)
+	assert.Equal(t, saved.Failures, state.Failures)
+
+	// Disabled
+	var disabled *RefsUpdateStateFile
+	assert.NoError(t, disabled.Save(saved, true))
+	state, err = disabled.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Run.Pending)
+}
@@ -5,8 +5,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/slack"
 	log "github.com/sirupsen/logrus"
+	goSlack "github.com/slack-go/slack"
 	"github.com/vmihailenco/taskq/v3"
 	"github.com/vmihailenco/taskq/v3/memqueue"
 )
@@ -37,16 +41,23 @@ const (
 	// TaskTypeSlackUsersEmailsUpdate updates the local store with slack users emails fetched from
 	// the Slack API and local configuration (for custom aliases)
 	TaskTypeSlackUsersEmailsUpdate TaskType = "SlackUsersEmailsUpdate"
+
+	// TaskTypeWatchCompare compares the refs of the watches of a digest and posts it
+	// onto its Slack channel if the drift crosses the thresholds
+	TaskTypeWatchCompare TaskType = "WatchCompare"
 )
 
-// NewTaskController initializes and returns a new TaskController object
-func NewTaskController() (t TaskController) {
+// NewTaskController initializes and returns a new TaskController object, with
+// enough workers to update the refs of refsUpdateConcurrency repositories at once
+// while the task fanning them out waits for their completion
+func NewTaskController(refsUpdateConcurrency int) (t TaskController) {
 	t.TaskMap = &taskq.TaskMap{}
 	t.Factory = memqueue.NewFactory()
 	t.Queue = t.Factory.RegisterQueue(&taskq.QueueOptions{
 		Name:                 "default",
 		PauseErrorsThreshold: 3,
 		Handler:              t.TaskMap,
+		MinNumWorker:         int32(refsUpdateConcurrency) + 1,
 
 		// Disable system resources checks
 		MinSystemResources: taskq.SystemResources{
@@ -60,7 +71,7 @@ func NewTaskController() (t TaskController) {
 }
 
 // TaskHandlerRepositoriesUpdate updates the local store with repositories fetched from
-// configured git providers
+// configured git providers, even if some of them failed to be listed
 func (c *Controller) TaskHandlerRepositoriesUpdate(wg *sync.WaitGroup) {
 	if wg != nil {
 		defer wg.Done()
@@ -71,41 +82,99 @@ func (c *Controller) TaskHandlerRepositoriesUpdate(wg *sync.WaitGroup) {
 		return
 	}
 
-	repos, err := c.Providers.ListRepositories()
-	if err != nil {
-		log.WithError(err).Warning("executing 'RepositoriesUpdate' task")
+	// The last known repositories of the sources which failed get kept
+	l := c.Providers.ListRepositories(c.Context)
+	if c.Context.Err() != nil {
+		log.Debug("repositories update cancelled")
 		return
 	}
 
-	c.Store.UpdateRepositories(repos)
+	if err := l.Err(); err != nil {
+		log.WithError(err).Warning("executing 'RepositoriesUpdate' task")
+	}
+
+	c.Store.UpdateRepositoriesFromListing(l)
 	log.Info("updated repositories list")
 	return
 }
 
 // TaskHandlerRepositoriesRefsUpdate updates all Repositories in the local store with refs fetched from
-// its associated git provider
+// their associated git provider. It fans out a RepositoryRefsUpdate task per repository, up to
+// RefsUpdateConcurrency at once, starting with the repositories refreshed the longest
+// time ago. A run interrupted by a restart is resumed when its state is persisted
 func (c *Controller) TaskHandlerRepositoriesRefsUpdate() {
-	for _, r := range c.Store.GetRepositories() {
-		var err error
-		r.Refs, err = c.Providers[r.ProviderType].ListRefs(r.Name)
-		if err != nil {
+	repos := c.Store.GetRepositories()
+	if len(repos) == 0 {
+		log.Debug("no repositories listed yet, skipping refs update..")
+		return
+	}
+
+	run, started := c.Store.StartRefsUpdateRun(repos.KeysByRefsStaleness())
+	if !started {
+		log.Debug("refs of all repositories already being updated, skipping..")
+		return
+	}
+	c.saveRefsUpdateState(true)
+
+	log.WithFields(log.Fields{
+		"pending":    len(run.Pending),
+		"started_at": run.StartedAt,
+	}).Info("updating refs of all repositories")
+
+	defer func() {
+		run := c.Store.StopRefsUpdateRun()
+		c.saveRefsUpdateState(true)
+		log.WithFields(log.Fields{
+			"updated": run.Updated,
+			"failed":  run.Failed,
+			"pending": len(run.Pending),
+		}).Info("updated refs of all repositories")
+	}()
+
+	slots := make(chan struct{}, c.RefsUpdateConcurrency)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	for _, rk := range run.Pending {
+		r, found := c.Store.GetRepository(rk)
+		if !found {
+			c.completeRefsUpdateRunItem(rk, true)
+			continue
+		}
+
+		// Leave some budget for the interactive calls
+		if err := c.Providers[r.ProviderType].RateLimiter().WaitForBackgroundBudget(c.Context); err != nil {
 			log.WithError(err).Warning("executing 'RepositoriesRefsUpdate' task")
 			return
 		}
 
-		r.RefsLastUpdate = time.Now()
-		c.Store.UpdateRepository(r)
-		log.WithFields(log.Fields{
-			"repository_provider": r.ProviderType,
-			"repository_name":     r.Name,
-		}).Info("updated repo refs list!")
-	}
+		select {
+		case <-c.Context.Done():
+			return
+		case slots <- struct{}{}:
+		}
 
-	return
+		wg.Add(1)
+		go func(rk providers.RepositoryKey) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			taskWG := sync.WaitGroup{}
+			taskWG.Add(1)
+			if err := c.scheduleTask(TaskTypeRepositoryRefsUpdate, &taskWG, rk); err != nil {
+				// The repository remains stale, it will come first on the next run
+				log.WithError(err).WithField("repository_key", rk).Warning("executing 'RepositoriesRefsUpdate' task")
+				return
+			}
+			taskWG.Wait()
+		}(rk)
+	}
 }
 
 // TaskHandlerRepositoryRefsUpdate updates a Repository in the local store with refs fetched from
-// its associated git provider
+// its associated git provider. Failures are recorded onto the Repository
 func (c *Controller) TaskHandlerRepositoryRefsUpdate(wg *sync.WaitGroup, rk providers.RepositoryKey) {
 	if wg != nil {
 		defer wg.Done()
@@ -115,31 +184,54 @@ func (c *Controller) TaskHandlerRepositoryRefsUpdate(wg *sync.WaitGroup, rk prov
 	if !found {
 		err := fmt.Errorf("repository key '%s' not found in store", rk)
 		log.WithError(err).WithField("repository_key", rk).Warning("executing 'RepositoryRefsUpdate' task")
+		c.completeRefsUpdateRunItem(rk, true)
 		return
 	}
 
 	if r.RefsLastUpdate.Add(time.Minute).Unix() > time.Now().Unix() {
 		log.Debug("refs updated less than a minute ago, skipping..")
+		c.completeRefsUpdateRunItem(rk, false)
+		return
+	}
+
+	refs, err := c.Providers[r.ProviderType].ListRefsWithContext(c.Context, r.Name)
+
+	// The repository may have been updated in the meantime
+	if current, found := c.Store.GetRepository(rk); found {
+		r = current
+	}
+
+	// Being shut down is not a failure of the repository, it remains pending
+	if err != nil && c.Context.Err() != nil {
+		log.WithField("repository_key", rk).Debug("refs update cancelled")
 		return
 	}
 
-	var err error
-	r.Refs, err = c.Providers[r.ProviderType].ListRefs(r.Name)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"repository_provider": r.ProviderType,
 			"repository_name":     r.Name,
+			"failures":            r.RefsFailures + 1,
 		}).Warning("executing 'RepositoryRefsUpdate' task")
+
+		r.RefsLastError = err.Error()
+		r.RefsFailures++
+		c.Store.UpdateRepository(r)
+		c.completeRefsUpdateRunItem(rk, true)
 		return
 	}
+
+	r.Refs = refs
 	r.RefsLastUpdate = time.Now()
+	r.RefsLastError = ""
+	r.RefsFailures = 0
 
 	c.Store.UpdateRepository(r)
+	c.completeRefsUpdateRunItem(rk, false)
 	log.WithFields(log.Fields{
 		"repository_provider": r.ProviderType,
 		"repository_name":     r.Name,
 	}).Info("updated repo refs list!")
-	return
 }
 
 // TaskHandlerSlackUsersEmailsUpdate updates the local store with slack users emails fetched from
@@ -160,3 +252,146 @@ func (c *Controller) TaskHandlerSlackUsersEmailsUpdate() {
 	log.Info("updated slack users emails mapping list")
 	return
 }
+
+// WatchDigest groups the watches posting onto the same channel on the same
+// schedule, their comparisons get posted as a single digest
+type WatchDigest struct {
+	Channel  string
+	Schedule string
+	WatchIDs []int
+}
+
+// groupWatches returns the digests of the watches, in the order of their first watch
+func groupWatches(watches config.Watches) (digests []WatchDigest) {
+	indexes := make(map[[2]string]int)
+	for id, w := range watches {
+		key := [2]string{w.Channel, w.Schedule}
+		i, found := indexes[key]
+		if !found {
+			i = len(digests)
+			indexes[key] = i
+			digests = append(digests, WatchDigest{Channel: w.Channel, Schedule: w.Schedule})
+		}
+		digests[i].WatchIDs = append(digests[i].WatchIDs, id)
+	}
+	return
+}
+
+// TaskHandlerWatchCompare compares the refs of the watches of a digest and posts
+// it onto its Slack channel if the drift of some of them crosses their thresholds.
+// The comparisons get posted as replies to the digest, keeping their buttons usable
+func (c *Controller) TaskHandlerWatchCompare(digestID int) {
+	if digestID < 0 || digestID >= len(c.WatchDigests) {
+		log.WithField("digest_id", digestID).Warning("executing 'WatchCompare' task: digest not found")
+		return
+	}
+
+	d := c.WatchDigests[digestID]
+	var comparisons []slack.ModalRequestOptions
+	for _, watchID := range d.WatchIDs {
+		if opts, crossed := c.compareWatch(c.Watches[watchID]); crossed {
+			comparisons = append(comparisons, opts)
+		}
+	}
+
+	logFields := log.Fields{
+		"channel":  d.Channel,
+		"schedule": d.Schedule,
+	}
+
+	if len(comparisons) == 0 {
+		log.WithFields(logFields).Debug("watch thresholds not crossed, skipping digest")
+		return
+	}
+
+	_, threadTS, err := c.Slack.Client.PostMessage(d.Channel, goSlack.MsgOptionBlocks(slack.GenerateWatchesDigestMessage(comparisons).BlockSet...))
+	if err != nil {
+		log.WithError(err).WithFields(logFields).Warning("executing 'WatchCompare' task")
+		return
+	}
+
+	for _, opts := range comparisons {
+		value := newMessageActionValue(opts, "").String()
+		blocks := c.Slack.GenerateComparisonMessage(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, "", value)
+		if _, _, err = c.Slack.Client.PostMessage(d.Channel, goSlack.MsgOptionBlocks(blocks.BlockSet...), goSlack.MsgOptionTS(threadTS)); err != nil {
+			log.WithError(err).WithFields(logFields).WithField("repository", opts.Repository.Name).Warning("executing 'WatchCompare' task")
+			continue
+		}
+
+		c.auditComparison(audit.SourceWatch, "", d.Channel, opts, true)
+	}
+
+	log.WithFields(logFields).WithField("comparisons", len(comparisons)).Info("posted watch digest")
+}
+
+// compareWatch compares the refs of a watch and returns whether its drift crosses the thresholds
+func (c *Controller) compareWatch(w config.Watch) (opts slack.ModalRequestOptions, crossed bool) {
+	logFields := log.Fields{
+		"repository": w.Repository,
+		"from_ref":   w.FromRef,
+		"to_ref":     w.ToRef,
+	}
+
+	pt, err := providers.GetProviderTypeFromString(w.Provider)
+	if err != nil {
+		log.WithError(err).WithFields(logFields).Warning("executing 'WatchCompare' task")
+		return
+	}
+
+	rk := providers.Repository{ProviderType: pt, Name: w.Repository}.Key()
+	repo, found := c.Store.GetRepository(rk)
+	if !found {
+		log.WithFields(logFields).Warning("executing 'WatchCompare' task: repository not found in store")
+		return
+	}
+
+	if len(repo.Refs) == 0 {
+		c.TaskHandlerRepositoryRefsUpdate(nil, rk)
+		repo, _ = c.Store.GetRepository(rk)
+	}
+
+	fromRef, found := repo.Refs.GetByName(w.FromRef)
+	if !found {
+		log.WithFields(logFields).Warning("executing 'WatchCompare' task: from_ref not found")
+		return
+	}
+
+	toRef, found := repo.Refs.GetByName(w.ToRef)
+	if !found {
+		log.WithFields(logFields).Warning("executing 'WatchCompare' task: to_ref not found")
+		return
+	}
+
+	ctx, cancel := c.interactionContext()
+	defer cancel()
+
+	cmp, err := c.compare(ctx, repo, fromRef, toRef)
+	if err != nil {
+		log.WithError(err).WithFields(logFields).Warning("executing 'WatchCompare' task")
+		return
+	}
+
+	if !watchThresholdsCrossed(w.Thresholds, *cmp) {
+		log.WithFields(logFields).WithField("commit_count", cmp.CommitCount()).Debug("watch thresholds not crossed")
+		return
+	}
+
+	return slack.ModalRequestOptions{Repository: repo, FromRef: fromRef, ToRef: toRef, Comparison: cmp}, true
+}
+
+// watchThresholdsCrossed returns whether the drift of a comparison is worth posting a digest
+func watchThresholdsCrossed(t config.WatchThresholds, cmp providers.Comparison) bool {
+	if cmp.CommitCount() == 0 {
+		return false
+	}
+
+	if t.Commits == 0 && t.AgeSeconds <= 0 {
+		return true
+	}
+
+	if t.Commits > 0 && cmp.CommitCount() >= t.Commits {
+		return true
+	}
+
+	return t.AgeSeconds > 0 && time.Since(cmp.OldestCommitCreatedAt()) >= time.Duration(t.AgeSeconds)*time.Second
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/mvisonneau/slack-git-compare/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/taskq/v3"
+)
+
+func TestWatchThresholdsCrossed(t *testing.T) {
+	cmp := providers.Comparison{}
+	assert.False(t, watchThresholdsCrossed(config.WatchThresholds{}, cmp))
+
+	cmp.Commits = providers.Commits{
+		{CreatedAt: time.Now().Add(-2 * time.Hour)},
+		{CreatedAt: time.Now()},
+	}
+	assert.True(t, watchThresholdsCrossed(config.WatchThresholds{}, cmp))
+	assert.True(t, watchThresholdsCrossed(config.WatchThresholds{Commits: 2}, cmp))
+	assert.False(t, watchThresholdsCrossed(config.WatchThresholds{Commits: 3}, cmp))
+	assert.True(t, watchThresholdsCrossed(config.WatchThresholds{Commits: 3, AgeSeconds: 3600}, cmp))
+	assert.False(t, watchThresholdsCrossed(config.WatchThresholds{AgeSeconds: 3 * 3600}, cmp))
+}
+
+func TestGroupWatches(t *testing.T) {
+	assert.Equal(t, []WatchDigest{
+		{Channel: "C1", Schedule: "0 9 * * MON", WatchIDs: []int{0, 2}},
+		{Channel: "C2", Schedule: "0 9 * * MON", WatchIDs: []int{1}},
+		{Channel: "C1", Schedule: "0 9 * * *", WatchIDs: []int{3}},
+	}, groupWatches(config.Watches{
+		{Repository: "foo/a", Channel: "C1", Schedule: "0 9 * * MON"},
+		{Repository: "foo/b", Channel: "C2", Schedule: "0 9 * * MON"},
+		{Repository: "foo/c", Channel: "C1", Schedule: "0 9 * * MON"},
+		{Repository: "foo/d", Channel: "C1", Schedule: "0 9 * * *"},
+	}))
+
+	assert.Empty(t, groupWatches(nil))
+}
+
+type testProvider struct {
+	providers.Provider
+	failingRepositories map[string]bool
+}
+
+func (p testProvider) ListRefsWithContext(ctx context.Context, name string) (providers.Refs, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if p.failingRepositories[name] {
+		return nil, fmt.Errorf("permission denied")
+	}
+
+	r := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	return providers.Refs{r.Key(): r}, nil
+}
+
+func (p testProvider) RateLimiter() *providers.RateLimiter {
+	return nil
+}
+
+func TestTaskHandlerRepositoriesRefsUpdate(t *testing.T) {
+	c := &Controller{
+		Context: context.Background(),
+		Store:   &store.Store{},
+		Providers: providers.Providers{
+			providers.ProviderTypeGitHub: testProvider{failingRepositories: map[string]bool{"foo/archived": true}},
+		},
+		RefsUpdateConcurrency: 2,
+		TaskController:        NewTaskController(2),
+	}
+
+	_, _ = c.TaskController.TaskMap.Register(&taskq.TaskOptions{
+		Name:    string(TaskTypeRepositoryRefsUpdate),
+		Handler: c.TaskHandlerRepositoryRefsUpdate,
+	})
+
+	repos := make(providers.Repositories)
+	for _, name := range []string{"foo/a", "foo/archived", "foo/b", "foo/c"} {
+		r := providers.Repository{Name: name, ProviderType: providers.ProviderTypeGitHub}
+		repos[r.Key()] = r
+	}
+	c.Store.UpdateRepositories(repos)
+
+	c.TaskHandlerRepositoriesRefsUpdate()
+
+	run := c.Store.GetRefsUpdateRun()
+	assert.False(t, run.Running)
+	assert.Empty(t, run.Pending)
+	assert.Equal(t, 3, run.Updated)
+	assert.Equal(t, 1, run.Failed)
+
+	// A failing repository does not prevent the others from being updated
+	for _, r := range c.Store.GetRepositories() {
+		if r.Name == "foo/archived" {
+			assert.Empty(t, r.Refs)
+			assert.Equal(t, "permission denied", r.RefsLastError)
+			assert.Equal(t, 1, r.RefsFailures)
+			continue
+		}
+
+		assert.Len(t, r.Refs, 1, r.Name)
+		assert.False(t, r.RefsLastUpdate.IsZero())
+		assert.Zero(t, r.RefsFailures)
+	}
+}
+
+func TestTaskHandlerRepositoryRefsUpdateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &Controller{
+		Context: ctx,
+		Store:   &store.Store{},
+		Providers: providers.Providers{
+			providers.ProviderTypeGitHub: testProvider{},
+		},
+	}
+
+	r := providers.Repository{Name: "foo/a", ProviderType: providers.ProviderTypeGitHub}
+	c.Store.UpdateRepositories(providers.Repositories{r.Key(): r})
+	c.Store.StartRefsUpdateRun([]providers.RepositoryKey{r.Key()})
+
+	c.TaskHandlerRepositoryRefsUpdate(nil, r.Key())
+
+	// Shutting down does not count as a failure of the repository
+	r, _ = c.Store.GetRepository(r.Key())
+	assert.Empty(t, r.RefsLastError)
+	assert.Zero(t, r.RefsFailures)
+	assert.Len(t, c.Store.GetRefsUpdateRun().Pending, 1)
+}
@@ -2,16 +2,23 @@ package providers
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// coAuthorTrailerPattern matches the Co-authored-by trailers of commit messages
+var coAuthorTrailerPattern = regexp.MustCompile(`(?mi)^co-authored-by:[ \t]*(.*?)[ \t]*<([^>\s]+)>[ \t]*$`)
+
 // Comparison holds the information of a git compare response
 type Comparison struct {
-	Commits Commits
-	WebURL  string
+	Commits    Commits
+	Issues     Issues
+	WebURL     string
+	FromStatus CommitStatus
+	ToStatus   CommitStatus
 	// FromRef string
 	// ToRef   string
 }
@@ -21,6 +28,10 @@ type Author struct {
 	Name        string
 	Email       string
 	SlackUserID string
+
+	// Login is the username of the provider account the commit is attributed
+	// to, when the provider returns it
+	Login string
 }
 
 // Authors is a slice of Author
@@ -34,6 +45,10 @@ type Commit struct {
 	CreatedAt time.Time
 	Message   string
 	WebURL    string
+	Issues    Issues
+
+	// CoAuthors are parsed from the Co-authored-by trailers of the commit message
+	CoAuthors Authors
 }
 
 // Commits is a slice of Commit
@@ -44,6 +59,17 @@ func (c Comparison) CommitCount() uint {
 	return uint(len(c.Commits))
 }
 
+// OldestCommitCreatedAt returns the creation date of the oldest commit of the
+// comparison, zero if there are no commits
+func (c Comparison) OldestCommitCreatedAt() (t time.Time) {
+	for _, commit := range c.Commits {
+		if t.IsZero() || commit.CreatedAt.Before(t) {
+			t = commit.CreatedAt
+		}
+	}
+	return
+}
+
 // ShortMessage truncates commit messages down to 80 chars
 // and omits return carriages
 func (c Commit) ShortMessage() string {
@@ -68,52 +94,174 @@ func (c Commit) AuthorSlackString() string {
 	return fmt.Sprintf("*%s* - _%s_", c.Author.Name, c.Author.Email)
 }
 
-// HydrateCommitsAuthorsWithSlackUserID adds the SlackUserID of an author based
-// on its email address
-func (c *Comparison) HydrateCommitsAuthorsWithSlackUserID(mapping map[string]string) {
-	for k, commit := range c.Commits {
-		if slackUserID, found := mapping[commit.Author.Email]; found {
-			c.Commits[k].Author.SlackUserID = slackUserID
+// SlackUserIDLookup returns the SlackUserID of an author whose email address is
+// not part of the mapping, or an empty string if it cannot be resolved
+type SlackUserIDLookup func(author Author) string
+
+// HydrateCommitsAuthorsWithSlackUserID adds the SlackUserID of the authors and
+// co-authors based on their email addresses. The lookup, if not nil, is used for
+// the email addresses which are not part of the mapping
+func (c *Comparison) HydrateCommitsAuthorsWithSlackUserID(mapping map[string]string, lookup SlackUserIDLookup) {
+	lookedUp := make(map[string]string)
+	hydrate := func(commitID string, author *Author) {
+		slackUserID, found := mapping[author.Email]
+		if !found && lookup != nil {
+			key := authorKey(*author)
+			if slackUserID, found = lookedUp[key]; !found {
+				slackUserID = lookup(*author)
+				lookedUp[key] = slackUserID
+			}
+			found = slackUserID != ""
+		}
+
+		if found {
+			author.SlackUserID = slackUserID
 			log.WithFields(log.Fields{
-				"commit_id":     commit.ID,
-				"email":         commit.Author.Email,
-				"slack_user_id": commit.Author.SlackUserID,
+				"commit_id":     commitID,
+				"email":         author.Email,
+				"slack_user_id": slackUserID,
 			}).Trace("hydrated commit author")
 		} else {
 			log.WithFields(log.Fields{
-				"commit_id": commit.ID,
-				"email":     commit.Author.Email,
+				"commit_id": commitID,
+				"email":     author.Email,
 			}).Trace("could not hydrate commit author")
 		}
 	}
+
+	for k := range c.Commits {
+		hydrate(c.Commits[k].ID, &c.Commits[k].Author)
+		for l := range c.Commits[k].CoAuthors {
+			hydrate(c.Commits[k].ID, &c.Commits[k].CoAuthors[l])
+		}
+	}
+}
+
+// UnmappedAuthors returns the authors and co-authors whose email addresses are
+// not part of the mapping, once each
+func (c Comparison) UnmappedAuthors(mapping map[string]string) (authors Authors) {
+	seen := make(map[string]bool)
+	for _, commit := range c.Commits {
+		for _, author := range append(Authors{commit.Author}, commit.CoAuthors...) {
+			if _, found := mapping[author.Email]; found || (author.Email == "" && author.Login == "") {
+				continue
+			}
+
+			if key := authorKey(author); !seen[key] {
+				seen[key] = true
+				authors = append(authors, author)
+			}
+		}
+	}
+	return
+}
+
+// authorKey identifies an author by its email address, the ones without email
+// address being told apart by their login, and then by their name
+func authorKey(author Author) string {
+	switch {
+	case author.Email != "":
+		return author.Email
+	case author.Login != "":
+		return "login:" + author.Login
+	default:
+		return "name:" + author.Name
+	}
+}
+
+// authorLabel is how an author which could not be resolved to a Slack user gets
+// displayed, using the same attributes as authorKey
+func authorLabel(author Author) string {
+	switch {
+	case author.Email != "":
+		return author.Email
+	case author.Login != "":
+		return author.Login
+	default:
+		return author.Name
+	}
+}
+
+// HydrateCommitsCoAuthors parses the Co-authored-by trailers of the commit messages
+// and attaches the co-authors to each commit
+func (c *Comparison) HydrateCommitsCoAuthors() {
+	for k, commit := range c.Commits {
+		c.Commits[k].CoAuthors = ParseCoAuthors(commit.Message)
+	}
+}
+
+// ParseCoAuthors returns the Authors referenced by the Co-authored-by trailers
+// of a commit message
+func ParseCoAuthors(msg string) (authors Authors) {
+	for _, m := range coAuthorTrailerPattern.FindAllStringSubmatch(msg, -1) {
+		authors = append(authors, Author{
+			Name:  m[1],
+			Email: m[2],
+		})
+	}
+	return
+}
+
+// HydrateCommitsIssues extracts the issues referenced within the commit messages
+// and attaches them to each commit as well as to the comparison (deduplicated)
+func (c *Comparison) HydrateCommitsIssues(its IssueTrackers, repo Repository) {
+	c.Issues = Issues{}
+	for k, commit := range c.Commits {
+		c.Commits[k].Issues = its.ExtractIssues(commit.Message, repo)
+		for _, issue := range c.Commits[k].Issues {
+			c.Issues = c.Issues.append(issue)
+		}
+
+		log.WithFields(log.Fields{
+			"commit_id": commit.ID,
+			"count":     len(c.Commits[k].Issues),
+		}).Trace("extracted commit issues")
+	}
 }
 
 // GetAuthors returns Authors who appeared to have make
 // contribution(s) in the comparison
 func (c Comparison) GetAuthors() (authors Authors) {
-	slackUserIDMapping := make(map[string]Author)
-	emailMapping := make(map[string]Author)
+	slackUserIDMapping := make(map[string]bool)
+	keyMapping := make(map[string]bool)
+	var unmappedAuthors Authors
+
+	// Authors are kept in order of appearance, the ones mapped to a Slack user first
 	for _, commit := range c.Commits {
-		if commit.Author.SlackUserID != "" {
-			if _, found := slackUserIDMapping[commit.Author.SlackUserID]; !found {
-				slackUserIDMapping[commit.Author.SlackUserID] = commit.Author
+		for _, author := range append(Authors{commit.Author}, commit.CoAuthors...) {
+			if author.SlackUserID != "" {
+				if !slackUserIDMapping[author.SlackUserID] {
+					slackUserIDMapping[author.SlackUserID] = true
+					authors = append(authors, author)
+				}
+				continue
 			}
-			continue
-		}
 
-		if _, found := emailMapping[commit.Author.Email]; !found {
-			emailMapping[commit.Author.Email] = commit.Author
+			if key := authorKey(author); !keyMapping[key] {
+				keyMapping[key] = true
+				unmappedAuthors = append(unmappedAuthors, author)
+			}
 		}
 	}
 
-	for _, author := range slackUserIDMapping {
-		authors = append(authors, author)
-	}
+	return append(authors, unmappedAuthors...)
+}
 
-	for _, author := range emailMapping {
-		authors = append(authors, author)
+// GetSlackUserCommits returns the commits of the comparison authored or
+// co-authored by a given Slack user
+func (c Comparison) GetSlackUserCommits(slackUserID string) (commits Commits) {
+	if slackUserID == "" {
+		return
 	}
 
+	for _, commit := range c.Commits {
+		for _, author := range append(Authors{commit.Author}, commit.CoAuthors...) {
+			if author.SlackUserID == slackUserID {
+				commits = append(commits, commit)
+				break
+			}
+		}
+	}
 	return
 }
 
@@ -127,10 +275,11 @@ func (c Comparison) AuthorsSlackString() (out string) {
 			out = "commit from "
 		}
 
+		authors := c.GetAuthors()
 		cursor := 0
-		for _, author := range c.GetAuthors() {
+		for _, author := range authors {
 			if cursor > 0 {
-				if cursor == len(c.GetAuthors())-1 || cursor == 7 {
+				if cursor == len(authors)-1 || cursor == 7 {
 					out += " and "
 				} else {
 					out += ", "
@@ -138,7 +287,7 @@ func (c Comparison) AuthorsSlackString() (out string) {
 			}
 
 			if cursor == 7 {
-				remainingCount := len(c.GetAuthors()) - cursor
+				remainingCount := len(authors) - cursor
 				out += fmt.Sprintf("%d other", remainingCount)
 				if remainingCount > 1 {
 					out += "s"
@@ -152,7 +301,7 @@ func (c Comparison) AuthorsSlackString() (out string) {
 				continue
 			}
 
-			out += fmt.Sprintf("_%s_", author.Email)
+			out += fmt.Sprintf("_%s_", authorLabel(author))
 		}
 	} else {
 		out = "no authors"
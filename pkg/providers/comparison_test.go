@@ -2,6 +2,7 @@ package providers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -53,4 +54,140 @@ func TestAuthorsSlackString(t *testing.T) {
 		},
 	})
 	assert.Equal(t, "commits from <@U123456789>, <@U234567891> and _alice@foo.baz_", c.AuthorsSlackString())
+
+	// Authors without email address are told apart by their login, and then by their name
+	c.Commits = append(c.Commits,
+		Commit{ID: "commit4", Author: Author{Login: "dave"}},
+		Commit{ID: "commit5", Author: Author{Login: "erin"}},
+		Commit{ID: "commit6", Author: Author{Login: "dave"}},
+		Commit{ID: "commit7", Author: Author{Name: "Frank"}},
+		Commit{ID: "commit8", Author: Author{Name: "Grace"}},
+	)
+	assert.Len(t, c.GetAuthors(), 7)
+	assert.Equal(t, "commits from <@U123456789>, <@U234567891>, _alice@foo.baz_, _dave_, _erin_, _Frank_ and _Grace_", c.AuthorsSlackString())
+}
+
+func TestComparisonOldestCommitCreatedAt(t *testing.T) {
+	assert.True(t, Comparison{}.OldestCommitCreatedAt().IsZero())
+
+	oldest := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	c := Comparison{
+		Commits: Commits{
+			{CreatedAt: oldest.Add(time.Hour)},
+			{CreatedAt: oldest},
+			{CreatedAt: oldest.Add(2 * time.Hour)},
+		},
+	}
+	assert.Equal(t, oldest, c.OldestCommitCreatedAt())
+}
+
+func TestGetSlackUserCommits(t *testing.T) {
+	c := Comparison{
+		Commits: Commits{
+			{ID: "1", Author: Author{SlackUserID: "U1"}},
+			{ID: "2", Author: Author{Email: "alice@foo.baz"}},
+			{ID: "3", Author: Author{SlackUserID: "U1"}},
+		},
+	}
+
+	commits := c.GetSlackUserCommits("U1")
+	assert.Len(t, commits, 2)
+	assert.Equal(t, "1", commits[0].ID)
+	assert.Equal(t, "3", commits[1].ID)
+	assert.Empty(t, c.GetSlackUserCommits(""))
+}
+
+func TestHydrateCommitsAuthorsWithSlackUserID(t *testing.T) {
+	c := Comparison{
+		Commits: Commits{
+			{Author: Author{Email: "alice@foo.baz"}},
+			{Author: Author{Email: "bob@foo.baz"}},
+			{Author: Author{Email: "bob@foo.baz"}},
+			{Author: Author{Email: "carol@foo.baz"}},
+		},
+	}
+
+	lookups := 0
+	c.HydrateCommitsAuthorsWithSlackUserID(map[string]string{"alice@foo.baz": "U1"}, func(author Author) string {
+		lookups++
+		if author.Email == "bob@foo.baz" {
+			return "U2"
+		}
+		return ""
+	})
+
+	assert.Equal(t, "U1", c.Commits[0].Author.SlackUserID)
+	assert.Equal(t, "U2", c.Commits[1].Author.SlackUserID)
+	assert.Equal(t, "U2", c.Commits[2].Author.SlackUserID)
+	assert.Equal(t, "", c.Commits[3].Author.SlackUserID)
+	assert.Equal(t, 2, lookups)
+
+	// Authors without email address are told apart by their login
+	c = Comparison{
+		Commits: Commits{
+			{Author: Author{Login: "dave"}},
+			{Author: Author{Login: "erin"}},
+		},
+	}
+	c.HydrateCommitsAuthorsWithSlackUserID(map[string]string{}, func(author Author) string {
+		if author.Login == "erin" {
+			return "U5"
+		}
+		return ""
+	})
+	assert.Equal(t, "", c.Commits[0].Author.SlackUserID)
+	assert.Equal(t, "U5", c.Commits[1].Author.SlackUserID)
+
+	// Without lookup
+	c = Comparison{Commits: Commits{{Author: Author{Email: "bob@foo.baz"}}}}
+	c.HydrateCommitsAuthorsWithSlackUserID(map[string]string{}, nil)
+	assert.Equal(t, "", c.Commits[0].Author.SlackUserID)
+}
+
+func TestParseCoAuthors(t *testing.T) {
+	assert.Equal(t, Authors{
+		{Name: "Alice", Email: "alice@foo.baz"},
+		{Name: "Bob Smith", Email: "12345+bob@users.noreply.github.com"},
+	}, ParseCoAuthors("feat: foo\n\nCo-authored-by: Alice <alice@foo.baz>\nco-authored-by:Bob Smith <12345+bob@users.noreply.github.com>  \nSigned-off-by: Carol <carol@foo.baz>"))
+
+	assert.Empty(t, ParseCoAuthors("feat: foo\n\nmentions Co-authored-by: Alice <alice@foo.baz>"))
+}
+
+func TestCoAuthors(t *testing.T) {
+	c := Comparison{
+		Commits: Commits{
+			{ID: "1", Author: Author{Email: "alice@foo.baz"}, Message: "feat: foo\n\nCo-authored-by: Bob <bob@foo.baz>"},
+			{ID: "2", Author: Author{Email: "carol@foo.baz"}},
+		},
+	}
+
+	c.HydrateCommitsCoAuthors()
+	c.HydrateCommitsAuthorsWithSlackUserID(map[string]string{"bob@foo.baz": "U2"}, nil)
+
+	assert.Equal(t, "U2", c.Commits[0].CoAuthors[0].SlackUserID)
+	assert.Equal(t, "commits from <@U2>, _alice@foo.baz_ and _carol@foo.baz_", c.AuthorsSlackString())
+
+	commits := c.GetSlackUserCommits("U2")
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "1", commits[0].ID)
+	}
+}
+
+func TestUnmappedAuthors(t *testing.T) {
+	c := Comparison{
+		Commits: Commits{
+			{Author: Author{Email: "alice@foo.baz"}, CoAuthors: Authors{{Email: "bob@foo.baz"}}},
+			{Author: Author{Email: "bob@foo.baz"}},
+			{Author: Author{Login: "carol"}},
+			{Author: Author{Login: "dave"}},
+			{Author: Author{Login: "carol"}},
+			{Author: Author{}},
+		},
+	}
+
+	assert.Equal(t, Authors{
+		{Email: "bob@foo.baz"},
+		{Login: "carol"},
+		{Login: "dave"},
+	}, c.UnmappedAuthors(map[string]string{"alice@foo.baz": "U1"}))
 }
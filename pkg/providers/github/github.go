@@ -3,8 +3,11 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 
@@ -13,24 +16,36 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// noReplyEmailPattern matches the noreply email addresses of GitHub users
+var noReplyEmailPattern = regexp.MustCompile(`^(?:\d+\+)?([^@]+)@users\.noreply\.`)
+
 // Provider implements the Provider interface for GitHub
 type Provider struct {
-	ctx        context.Context
-	client     *github.Client
-	orgs       []string
-	webBaseURL string
+	ctx         context.Context
+	client      *github.Client
+	orgs        []string
+	webBaseURL  string
+	rateLimiter *providers.RateLimiter
 }
 
 // NewProvider returns a new Provider with a new GitHub client instanciation and
-// associated config
-func NewProvider(ctx context.Context, token, baseURL string, orgs []string) (p Provider, err error) {
+// associated config, its API calls go through the RateLimiter and are bounded
+// by the timeout
+func NewProvider(ctx context.Context, token, baseURL string, orgs []string, rl *providers.RateLimiter, timeout time.Duration) (p Provider, err error) {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
+	tc := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: ts,
+			Base:   rl,
+		},
+		Timeout: timeout,
+	}
 
 	p.ctx = ctx
 	p.client = github.NewClient(tc)
+	p.rateLimiter = rl
 
 	if baseURL != "" {
 		p.client.BaseURL, err = url.Parse(baseURL)
@@ -56,54 +71,87 @@ func (p Provider) WebBaseURL() string {
 	return p.webBaseURL
 }
 
+// RateLimiter returns the RateLimiter the API calls go through
+func (p Provider) RateLimiter() *providers.RateLimiter {
+	return p.rateLimiter
+}
+
 // ListRepositories returns the list of all projects which belong to
-// the organizations configured
-func (p Provider) ListRepositories() (repos providers.Repositories, err error) {
-	repos = make(providers.Repositories)
-	var fetchedRepos []*github.Repository
-	var resp *github.Response
+// the organizations configured, the failure of an organization does not
+// prevent the others from being listed
+func (p Provider) ListRepositories() providers.RepositoriesListing {
+	return p.ListRepositoriesWithContext(p.ctx)
+}
 
+// ListRepositoriesWithContext is ListRepositories bound to a context
+func (p Provider) ListRepositoriesWithContext(ctx context.Context) (l providers.RepositoriesListing) {
+	l = providers.NewRepositoriesListing()
 	for _, org := range p.orgs {
 		log.WithFields(log.Fields{
 			"provider": providers.ProviderTypeGitHub,
 			"org":      org,
 		}).Debug("fetching projects")
 
-		opts := &github.RepositoryListByOrgOptions{
-			ListOptions: github.ListOptions{
-				Page:    1,
-				PerPage: 100,
-			},
+		repos, err := p.listOrgRepositories(ctx, org)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"provider": providers.ProviderTypeGitHub,
+				"org":      org,
+			}).Warning("fetching projects")
 		}
 
-		for {
-			fetchedRepos, resp, err = p.client.Repositories.ListByOrg(p.ctx, org, opts)
-			if err != nil {
-				return
-			}
+		l.Merge(providers.RepositoriesListing{
+			Repositories: repos,
+			Sources: map[providers.RepositoriesSource]error{
+				{ProviderType: providers.ProviderTypeGitHub, Owner: org}: err,
+			},
+		})
+	}
 
-			for _, repo := range fetchedRepos {
-				r := providers.Repository{
-					ProviderType: providers.ProviderTypeGitHub,
-					Name:         *repo.FullName,
-					WebURL:       *repo.URL,
-				}
-				repos[r.Key()] = r
-			}
+	return
+}
 
-			if resp.NextPage == 0 {
-				break
+// listOrgRepositories returns the repositories of an organization, or none if
+// any of the pages cannot be fetched
+func (p Provider) listOrgRepositories(ctx context.Context, org string) (providers.Repositories, error) {
+	repos := make(providers.Repositories)
+	opts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{
+			Page:    1,
+			PerPage: 100,
+		},
+	}
+
+	for {
+		fetchedRepos, resp, err := p.client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range fetchedRepos {
+			r := providers.Repository{
+				ProviderType: providers.ProviderTypeGitHub,
+				Name:         *repo.FullName,
+				WebURL:       *repo.URL,
 			}
+			repos[r.Key()] = r
+		}
 
-			opts.Page++
+		if resp.NextPage == 0 {
+			return repos, nil
 		}
-	}
 
-	return
+		opts.Page++
+	}
 }
 
 // Compare calculates the diff between two git references
-func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *providers.Comparison, err error) {
+func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (*providers.Comparison, error) {
+	return p.CompareWithContext(p.ctx, project, fromRef, toRef)
+}
+
+// CompareWithContext is Compare bound to a context
+func (p Provider) CompareWithContext(ctx context.Context, project string, fromRef, toRef providers.Ref) (cmp *providers.Comparison, err error) {
 	cmp = &providers.Comparison{}
 
 	projectValues := strings.Split(project, "/")
@@ -113,11 +161,11 @@ func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *pr
 	}
 
 	var githubCompare *github.CommitsComparison
-	if githubCompare, _, err = p.client.Repositories.CompareCommits(p.ctx, projectValues[0], projectValues[1], fromRef.Name, toRef.Name); err != nil {
+	if githubCompare, _, err = p.client.Repositories.CompareCommits(ctx, projectValues[0], projectValues[1], fromRef.Name, toRef.Name); err != nil {
 		return
 	}
 
-	cmp.WebURL = fmt.Sprintf("%s/%s/compare/%s...%s", p.WebBaseURL(), project, fromRef.Name, toRef.Name)
+	cmp.WebURL = p.CompareWebURL(project, fromRef, toRef)
 	for _, commit := range githubCompare.Commits {
 		cmp.Commits = append(cmp.Commits, providers.Commit{
 			ID:      commit.GetSHA(),
@@ -125,8 +173,9 @@ func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *pr
 			Author: providers.Author{
 				Name:  *commit.Commit.GetAuthor().Name,
 				Email: *commit.Commit.GetAuthor().Email,
+				Login: commit.GetAuthor().GetLogin(),
 			},
-			CreatedAt: commit.Committer.GetCreatedAt().Time,
+			CreatedAt: commit.Commit.GetCommitter().GetDate(),
 			Message:   commit.Commit.GetMessage(),
 			WebURL:    commit.GetURL(),
 		})
@@ -135,8 +184,56 @@ func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *pr
 	return
 }
 
+// CompareWebURL returns the URL of the comparison of two git references
+func (p Provider) CompareWebURL(project string, fromRef, toRef providers.Ref) string {
+	return fmt.Sprintf("%s/%s/compare/%s...%s", p.WebBaseURL(), project, fromRef.Name, toRef.Name)
+}
+
+// ListUserEmails returns the public email address of the GitHub account behind
+// a commit author, identified by its login or its noreply email address
+func (p Provider) ListUserEmails(author providers.Author) ([]string, error) {
+	return p.ListUserEmailsWithContext(p.ctx, author)
+}
+
+// ListUserEmailsWithContext is ListUserEmails bound to a context
+func (p Provider) ListUserEmailsWithContext(ctx context.Context, author providers.Author) (emails []string, err error) {
+	login := author.Login
+	if login == "" {
+		login = loginFromNoReplyEmail(author.Email)
+	}
+
+	if login == "" {
+		return
+	}
+
+	var u *github.User
+	if u, _, err = p.client.Users.Get(ctx, login); err != nil {
+		return
+	}
+
+	if u.GetEmail() != "" {
+		emails = append(emails, u.GetEmail())
+	}
+
+	return
+}
+
+// loginFromNoReplyEmail returns the login of a GitHub user given its noreply
+// email address (eg: 12345+alice@users.noreply.github.com)
+func loginFromNoReplyEmail(email string) string {
+	if m := noReplyEmailPattern.FindStringSubmatch(email); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
 // ListRefs returns all the Refs for a given project
-func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
+func (p Provider) ListRefs(project string) (providers.Refs, error) {
+	return p.ListRefsWithContext(p.ctx, project)
+}
+
+// ListRefsWithContext is ListRefs bound to a context
+func (p Provider) ListRefsWithContext(ctx context.Context, project string) (refs providers.Refs, err error) {
 	projectValues := strings.Split(project, "/")
 	if len(projectValues) != 2 {
 		err = fmt.Errorf("invalid project name '%s'", project)
@@ -144,7 +241,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 	}
 
 	refs = make(providers.Refs)
-	branches, err := p.ListRepositoryBranches(projectValues[0], projectValues[1])
+	branches, err := p.ListRepositoryBranches(ctx, projectValues[0], projectValues[1])
 	if err != nil {
 		return
 	}
@@ -153,7 +250,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 		refs[k] = r
 	}
 
-	tags, err := p.ListRepositoryTags(projectValues[0], projectValues[1])
+	tags, err := p.ListRepositoryTags(ctx, projectValues[0], projectValues[1])
 	if err != nil {
 		return
 	}
@@ -166,7 +263,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 }
 
 // ListRepositoryBranches returns all the branches for a given repository
-func (p Provider) ListRepositoryBranches(owner, repo string) (refs providers.Refs, err error) {
+func (p Provider) ListRepositoryBranches(ctx context.Context, owner, repo string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
 	opts := &github.BranchListOptions{
 		ListOptions: github.ListOptions{
@@ -178,17 +275,19 @@ func (p Provider) ListRepositoryBranches(owner, repo string) (refs providers.Ref
 	for {
 		var foundBranches []*github.Branch
 		var resp *github.Response
-		foundBranches, resp, err = p.client.Repositories.ListBranches(p.ctx, owner, repo, opts)
+		foundBranches, resp, err = p.client.Repositories.ListBranches(ctx, owner, repo, opts)
 		if err != nil {
 			return
 		}
 
 		for _, branch := range foundBranches {
+			// The commit of the branches only contains its SHA
 			ref := providers.Ref{
 				Name: *branch.Name,
 				Type: providers.RefTypeBranch,
 				// TODO: compute something more pertinent
 				WebURL: p.webBaseURL,
+				SHA:    branch.GetCommit().GetSHA(),
 			}
 			refs[ref.Key()] = ref
 		}
@@ -204,7 +303,7 @@ func (p Provider) ListRepositoryBranches(owner, repo string) (refs providers.Ref
 }
 
 // ListRepositoryTags returns all the tags for a given repository
-func (p *Provider) ListRepositoryTags(owner, repo string) (refs providers.Refs, err error) {
+func (p *Provider) ListRepositoryTags(ctx context.Context, owner, repo string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
 	opts := &github.ListOptions{
 		Page:    1,
@@ -214,17 +313,19 @@ func (p *Provider) ListRepositoryTags(owner, repo string) (refs providers.Refs,
 	for {
 		var foundTags []*github.RepositoryTag
 		var resp *github.Response
-		foundTags, resp, err = p.client.Repositories.ListTags(p.ctx, owner, repo, opts)
+		foundTags, resp, err = p.client.Repositories.ListTags(ctx, owner, repo, opts)
 		if err != nil {
 			return
 		}
 
 		for _, tag := range foundTags {
+			// The commit of the tags only contains its SHA
 			ref := providers.Ref{
 				Name: *tag.Name,
 				Type: providers.RefTypeTag,
 				// TODO: Provide the correct URL
 				WebURL: p.webBaseURL,
+				SHA:    tag.GetCommit().GetSHA(),
 			}
 			refs[ref.Key()] = ref
 		}
@@ -238,3 +339,111 @@ func (p *Provider) ListRepositoryTags(owner, repo string) (refs providers.Refs,
 
 	return
 }
+
+// GetCommitSHA returns the SHA of the commit a given ref points to, through a
+// single call which is far cheaper than fetching its status
+func (p Provider) GetCommitSHA(project string, ref providers.Ref) (string, error) {
+	return p.GetCommitSHAWithContext(p.ctx, project, ref)
+}
+
+// GetCommitSHAWithContext is GetCommitSHA bound to a context
+func (p Provider) GetCommitSHAWithContext(ctx context.Context, project string, ref providers.Ref) (sha string, err error) {
+	projectValues := strings.Split(project, "/")
+	if len(projectValues) != 2 {
+		err = fmt.Errorf("invalid project name '%s'", project)
+		return
+	}
+
+	sha, _, err = p.client.Repositories.GetCommitSHA1(ctx, projectValues[0], projectValues[1], ref.Name, "")
+	return
+}
+
+// GetCommitStatus returns the combined status of the commit statuses and
+// check runs of the head commit of a given ref
+func (p Provider) GetCommitStatus(project string, ref providers.Ref) (providers.CommitStatus, error) {
+	return p.GetCommitStatusWithContext(p.ctx, project, ref)
+}
+
+// GetCommitStatusWithContext is GetCommitStatus bound to a context
+func (p Provider) GetCommitStatusWithContext(ctx context.Context, project string, ref providers.Ref) (cs providers.CommitStatus, err error) {
+	projectValues := strings.Split(project, "/")
+	if len(projectValues) != 2 {
+		err = fmt.Errorf("invalid project name '%s'", project)
+		return
+	}
+
+	var combinedStatus *github.CombinedStatus
+	if combinedStatus, _, err = p.client.Repositories.GetCombinedStatus(ctx, projectValues[0], projectValues[1], ref.Name, &github.ListOptions{PerPage: 100}); err != nil {
+		return
+	}
+
+	// When no statuses are defined, GitHub returns a "pending" state
+	if combinedStatus.GetTotalCount() > 0 {
+		cs.State = commitStatusStateFromString(combinedStatus.GetState())
+	}
+
+	cs.SHA = combinedStatus.GetSHA()
+
+	opts := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{
+			Page:    1,
+			PerPage: 100,
+		},
+	}
+
+	for {
+		var checkRuns *github.ListCheckRunsResults
+		var resp *github.Response
+		if checkRuns, resp, err = p.client.Checks.ListCheckRunsForRef(ctx, projectValues[0], projectValues[1], ref.Name, opts); err != nil {
+			return
+		}
+
+		for _, checkRun := range checkRuns.CheckRuns {
+			cs.State = cs.State.Merge(commitStatusStateFromCheckRun(checkRun))
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page++
+	}
+
+	if cs.SHA != "" {
+		cs.WebURL = fmt.Sprintf("%s/%s/commit/%s", strings.TrimSuffix(p.WebBaseURL(), "/"), project, cs.SHA)
+	}
+
+	return
+}
+
+func commitStatusStateFromString(state string) providers.CommitStatusState {
+	switch state {
+	case "success":
+		return providers.CommitStatusStateSuccess
+	case "pending", "queued", "waiting", "requested":
+		// Including the checks waiting for a manual approval, as the manual
+		// GitLab pipelines
+		return providers.CommitStatusStatePending
+	case "in_progress":
+		return providers.CommitStatusStateRunning
+	case "failure", "error", "timed_out", "action_required":
+		return providers.CommitStatusStateFailure
+	case "cancelled", "stale":
+		return providers.CommitStatusStateCanceled
+	case "neutral":
+		return providers.CommitStatusStateSuccess
+	case "skipped":
+		// Conditional jobs which did not run should not alter the state of the others
+		return providers.CommitStatusStateUnknown
+	}
+
+	return providers.CommitStatusStateUnknown
+}
+
+func commitStatusStateFromCheckRun(checkRun *github.CheckRun) providers.CommitStatusState {
+	if checkRun.GetStatus() != "completed" {
+		return commitStatusStateFromString(checkRun.GetStatus())
+	}
+
+	return commitStatusStateFromString(checkRun.GetConclusion())
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 
+	"github.com/google/go-github/v33/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,3 +13,42 @@ func TestType(t *testing.T) {
 	p := Provider{}
 	assert.Equal(t, providers.ProviderTypeGitHub, p.Type())
 }
+
+func TestCompareWebURL(t *testing.T) {
+	p := Provider{webBaseURL: "https://github.com"}
+	assert.Equal(t, "https://github.com/foo/bar/compare/v1.0.0...main", p.CompareWebURL("foo/bar", providers.Ref{Name: "v1.0.0"}, providers.Ref{Name: "main"}))
+}
+
+func TestLoginFromNoReplyEmail(t *testing.T) {
+	assert.Equal(t, "alice", loginFromNoReplyEmail("12345+alice@users.noreply.github.com"))
+	assert.Equal(t, "bob", loginFromNoReplyEmail("bob@users.noreply.github.com"))
+	assert.Equal(t, "", loginFromNoReplyEmail("alice@example.com"))
+}
+
+func TestCommitStatusStateFromCheckRun(t *testing.T) {
+	for status, expected := range map[[2]string]providers.CommitStatusState{
+		{"queued", ""}:                 providers.CommitStatusStatePending,
+		{"waiting", ""}:                providers.CommitStatusStatePending,
+		{"in_progress", ""}:            providers.CommitStatusStateRunning,
+		{"completed", "success"}:       providers.CommitStatusStateSuccess,
+		{"completed", "neutral"}:       providers.CommitStatusStateSuccess,
+		{"completed", "failure"}:       providers.CommitStatusStateFailure,
+		{"completed", "timed_out"}:     providers.CommitStatusStateFailure,
+		{"completed", "cancelled"}:     providers.CommitStatusStateCanceled,
+		{"completed", "skipped"}:       providers.CommitStatusStateUnknown,
+		{"completed", "something_new"}: providers.CommitStatusStateUnknown,
+	} {
+		assert.Equal(t, expected, commitStatusStateFromCheckRun(&github.CheckRun{
+			Status:     github.String(status[0]),
+			Conclusion: github.String(status[1]),
+		}), status)
+	}
+
+	// Skipped check runs do not alter the state of the others
+	state := providers.CommitStatusStateSuccess
+	state = state.Merge(commitStatusStateFromCheckRun(&github.CheckRun{
+		Status:     github.String("completed"),
+		Conclusion: github.String("skipped"),
+	}))
+	assert.Equal(t, providers.CommitStatusStateSuccess, state)
+}
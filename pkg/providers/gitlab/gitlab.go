@@ -1,8 +1,12 @@
 package gitlab
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 
@@ -10,28 +14,38 @@ import (
 	"github.com/xanzy/go-gitlab"
 )
 
+// noReplyEmailPattern matches the private commit email addresses of GitLab users
+var noReplyEmailPattern = regexp.MustCompile(`^\d+-([^@]+)@users\.noreply\.`)
+
 // Provider implements the Provider interface for GitLab
 type Provider struct {
-	client     *gitlab.Client
-	groups     []string
-	webBaseURL string
+	client      *gitlab.Client
+	groups      []string
+	webBaseURL  string
+	rateLimiter *providers.RateLimiter
 }
 
 // NewProvider returns a new Provider with a new GitLab client instanciation and
-// associated config
-func NewProvider(token, baseURL string, groups []string) (p Provider, err error) {
+// associated config, its API calls go through the RateLimiter and are bounded
+// by the timeout
+func NewProvider(token, baseURL string, groups []string, rl *providers.RateLimiter, timeout time.Duration) (p Provider, err error) {
 	if baseURL != "" {
 		p.webBaseURL = baseURL
 	} else {
 		p.webBaseURL = "https://gitlab.com"
 	}
 
+	// The retries are handled by the RateLimiter, which is aware of the budget
+	// shared with the background tasks
 	p.client, err = gitlab.NewClient(
 		token,
 		gitlab.WithBaseURL(p.webBaseURL),
+		gitlab.WithHTTPClient(&http.Client{Transport: rl, Timeout: timeout}),
 		gitlab.WithoutRetries(),
 	)
 
+	p.rateLimiter = rl
+
 	p.groups = groups
 	return
 }
@@ -46,78 +60,102 @@ func (p Provider) WebBaseURL() string {
 	return p.webBaseURL
 }
 
+// RateLimiter returns the RateLimiter the API calls go through
+func (p Provider) RateLimiter() *providers.RateLimiter {
+	return p.rateLimiter
+}
+
 // ListRepositories returns the list of all non archived projects which belong to
-// the groups configured as well as their subgroups
-func (p Provider) ListRepositories() (repos providers.Repositories, err error) {
-	repos = make(providers.Repositories)
-	var fetchedRepos []*gitlab.Project
-	var resp *gitlab.Response
+// the groups configured as well as their subgroups, the failure of a group does
+// not prevent the others from being listed
+func (p Provider) ListRepositories() providers.RepositoriesListing {
+	return p.ListRepositoriesWithContext(context.Background())
+}
 
+// ListRepositoriesWithContext is ListRepositories bound to a context
+func (p Provider) ListRepositoriesWithContext(ctx context.Context) (l providers.RepositoriesListing) {
+	l = providers.NewRepositoriesListing()
 	for _, group := range p.groups {
 		log.WithFields(log.Fields{
 			"provider": providers.ProviderTypeGitLab,
 			"group":    group,
 		}).Debug("fetching projects")
 
-		opts := &gitlab.ListGroupProjectsOptions{
-			ListOptions: gitlab.ListOptions{
-				Page:    1,
-				PerPage: 100,
-			},
-			Archived:         gitlab.Bool(false),
-			IncludeSubgroups: gitlab.Bool(true),
-			WithShared:       gitlab.Bool(false),
+		repos, err := p.listGroupRepositories(ctx, group)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"provider": providers.ProviderTypeGitLab,
+				"group":    group,
+			}).Warning("fetching projects")
 		}
 
-		for {
-			fetchedRepos, resp, err = p.client.Groups.ListGroupProjects(group, opts)
-			if err != nil {
-				return
-			}
+		l.Merge(providers.RepositoriesListing{
+			Repositories: repos,
+			Sources: map[providers.RepositoriesSource]error{
+				{ProviderType: providers.ProviderTypeGitLab, Owner: group}: err,
+			},
+		})
+	}
 
-			for _, repo := range fetchedRepos {
-				r := providers.Repository{
-					ProviderType: providers.ProviderTypeGitLab,
-					Name:         repo.PathWithNamespace,
-					WebURL:       repo.WebURL,
-				}
-				repos[r.Key()] = r
-			}
+	return
+}
+
+// listGroupRepositories returns the repositories of a group, or none if any of
+// the pages cannot be fetched
+func (p Provider) listGroupRepositories(ctx context.Context, group string) (providers.Repositories, error) {
+	repos := make(providers.Repositories)
+	opts := &gitlab.ListGroupProjectsOptions{
+		ListOptions: gitlab.ListOptions{
+			Page:    1,
+			PerPage: 100,
+		},
+		Archived:         gitlab.Bool(false),
+		IncludeSubgroups: gitlab.Bool(true),
+		WithShared:       gitlab.Bool(false),
+	}
+
+	for {
+		fetchedRepos, resp, err := p.client.Groups.ListGroupProjects(group, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
 
-			if resp.NextPage == 0 {
-				break
+		for _, repo := range fetchedRepos {
+			r := providers.Repository{
+				ProviderType: providers.ProviderTypeGitLab,
+				Name:         repo.PathWithNamespace,
+				WebURL:       repo.WebURL,
 			}
+			repos[r.Key()] = r
+		}
 
-			opts.Page++
+		if resp.NextPage == 0 {
+			return repos, nil
 		}
-	}
 
-	return
+		opts.Page++
+	}
 }
 
 // Compare calculates the diff between two git references
-func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *providers.Comparison, err error) {
-	cmp = &providers.Comparison{}
-	opts := &gitlab.CompareOptions{}
-
-	if fromRef.OriginRef != nil {
-		opts.From = gitlab.String(fromRef.OriginRef.Name)
-	} else {
-		opts.From = gitlab.String(fromRef.Name)
-	}
+func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (*providers.Comparison, error) {
+	return p.CompareWithContext(context.Background(), project, fromRef, toRef)
+}
 
-	if toRef.OriginRef != nil {
-		opts.To = gitlab.String(toRef.OriginRef.Name)
-	} else {
-		opts.To = gitlab.String(toRef.Name)
+// CompareWithContext is Compare bound to a context
+func (p Provider) CompareWithContext(ctx context.Context, project string, fromRef, toRef providers.Ref) (cmp *providers.Comparison, err error) {
+	cmp = &providers.Comparison{}
+	opts := &gitlab.CompareOptions{
+		From: gitlab.String(gitRefName(fromRef)),
+		To:   gitlab.String(gitRefName(toRef)),
 	}
 
 	var gitlabCompare *gitlab.Compare
-	if gitlabCompare, _, err = p.client.Repositories.Compare(project, opts); err != nil {
+	if gitlabCompare, _, err = p.client.Repositories.Compare(project, opts, gitlab.WithContext(ctx)); err != nil {
 		return
 	}
 
-	cmp.WebURL = fmt.Sprintf("%s/%s/-/compare/%s...%s", p.WebBaseURL(), project, *opts.From, *opts.To)
+	cmp.WebURL = p.CompareWebURL(project, fromRef, toRef)
 	for _, commit := range gitlabCompare.Commits {
 		cmp.Commits = append(cmp.Commits, providers.Commit{
 			ID:      commit.ID,
@@ -135,10 +173,136 @@ func (p Provider) Compare(project string, fromRef, toRef providers.Ref) (cmp *pr
 	return
 }
 
+// CompareWebURL returns the URL of the comparison of two git references
+func (p Provider) CompareWebURL(project string, fromRef, toRef providers.Ref) string {
+	return fmt.Sprintf("%s/%s/-/compare/%s...%s", p.WebBaseURL(), project, gitRefName(fromRef), gitRefName(toRef))
+}
+
+// ListUserEmails returns the public email addresses (and the private ones when
+// using an admin token) of the GitLab users matching a commit author, identified
+// by its username, its noreply email address or its email address
+func (p Provider) ListUserEmails(author providers.Author) ([]string, error) {
+	return p.ListUserEmailsWithContext(context.Background(), author)
+}
+
+// ListUserEmailsWithContext is ListUserEmails bound to a context
+func (p Provider) ListUserEmailsWithContext(ctx context.Context, author providers.Author) (emails []string, err error) {
+	username := author.Login
+	if username == "" {
+		username = usernameFromNoReplyEmail(author.Email)
+	}
+
+	opts := &gitlab.ListUsersOptions{}
+	switch {
+	case username != "":
+		opts.Username = gitlab.String(username)
+	case author.Email != "":
+		opts.Search = gitlab.String(author.Email)
+	default:
+		return
+	}
+
+	var users []*gitlab.User
+	if users, _, err = p.client.Users.ListUsers(opts, gitlab.WithContext(ctx)); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range users {
+		for _, email := range []string{u.PublicEmail, u.Email} {
+			if email != "" && !seen[email] {
+				seen[email] = true
+				emails = append(emails, email)
+			}
+		}
+	}
+
+	return
+}
+
+// usernameFromNoReplyEmail returns the username of a GitLab user given its
+// noreply email address (eg: 12345-alice@users.noreply.gitlab.com)
+func usernameFromNoReplyEmail(email string) string {
+	if m := noReplyEmailPattern.FindStringSubmatch(email); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// GetCommitSHA returns the SHA of the commit a given ref points to
+func (p Provider) GetCommitSHA(project string, ref providers.Ref) (string, error) {
+	return p.GetCommitSHAWithContext(context.Background(), project, ref)
+}
+
+// GetCommitSHAWithContext is GetCommitSHA bound to a context
+func (p Provider) GetCommitSHAWithContext(ctx context.Context, project string, ref providers.Ref) (sha string, err error) {
+	var commit *gitlab.Commit
+	if commit, _, err = p.client.Commits.GetCommit(project, gitRefName(ref), gitlab.WithContext(ctx)); err != nil {
+		return
+	}
+	return commit.ID, nil
+}
+
+// GetCommitStatus returns the status of the last pipeline which ran against
+// the head commit of a given ref
+func (p Provider) GetCommitStatus(project string, ref providers.Ref) (providers.CommitStatus, error) {
+	return p.GetCommitStatusWithContext(context.Background(), project, ref)
+}
+
+// GetCommitStatusWithContext is GetCommitStatus bound to a context
+func (p Provider) GetCommitStatusWithContext(ctx context.Context, project string, ref providers.Ref) (cs providers.CommitStatus, err error) {
+	var commit *gitlab.Commit
+	if commit, _, err = p.client.Commits.GetCommit(project, gitRefName(ref), gitlab.WithContext(ctx)); err != nil {
+		return
+	}
+
+	cs.SHA = commit.ID
+	if commit.LastPipeline != nil {
+		cs.State = commitStatusStateFromPipelineStatus(commit.LastPipeline.Status)
+		cs.WebURL = commit.LastPipeline.WebURL
+	}
+
+	return
+}
+
+func commitStatusStateFromPipelineStatus(status string) providers.CommitStatusState {
+	switch status {
+	case "success":
+		return providers.CommitStatusStateSuccess
+	case "created", "waiting_for_resource", "preparing", "pending", "scheduled", "manual":
+		return providers.CommitStatusStatePending
+	case "running":
+		return providers.CommitStatusStateRunning
+	case "failed":
+		return providers.CommitStatusStateFailure
+	case "canceled":
+		return providers.CommitStatusStateCanceled
+	case "skipped":
+		// Consistently with the GitHub checks which got skipped
+		return providers.CommitStatusStateUnknown
+	}
+
+	return providers.CommitStatusStateUnknown
+}
+
+// gitRefName returns the name of the git ref to use when querying the API,
+// environments are resolved onto the commit they are pointing to
+func gitRefName(ref providers.Ref) string {
+	if ref.OriginRef != nil {
+		return ref.OriginRef.Name
+	}
+	return ref.Name
+}
+
 // ListRefs returns all the Refs for a given project
-func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
+func (p Provider) ListRefs(project string) (providers.Refs, error) {
+	return p.ListRefsWithContext(context.Background(), project)
+}
+
+// ListRefsWithContext is ListRefs bound to a context
+func (p Provider) ListRefsWithContext(ctx context.Context, project string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
-	branches, err := p.ListProjectBranches(project)
+	branches, err := p.ListProjectBranches(ctx, project)
 	if err != nil {
 		return
 	}
@@ -147,7 +311,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 		refs[k] = r
 	}
 
-	tags, err := p.ListProjectTags(project)
+	tags, err := p.ListProjectTags(ctx, project)
 	if err != nil {
 		return
 	}
@@ -156,7 +320,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 		refs[k] = r
 	}
 
-	envs, err := p.ListProjectEnvironments(project)
+	envs, err := p.ListProjectEnvironments(ctx, project)
 	if err != nil {
 		return
 	}
@@ -169,7 +333,7 @@ func (p Provider) ListRefs(project string) (refs providers.Refs, err error) {
 }
 
 // ListProjectBranches returns all the branches for a given project
-func (p Provider) ListProjectBranches(projectName string) (refs providers.Refs, err error) {
+func (p Provider) ListProjectBranches(ctx context.Context, projectName string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
 	opts := &gitlab.ListBranchesOptions{
 		ListOptions: gitlab.ListOptions{
@@ -181,7 +345,7 @@ func (p Provider) ListProjectBranches(projectName string) (refs providers.Refs,
 	for {
 		var foundBranches []*gitlab.Branch
 		var resp *gitlab.Response
-		foundBranches, resp, err = p.client.Branches.ListBranches(projectName, opts)
+		foundBranches, resp, err = p.client.Branches.ListBranches(projectName, opts, gitlab.WithContext(ctx))
 		if err != nil {
 			return
 		}
@@ -192,6 +356,7 @@ func (p Provider) ListProjectBranches(projectName string) (refs providers.Refs,
 				Type:   providers.RefTypeBranch,
 				WebURL: branch.WebURL,
 			}
+			setRefHeadCommit(&ref, branch.Commit)
 			refs[ref.Key()] = ref
 		}
 
@@ -206,7 +371,7 @@ func (p Provider) ListProjectBranches(projectName string) (refs providers.Refs,
 }
 
 // ListProjectTags returns all the tags for a given project
-func (p *Provider) ListProjectTags(projectName string) (refs providers.Refs, err error) {
+func (p *Provider) ListProjectTags(ctx context.Context, projectName string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
 	opts := &gitlab.ListTagsOptions{
 		ListOptions: gitlab.ListOptions{
@@ -218,7 +383,7 @@ func (p *Provider) ListProjectTags(projectName string) (refs providers.Refs, err
 	for {
 		var foundTags []*gitlab.Tag
 		var resp *gitlab.Response
-		foundTags, resp, err = p.client.Tags.ListTags(projectName, opts)
+		foundTags, resp, err = p.client.Tags.ListTags(projectName, opts, gitlab.WithContext(ctx))
 		if err != nil {
 			return
 		}
@@ -230,6 +395,7 @@ func (p *Provider) ListProjectTags(projectName string) (refs providers.Refs, err
 				// TODO: Provide the correct URL
 				WebURL: tag.Commit.WebURL,
 			}
+			setRefHeadCommit(&ref, tag.Commit)
 			refs[ref.Key()] = ref
 		}
 
@@ -244,7 +410,7 @@ func (p *Provider) ListProjectTags(projectName string) (refs providers.Refs, err
 
 // ListProjectEnvironments returns all the "available" environments for a given project.
 // It omits environments which start with "review/"
-func (p *Provider) ListProjectEnvironments(project string) (refs providers.Refs, err error) {
+func (p *Provider) ListProjectEnvironments(ctx context.Context, project string) (refs providers.Refs, err error) {
 	refs = make(providers.Refs)
 	opts := &gitlab.ListEnvironmentsOptions{
 		ListOptions: gitlab.ListOptions{
@@ -256,7 +422,7 @@ func (p *Provider) ListProjectEnvironments(project string) (refs providers.Refs,
 	for {
 		var foundEnvs []*gitlab.Environment
 		var resp *gitlab.Response
-		foundEnvs, resp, err = p.client.Environments.ListEnvironments(project, opts)
+		foundEnvs, resp, err = p.client.Environments.ListEnvironments(project, opts, gitlab.WithContext(ctx))
 		if err != nil {
 			return
 		}
@@ -264,7 +430,7 @@ func (p *Provider) ListProjectEnvironments(project string) (refs providers.Refs,
 		for _, env := range foundEnvs {
 			if env.State == "available" && !strings.HasPrefix("review/", env.Name) {
 				var envDetails *gitlab.Environment
-				envDetails, resp, err = p.client.Environments.GetEnvironment(project, env.ID)
+				envDetails, resp, err = p.client.Environments.GetEnvironment(project, env.ID, gitlab.WithContext(ctx))
 				if err != nil {
 					return
 				}
@@ -280,6 +446,7 @@ func (p *Provider) ListProjectEnvironments(project string) (refs providers.Refs,
 							Type: providers.RefTypeCommit,
 						},
 					}
+					setRefHeadCommit(&ref, envDetails.LastDeployment.Deployable.Commit)
 					refs[ref.Key()] = ref
 				}
 			}
@@ -293,3 +460,23 @@ func (p *Provider) ListProjectEnvironments(project string) (refs providers.Refs,
 
 	return
 }
+
+// setRefHeadCommit sets the details of the commit onto which the ref is pointing to
+func setRefHeadCommit(ref *providers.Ref, commit *gitlab.Commit) {
+	if commit == nil {
+		return
+	}
+
+	ref.SHA = commit.ID
+	ref.Author = providers.Author{
+		Name:  commit.AuthorName,
+		Email: commit.AuthorEmail,
+	}
+
+	switch {
+	case commit.CommittedDate != nil:
+		ref.CommittedAt = *commit.CommittedDate
+	case commit.CreatedAt != nil:
+		ref.CommittedAt = *commit.CreatedAt
+	}
+}
@@ -1,10 +1,12 @@
 package gitlab
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 	"github.com/stretchr/testify/assert"
@@ -31,9 +33,10 @@ func getMockedProvider() (*http.ServeMux, *httptest.Server, Provider) {
 
 func TestNewProvider(t *testing.T) {
 	groups := []string{"foo", "bar"}
-	p, err := NewProvider("foo", "http://foo", groups)
+	p, err := NewProvider("foo", "http://foo", groups, providers.NewRateLimiter(20, 3, time.Second, nil), time.Second)
 	assert.NoError(t, err)
 	assert.Equal(t, groups, p.groups)
+	assert.NotNil(t, p.RateLimiter())
 }
 
 func TestType(t *testing.T) {
@@ -46,6 +49,16 @@ func TestWebBaseURL(t *testing.T) {
 	assert.Equal(t, p.webBaseURL, p.WebBaseURL())
 }
 
+func TestCompareWebURL(t *testing.T) {
+	p := Provider{webBaseURL: "http://foo"}
+	env := providers.Ref{
+		Name:      "production",
+		Type:      providers.RefTypeEnvironment,
+		OriginRef: &providers.Ref{Name: "abcdef", Type: providers.RefTypeCommit},
+	}
+	assert.Equal(t, "http://foo/bar/baz/-/compare/abcdef...main", p.CompareWebURL("bar/baz", env, providers.Ref{Name: "main"}))
+}
+
 func TestListRepositories(t *testing.T) {
 	mux, server, p := getMockedProvider()
 	defer server.Close()
@@ -66,7 +79,135 @@ func TestListRepositories(t *testing.T) {
 			]`)
 		})
 
-	repos, err := p.ListRepositories()
+	l := p.ListRepositories()
+	assert.NoError(t, l.Err())
+	assert.Len(t, l.Repositories, 2)
+}
+
+func TestListRepositoriesPartialFailure(t *testing.T) {
+	mux, server, p := getMockedProvider()
+	defer server.Close()
+	p.groups = []string{"foo", "bar"}
+
+	mux.HandleFunc("/api/v4/groups/foo/projects",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"id": 1, "path_with_namespace": "foo/bar"}]`)
+		})
+
+	mux.HandleFunc("/api/v4/groups/bar/projects",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+	l := p.ListRepositories()
+	assert.Len(t, l.Repositories, 1)
+	assert.Len(t, l.Sources, 2)
+	assert.Equal(t, providers.RepositoriesSources{{ProviderType: providers.ProviderTypeGitLab, Owner: "bar"}}, l.FailedSources())
+	assert.Error(t, l.Err())
+}
+
+func TestGetCommitStatus(t *testing.T) {
+	mux, server, p := getMockedProvider()
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/foo/bar/repository/commits/main",
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, r.Method, "GET")
+			fmt.Fprint(w, `
+			{
+				"id": "abcdef",
+				"last_pipeline": {
+					"id": 1,
+					"status": "running",
+					"web_url": "http://foo/bar/-/pipelines/1"
+				}
+			}`)
+		})
+
+	cs, err := p.GetCommitStatus("foo/bar", providers.Ref{Name: "main", Type: providers.RefTypeBranch})
+	assert.NoError(t, err)
+	assert.Equal(t, providers.CommitStatus{
+		SHA:    "abcdef",
+		State:  providers.CommitStatusStateRunning,
+		WebURL: "http://foo/bar/-/pipelines/1",
+	}, cs)
+}
+
+func TestListProjectBranches(t *testing.T) {
+	mux, server, p := getMockedProvider()
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/foo/bar/repository/branches",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[
+				{
+					"name": "main",
+					"web_url": "http://foo/bar/-/tree/main",
+					"commit": {
+						"id": "abcdef",
+						"author_name": "Alice",
+						"author_email": "alice@example.com",
+						"committed_date": "2022-02-14T10:00:00Z"
+					}
+				}
+			]`)
+		})
+
+	refs, err := p.ListProjectBranches(context.Background(), "foo/bar")
+	assert.NoError(t, err)
+	assert.Len(t, refs, 1)
+
+	ref, found := refs.GetByName("main")
+	assert.True(t, found)
+	assert.Equal(t, "abcdef", ref.SHA)
+	assert.Equal(t, providers.Author{Name: "Alice", Email: "alice@example.com"}, ref.Author)
+	assert.Equal(t, time.Date(2022, 2, 14, 10, 0, 0, 0, time.UTC), ref.CommittedAt.UTC())
+}
+
+func TestListUserEmails(t *testing.T) {
+	mux, server, p := getMockedProvider()
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, r.Method, "GET")
+			if r.URL.Query().Get("username") == "alice" {
+				fmt.Fprint(w, `[{"id": 1, "username": "alice", "public_email": "alice@example.com"}]`)
+				return
+			}
+			assert.Equal(t, "bob@example.com", r.URL.Query().Get("search"))
+			fmt.Fprint(w, `[{"id": 2, "username": "bob", "public_email": "bob@example.com", "email": "bob@corp.example.com"}]`)
+		})
+
+	emails, err := p.ListUserEmails(providers.Author{Email: "1-alice@users.noreply.gitlab.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com"}, emails)
+
+	emails, err = p.ListUserEmails(providers.Author{Email: "bob@example.com"})
 	assert.NoError(t, err)
-	assert.Len(t, repos, 2)
+	assert.Equal(t, []string{"bob@example.com", "bob@corp.example.com"}, emails)
+
+	emails, err = p.ListUserEmails(providers.Author{})
+	assert.NoError(t, err)
+	assert.Empty(t, emails)
+}
+
+func TestUsernameFromNoReplyEmail(t *testing.T) {
+	assert.Equal(t, "alice", usernameFromNoReplyEmail("12345-alice@users.noreply.gitlab.com"))
+	assert.Equal(t, "", usernameFromNoReplyEmail("alice@example.com"))
+}
+
+func TestCommitStatusStateFromPipelineStatus(t *testing.T) {
+	for status, expected := range map[string]providers.CommitStatusState{
+		"created":       providers.CommitStatusStatePending,
+		"manual":        providers.CommitStatusStatePending,
+		"running":       providers.CommitStatusStateRunning,
+		"success":       providers.CommitStatusStateSuccess,
+		"failed":        providers.CommitStatusStateFailure,
+		"canceled":      providers.CommitStatusStateCanceled,
+		"skipped":       providers.CommitStatusStateUnknown,
+		"something_new": providers.CommitStatusStateUnknown,
+	} {
+		assert.Equal(t, expected, commitStatusStateFromPipelineStatus(status), status)
+	}
 }
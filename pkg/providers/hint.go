@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// compareURLPattern matches GitHub (/owner/repo/compare/a...b) and
+	// GitLab (/group/project/-/compare/a...b) compare URLs
+	compareURLPattern = regexp.MustCompile(`https?://[^/\s]+/([^\s|>]+?)(?:/-)?/compare/([^\s|>]+?)\.{2,3}([^\s|>#?]+)`)
+
+	// shaPattern matches abbreviated or full git commit SHAs
+	shaPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+	// tokenSeparators are the characters which cannot be part of a repository or ref name
+	tokenSeparators = " \t\n\r,;:!?()[]{}<>|\"'`*~"
+)
+
+// ComparisonHint holds the names of a repository and refs found in a text
+type ComparisonHint struct {
+	Repository string
+	FromRef    string
+	ToRef      string
+}
+
+// ExtractCompareURL looks up for a GitHub or GitLab compare URL in the text and
+// returns the names of the repository and refs it references
+func ExtractCompareURL(text string) (ch ComparisonHint, found bool) {
+	m := compareURLPattern.FindStringSubmatch(text)
+	if m == nil {
+		return
+	}
+
+	return ComparisonHint{
+		Repository: m[1],
+		FromRef:    m[2],
+		ToRef:      m[3],
+	}, true
+}
+
+// ExtractTokens splits the text into the words which could be repository or ref
+// names, deduplicated and in order of appearance
+func ExtractTokens(text string) (tokens []string) {
+	seen := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return strings.ContainsRune(tokenSeparators, r)
+	}) {
+		token := strings.Trim(field, ".-_/")
+		if len(token) < 2 || seen[token] {
+			continue
+		}
+
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+	return
+}
+
+// isCloseFuzzyMatch returns whether the fuzzy search rank of a token is low
+// enough for it to be considered as referring to the target
+func isCloseFuzzyMatch(token string, rank int) bool {
+	return rank >= 0 && rank <= len(token)/3
+}
+
+// GuessFromTokens returns the Repository which is the most likely referenced by
+// one of the tokens, as well as the token it matched
+func (rs Repositories) GuessFromTokens(tokens []string) (repo Repository, matchedToken string) {
+	bestRank := -1
+	for _, token := range tokens {
+		for _, r := range rs.Search(token, 1) {
+			rank := r.Rank
+			// The name of a repository is often mentioned without its owner
+			if strings.HasSuffix(strings.ToLower(r.Name), "/"+strings.ToLower(token)) {
+				rank = 0
+			}
+
+			if isCloseFuzzyMatch(token, rank) && (bestRank == -1 || rank < bestRank) {
+				repo, matchedToken, bestRank = r.Repository, token, rank
+			}
+		}
+	}
+	return
+}
+
+// GuessFromTokens returns up to two Refs which are the most likely referenced by
+// the tokens, in order of appearance. Exact names and commit SHAs are preferred
+// over fuzzy matches
+func (rs Refs) GuessFromTokens(tokens []string) (fromRef, toRef Ref) {
+	type candidate struct {
+		ref      Ref
+		rank     int
+		position int
+	}
+
+	var candidates []candidate
+	matched := make(map[RefKey]bool)
+	for position, token := range tokens {
+		c := candidate{rank: -1, position: position}
+		if ref, found := rs.GetByName(token); found {
+			c.ref, c.rank = ref, 0
+		} else if shaPattern.MatchString(strings.ToLower(token)) {
+			for _, ref := range rs.FilterByType(RefTypeCommit) {
+				if strings.HasPrefix(ref.Name, strings.ToLower(token)) {
+					c.ref, c.rank = ref, 0
+					break
+				}
+			}
+		}
+
+		if c.rank == -1 {
+			for _, r := range rs.Search(token, 1) {
+				if isCloseFuzzyMatch(token, r.Rank) {
+					c.ref, c.rank = r.Ref, r.Rank
+				}
+			}
+		}
+
+		if c.rank == -1 || matched[c.ref.Key()] {
+			continue
+		}
+
+		matched[c.ref.Key()] = true
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	if len(candidates) > 2 {
+		candidates = candidates[:2]
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].position < candidates[j].position
+	})
+
+	if len(candidates) > 0 {
+		fromRef = candidates[0].ref
+	}
+
+	if len(candidates) > 1 {
+		toRef = candidates[1].ref
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractCompareURL(t *testing.T) {
+	ch, found := ExtractCompareURL("see <https://github.com/foo/bar/compare/v1.0.0...main|diff>")
+	assert.True(t, found)
+	assert.Equal(t, ComparisonHint{Repository: "foo/bar", FromRef: "v1.0.0", ToRef: "main"}, ch)
+
+	ch, found = ExtractCompareURL("https://gitlab.com/foo/bar/baz/-/compare/feature/x..main?from_project_id=1")
+	assert.True(t, found)
+	assert.Equal(t, ComparisonHint{Repository: "foo/bar/baz", FromRef: "feature/x", ToRef: "main"}, ch)
+
+	_, found = ExtractCompareURL("https://github.com/foo/bar")
+	assert.False(t, found)
+}
+
+func TestExtractTokens(t *testing.T) {
+	assert.Equal(t,
+		[]string{"deployed", "foo/bar", "v1.2.3", "to", "production", "abc1234"},
+		ExtractTokens("deployed *foo/bar* `v1.2.3` to production (abc1234). deployed"),
+	)
+}
+
+func TestRepositoriesGuessFromTokens(t *testing.T) {
+	rs := Repositories{}
+	for _, name := range []string{"foo/bar", "foo/baz", "qux/deployer"} {
+		r := Repository{Name: name}
+		rs[r.Key()] = r
+	}
+
+	repo, token := rs.GuessFromTokens([]string{"deployed", "bar", "v1.2.3"})
+	assert.Equal(t, "foo/bar", repo.Name)
+	assert.Equal(t, "bar", token)
+
+	repo, token = rs.GuessFromTokens([]string{"nothing", "here"})
+	assert.True(t, repo.IsEmpty())
+	assert.Equal(t, "", token)
+}
+
+func TestRefsGuessFromTokens(t *testing.T) {
+	rs := Refs{}
+	for _, r := range []Ref{
+		{Name: "main", Type: RefTypeBranch},
+		{Name: "v1.2.3", Type: RefTypeTag},
+		{Name: "v1.2.4", Type: RefTypeTag},
+		{Name: "abc1234567", Type: RefTypeCommit},
+	} {
+		rs[r.Key()] = r
+	}
+
+	fromRef, toRef := rs.GuessFromTokens([]string{"deployed", "v1.2.4", "over", "1.2.3"})
+	assert.Equal(t, "v1.2.4", fromRef.Name)
+	assert.Equal(t, "v1.2.3", toRef.Name)
+
+	fromRef, toRef = rs.GuessFromTokens([]string{"abc1234", "to", "production", "main"})
+	assert.Equal(t, "abc1234567", fromRef.Name)
+	assert.Equal(t, "main", toRef.Name)
+
+	fromRef, toRef = rs.GuessFromTokens([]string{"nothing"})
+	assert.True(t, fromRef.IsEmpty())
+	assert.True(t, toRef.IsEmpty())
+}
@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Issue holds details of an issue referenced within a commit message
+type Issue struct {
+	Key    string
+	WebURL string
+}
+
+// Issues is a slice of Issue
+type Issues []Issue
+
+// IssueTracker is used to extract issue references from commit messages.
+// The Key of the Issue is taken from the "key" named group of the Pattern
+// if defined, or from the whole match otherwise. The URL is expanded using the
+// submatches of the Pattern ($1, ${name}, etc..) as well as ${repository} which
+// is replaced by the name of the compared repository
+type IssueTracker struct {
+	Pattern *regexp.Regexp
+	URL     string
+}
+
+// IssueTrackers is a slice of IssueTracker
+type IssueTrackers []IssueTracker
+
+const (
+	// JiraIssuePattern matches Jira issue keys (eg: ABC-123). As it matches any
+	// uppercase identifier followed by a number (eg: UTF-8, SHA-256), the Jira
+	// trackers should rather be restricted to their project keys
+	JiraIssuePattern = `\b(?P<key>[A-Z][A-Z0-9]+-\d+)\b`
+
+	// jiraProjectsIssuePattern matches the issue keys of the given Jira projects
+	jiraProjectsIssuePattern = `\b(?P<key>(?:%s)-\d+)\b`
+
+	// ProviderIssuePattern matches issues referenced within the
+	// same repository (eg: #456)
+	ProviderIssuePattern = `(?:^|[\s(\[,;])(?P<key>#(?P<id>\d+))\b`
+
+	// ProviderCrossRepositoryIssuePattern matches issues referenced within
+	// another repository (eg: group/project#789)
+	ProviderCrossRepositoryIssuePattern = `(?:^|[\s(\[,;])(?P<key>(?P<project>[\w.-]+(?:/[\w.-]+)+)#(?P<id>\d+))\b`
+)
+
+// NewIssueTracker returns a new IssueTracker given a pattern and an URL template
+func NewIssueTracker(pattern, url string) (it IssueTracker, err error) {
+	if it.Pattern, err = regexp.Compile(pattern); err != nil {
+		err = fmt.Errorf("invalid issue tracker pattern '%s': %v", pattern, err)
+		return
+	}
+
+	it.URL = url
+	return
+}
+
+// NewJiraIssueTracker returns a new IssueTracker matching the issue keys of the
+// given Jira projects, or any Jira issue key if there are none, and linking them
+// to the given Jira instance
+func NewJiraIssueTracker(baseURL string, projects []string) IssueTracker {
+	pattern := JiraIssuePattern
+	if len(projects) > 0 {
+		quoted := make([]string, len(projects))
+		for i, p := range projects {
+			quoted[i] = regexp.QuoteMeta(p)
+		}
+		pattern = fmt.Sprintf(jiraProjectsIssuePattern, strings.Join(quoted, "|"))
+	}
+
+	return IssueTracker{
+		Pattern: regexp.MustCompile(pattern),
+		URL:     strings.TrimSuffix(baseURL, "/") + "/browse/${key}",
+	}
+}
+
+// NewProviderIssueTrackers returns the IssueTrackers matching issues natively
+// referenced on the given git provider (eg: #456 and group/project#789)
+func NewProviderIssueTrackers(pt ProviderType, webBaseURL string) IssueTrackers {
+	webBaseURL = strings.TrimSuffix(webBaseURL, "/")
+
+	issuesPath := "issues"
+	if pt == ProviderTypeGitLab {
+		issuesPath = "-/issues"
+	}
+
+	return IssueTrackers{
+		{
+			Pattern: regexp.MustCompile(ProviderCrossRepositoryIssuePattern),
+			URL:     fmt.Sprintf("%s/${project}/%s/${id}", webBaseURL, issuesPath),
+		},
+		{
+			Pattern: regexp.MustCompile(ProviderIssuePattern),
+			URL:     fmt.Sprintf("%s/${repository}/%s/${id}", webBaseURL, issuesPath),
+		},
+	}
+}
+
+// ExtractIssues returns the Issues referenced within the given message
+func (it IssueTracker) ExtractIssues(message string, repo Repository) (issues Issues) {
+	if it.Pattern == nil {
+		return
+	}
+
+	keyIndex := it.Pattern.SubexpIndex("key")
+	url := strings.ReplaceAll(it.URL, "${repository}", repo.Name)
+
+	for _, submatches := range it.Pattern.FindAllStringSubmatchIndex(message, -1) {
+		issue := Issue{
+			WebURL: string(it.Pattern.ExpandString(nil, url, message, submatches)),
+		}
+
+		if keyIndex > 0 && submatches[2*keyIndex] >= 0 {
+			issue.Key = message[submatches[2*keyIndex]:submatches[2*keyIndex+1]]
+		} else {
+			issue.Key = message[submatches[0]:submatches[1]]
+		}
+
+		issues = append(issues, issue)
+	}
+
+	return
+}
+
+// ExtractIssues returns the deduplicated Issues referenced within the given
+// message, across all the IssueTrackers
+func (its IssueTrackers) ExtractIssues(message string, repo Repository) (issues Issues) {
+	for _, it := range its {
+		for _, issue := range it.ExtractIssues(message, repo) {
+			issues = issues.append(issue)
+		}
+	}
+
+	return
+}
+
+// append adds the Issue to the slice if it is not already present
+func (is Issues) append(issue Issue) Issues {
+	for _, i := range is {
+		if i.Key == issue.Key {
+			return is
+		}
+	}
+
+	return append(is, issue)
+}
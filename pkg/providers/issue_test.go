@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIssueTracker(t *testing.T) {
+	it, err := NewIssueTracker(`INC(\d+)`, "https://tracker.example.com/incidents/$1")
+	assert.NoError(t, err)
+	assert.Equal(t, Issues{
+		{
+			Key:    "INC42",
+			WebURL: "https://tracker.example.com/incidents/42",
+		},
+	}, it.ExtractIssues("fix: INC42", Repository{}))
+
+	_, err = NewIssueTracker(`(`, "")
+	assert.Error(t, err)
+}
+
+func TestJiraIssueTrackerExtractIssues(t *testing.T) {
+	it := NewJiraIssueTracker("https://jira.example.com/", nil)
+	assert.Equal(t, Issues{
+		{
+			Key:    "ABC-123",
+			WebURL: "https://jira.example.com/browse/ABC-123",
+		},
+		{
+			Key:    "DEF-4",
+			WebURL: "https://jira.example.com/browse/DEF-4",
+		},
+	}, it.ExtractIssues("ABC-123: foo (DEF-4)\n\nutf-8 abc-12", Repository{}))
+
+	// Without any project, uppercase identifiers followed by a number are matched
+	assert.Len(t, it.ExtractIssues("UTF-8, SHA-256, ISO-8601 and CVE-2021", Repository{}), 4)
+
+	// Which is not the case once restricted to the projects
+	it = NewJiraIssueTracker("https://jira.example.com", []string{"ABC", "DEF"})
+	assert.Equal(t, Issues{
+		{
+			Key:    "ABC-123",
+			WebURL: "https://jira.example.com/browse/ABC-123",
+		},
+		{
+			Key:    "DEF-4",
+			WebURL: "https://jira.example.com/browse/DEF-4",
+		},
+	}, it.ExtractIssues("ABC-123: encode in UTF-8, hash with SHA-256 (DEF-4)\n\nISO-8601 dates, CVE-2021-44228, XABC-1 and ABC-", Repository{}))
+}
+
+func TestProviderIssueTrackersExtractIssues(t *testing.T) {
+	repo := Repository{Name: "foo/bar"}
+
+	its := NewProviderIssueTrackers(ProviderTypeGitHub, "https://github.com/")
+	assert.Equal(t, Issues{
+		{
+			Key:    "baz/qux#789",
+			WebURL: "https://github.com/baz/qux/issues/789",
+		},
+		{
+			Key:    "#456",
+			WebURL: "https://github.com/foo/bar/issues/456",
+		},
+	}, its.ExtractIssues("fixes #456, relates to baz/qux#789 and #456", repo))
+
+	its = NewProviderIssueTrackers(ProviderTypeGitLab, "https://gitlab.com")
+	assert.Equal(t, Issues{
+		{
+			Key:    "#1",
+			WebURL: "https://gitlab.com/foo/bar/-/issues/1",
+		},
+	}, its.ExtractIssues("#1 and not a#2", repo))
+}
+
+func TestHydrateCommitsIssues(t *testing.T) {
+	c := Comparison{
+		Commits: Commits{
+			{Message: "ABC-1: foo"},
+			{Message: "ABC-2: bar (ABC-1)"},
+			{Message: "baz"},
+		},
+	}
+
+	c.HydrateCommitsIssues(IssueTrackers{NewJiraIssueTracker("https://jira", nil)}, Repository{})
+	assert.Len(t, c.Commits[0].Issues, 1)
+	assert.Len(t, c.Commits[1].Issues, 2)
+	assert.Len(t, c.Commits[2].Issues, 0)
+	assert.Equal(t, Issues{
+		{Key: "ABC-1", WebURL: "https://jira/browse/ABC-1"},
+		{Key: "ABC-2", WebURL: "https://jira/browse/ABC-2"},
+	}, c.Issues)
+}
@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RepositoriesSource is an owner (GitHub organization, GitLab group..) whose
+// repositories get listed from a provider
+type RepositoriesSource struct {
+	ProviderType ProviderType
+	Owner        string
+}
+
+// String returns a human readable identifier of the source
+func (s RepositoriesSource) String() string {
+	return fmt.Sprintf("%s:%s", s.ProviderType, s.Owner)
+}
+
+// Contains returns whether the Repository belongs to the source
+func (s RepositoriesSource) Contains(r Repository) bool {
+	return r.ProviderType == s.ProviderType &&
+		strings.HasPrefix(strings.ToLower(r.Name), strings.ToLower(s.Owner)+"/")
+}
+
+// RepositoriesSources is a slice of RepositoriesSource
+type RepositoriesSources []RepositoriesSource
+
+// Contains returns whether the Repository belongs to one of the sources
+func (ss RepositoriesSources) Contains(r Repository) bool {
+	for _, s := range ss {
+		if s.Contains(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepositoriesSourceStatus holds the outcome of the listings of a source
+type RepositoriesSourceStatus struct {
+	RepositoriesSource
+
+	// LastUpdate is when the repositories of the source got successfully listed
+	// for the last time, it is zero if they never were
+	LastUpdate time.Time
+
+	// LastError is the error the last listing failed with, empty if it succeeded
+	LastError string
+}
+
+// IsStale returns whether the repositories of the source could not be listed
+// the last time we tried
+func (s RepositoriesSourceStatus) IsStale() bool {
+	return s.LastError != ""
+}
+
+// RepositoriesListing holds the repositories listed from one or more
+// providers, alongside the outcome of the listing of each of their sources
+type RepositoriesListing struct {
+	Repositories Repositories
+
+	// Sources maps all the sources we attempted to list to the error their
+	// listing failed with, nil if it succeeded
+	Sources map[RepositoriesSource]error
+}
+
+// NewRepositoriesListing returns an empty RepositoriesListing
+func NewRepositoriesListing() RepositoriesListing {
+	return RepositoriesListing{
+		Repositories: make(Repositories),
+		Sources:      make(map[RepositoriesSource]error),
+	}
+}
+
+// Merge adds the repositories and sources of another listing
+func (l RepositoriesListing) Merge(other RepositoriesListing) {
+	for k, r := range other.Repositories {
+		l.Repositories[k] = r
+	}
+
+	for s, err := range other.Sources {
+		l.Sources[s] = err
+	}
+}
+
+// FailedSources returns the sources whose listing failed, sorted
+func (l RepositoriesListing) FailedSources() (sources RepositoriesSources) {
+	for s, err := range l.Sources {
+		if err != nil {
+			sources = append(sources, s)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].String() < sources[j].String()
+	})
+	return
+}
+
+// Err returns a ListRepositoriesError if the listing of some of the sources
+// failed, nil otherwise
+func (l RepositoriesListing) Err() error {
+	failed := l.FailedSources()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	e := ListRepositoriesError{
+		Errors:       make(map[RepositoriesSource]error, len(failed)),
+		SourcesCount: len(l.Sources),
+	}
+
+	for _, s := range failed {
+		e.Errors[s] = l.Sources[s]
+	}
+	return e
+}
+
+// ListRepositoriesError aggregates the errors which occurred while listing the
+// repositories of the sources
+type ListRepositoriesError struct {
+	Errors       map[RepositoriesSource]error
+	SourcesCount int
+}
+
+// Error implements the error interface
+func (e ListRepositoriesError) Error() string {
+	sources := make(RepositoriesSources, 0, len(e.Errors))
+	for s := range e.Errors {
+		sources = append(sources, s)
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].String() < sources[j].String()
+	})
+
+	errs := make([]string, 0, len(sources))
+	for _, s := range sources {
+		errs = append(errs, fmt.Sprintf("%s: %v", s, e.Errors[s]))
+	}
+
+	return fmt.Sprintf("listing the repositories of %d/%d source(s) failed: %s", len(e.Errors), e.SourcesCount, strings.Join(errs, "; "))
+}
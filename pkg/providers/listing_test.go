@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoriesSourceContains(t *testing.T) {
+	s := RepositoriesSource{ProviderType: ProviderTypeGitLab, Owner: "Foo"}
+
+	assert.True(t, s.Contains(Repository{ProviderType: ProviderTypeGitLab, Name: "foo/bar"}))
+	assert.True(t, s.Contains(Repository{ProviderType: ProviderTypeGitLab, Name: "foo/sub/bar"}))
+	assert.False(t, s.Contains(Repository{ProviderType: ProviderTypeGitHub, Name: "foo/bar"}))
+	assert.False(t, s.Contains(Repository{ProviderType: ProviderTypeGitLab, Name: "foobar/baz"}))
+}
+
+func TestRepositoriesListingMergeAndErr(t *testing.T) {
+	foo := RepositoriesSource{ProviderType: ProviderTypeGitHub, Owner: "foo"}
+	bar := RepositoriesSource{ProviderType: ProviderTypeGitLab, Owner: "bar"}
+	baz := RepositoriesSource{ProviderType: ProviderTypeGitLab, Owner: "baz"}
+
+	l := NewRepositoriesListing()
+	assert.NoError(t, l.Err())
+
+	github := NewRepositoriesListing()
+	r := Repository{ProviderType: ProviderTypeGitHub, Name: "foo/foo"}
+	github.Repositories[r.Key()] = r
+	github.Sources[foo] = nil
+
+	gitlab := NewRepositoriesListing()
+	gitlab.Sources[bar] = errors.New("boom")
+	gitlab.Sources[baz] = errors.New("bang")
+
+	l.Merge(github)
+	l.Merge(gitlab)
+
+	assert.Len(t, l.Repositories, 1)
+	assert.Len(t, l.Sources, 3)
+	assert.Equal(t, RepositoriesSources{bar, baz}, l.FailedSources())
+
+	err := l.Err()
+	var lre ListRepositoriesError
+	assert.True(t, errors.As(err, &lre))
+	assert.Len(t, lre.Errors, 2)
+	assert.Equal(t, "listing the repositories of 2/3 source(s) failed: gitlab:bar: boom; gitlab:baz: bang", err.Error())
+}
+
+func TestRepositoriesSourceStatusIsStale(t *testing.T) {
+	assert.False(t, RepositoriesSourceStatus{}.IsStale())
+	assert.True(t, RepositoriesSourceStatus{LastError: "boom"}.IsStale())
+}
@@ -1,18 +1,31 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// Provider is used to represent any kind of git provider
+// Provider is used to represent any kind of git provider. The *WithContext
+// variants of the methods abort the calls once the context is done
 type Provider interface {
 	WebBaseURL() string
 	Type() ProviderType
 	Compare(string, Ref, Ref) (*Comparison, error)
-	ListRepositories() (Repositories, error)
+	CompareWithContext(context.Context, string, Ref, Ref) (*Comparison, error)
+	CompareWebURL(string, Ref, Ref) string
+	ListRepositories() RepositoriesListing
+	ListRepositoriesWithContext(context.Context) RepositoriesListing
 	ListRefs(string) (Refs, error)
+	ListRefsWithContext(context.Context, string) (Refs, error)
+	GetCommitSHA(string, Ref) (string, error)
+	GetCommitSHAWithContext(context.Context, string, Ref) (string, error)
+	GetCommitStatus(string, Ref) (CommitStatus, error)
+	GetCommitStatusWithContext(context.Context, string, Ref) (CommitStatus, error)
+	ListUserEmails(Author) ([]string, error)
+	ListUserEmailsWithContext(context.Context, Author) ([]string, error)
+	RateLimiter() *RateLimiter
 }
 
 // ProviderType represents the type of git provider
@@ -40,30 +53,26 @@ func (pt ProviderType) StringPretty() string {
 	return [...]string{"GitHub", "GitLab"}[pt]
 }
 
-// ListRepositories aggregates the repositories for all configured providers
-func (ps Providers) ListRepositories() (repos Repositories, err error) {
-	repos = make(Repositories)
+// ListRepositories aggregates the repositories for all configured providers, the
+// failure of some of their sources does not prevent the others from being listed
+func (ps Providers) ListRepositories(ctx context.Context) (l RepositoriesListing) {
+	l = NewRepositoriesListing()
 	for _, p := range ps {
-		foundRepos, err := p.ListRepositories()
-		if err != nil {
-			return repos, err
-		}
-
-		for k, r := range foundRepos {
-			repos[k] = r
-		}
+		pl := p.ListRepositoriesWithContext(ctx)
+		l.Merge(pl)
 
 		log.WithFields(log.Fields{
-			"provider": p.Type().String(),
-			"count":    len(foundRepos),
+			"provider":       p.Type().String(),
+			"count":          len(pl.Repositories),
+			"failed_sources": len(pl.FailedSources()),
 		}).Info("fetched repositories from provider")
 	}
 
 	log.WithFields(log.Fields{
-		"total": len(repos),
+		"total": len(l.Repositories),
 	}).Debug("done fetching repositories")
 
-	return repos, nil
+	return
 }
 
 // GetProviderTypeFromString returns a ProviderType based onto a given string
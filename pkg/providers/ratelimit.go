@@ -0,0 +1,236 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryBaseBackoff is the duration we wait before the first retry, it doubles on
+// each attempt
+const retryBaseBackoff = 500 * time.Millisecond
+
+// RateLimiter is a http.RoundTripper keeping track of the API budget of a
+// provider instance through the headers of its responses (X-RateLimit-* for
+// GitHub, RateLimit-* for GitLab). It retries the requests which got
+// rate-limited or failed on the server side, and lets the background tasks
+// wait for the budget to be above the reserve left for interactive calls
+type RateLimiter struct {
+	// ReservePercent of the budget which the background tasks leave for the
+	// interactive calls
+	ReservePercent int
+
+	// MaxRetries of the requests which got rate-limited or failed with a 5xx
+	MaxRetries int
+
+	// MaxRetryWait is the longest we wait before retrying a request, the
+	// response is returned as is if a retry requires waiting longer
+	MaxRetryWait time.Duration
+
+	// Transport performs the requests, http.DefaultTransport is used if nil
+	Transport http.RoundTripper
+
+	limit     int
+	remaining int
+	reset     time.Time
+	mutex     sync.RWMutex
+}
+
+// RateLimitStatus is a snapshot of the budget of a provider
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter wrapping the transport
+func NewRateLimiter(reservePercent, maxRetries int, maxRetryWait time.Duration, transport http.RoundTripper) *RateLimiter {
+	return &RateLimiter{
+		ReservePercent: reservePercent,
+		MaxRetries:     maxRetries,
+		MaxRetryWait:   maxRetryWait,
+		Transport:      transport,
+		limit:          -1,
+		remaining:      -1,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (rl *RateLimiter) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	transport := rl.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 {
+			r = req.Clone(req.Context())
+			if req.Body != nil {
+				if r.Body, err = req.GetBody(); err != nil {
+					return
+				}
+			}
+		}
+
+		resp, err = transport.RoundTrip(r)
+		if resp != nil {
+			rl.update(resp.Header)
+		}
+
+		// Requests whose body cannot be replayed cannot be retried
+		if attempt >= rl.MaxRetries || req.Context().Err() != nil ||
+			(req.Body != nil && req.GetBody == nil) || !isRetryable(resp, err) {
+			return
+		}
+
+		wait := retryWait(attempt, resp)
+		if wait > rl.MaxRetryWait {
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Warning("retrying provider API call")
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// update records the budget given the headers of a response
+func (rl *RateLimiter) update(h http.Header) {
+	remaining, err := strconv.Atoi(rateLimitHeader(h, "Remaining"))
+	if err != nil {
+		return
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.remaining = remaining
+	if limit, err := strconv.Atoi(rateLimitHeader(h, "Limit")); err == nil {
+		rl.limit = limit
+	}
+
+	if reset, err := strconv.ParseInt(rateLimitHeader(h, "Reset"), 10, 64); err == nil {
+		rl.reset = time.Unix(reset, 0)
+	}
+}
+
+// Status returns the last known budget, Limit and Remaining being -1 until a
+// response containing the rate-limit headers gets received
+func (rl *RateLimiter) Status() RateLimitStatus {
+	rl.mutex.RLock()
+	defer rl.mutex.RUnlock()
+
+	return RateLimitStatus{
+		Limit:     rl.limit,
+		Remaining: rl.remaining,
+		Reset:     rl.reset,
+	}
+}
+
+// BackgroundBudgetAvailable returns whether the background tasks can call the
+// API, and otherwise when the budget gets reset
+func (rl *RateLimiter) BackgroundBudgetAvailable() (available bool, resumeAt time.Time) {
+	if rl == nil {
+		return true, time.Time{}
+	}
+
+	s := rl.Status()
+	if s.Remaining < 0 || !time.Now().Before(s.Reset) {
+		return true, time.Time{}
+	}
+
+	reserve := s.Limit * rl.ReservePercent / 100
+	if s.Remaining > reserve {
+		return true, time.Time{}
+	}
+
+	return false, s.Reset
+}
+
+// WaitForBackgroundBudget blocks until the background tasks can call the API
+// again, or the context gets cancelled
+func (rl *RateLimiter) WaitForBackgroundBudget(ctx context.Context) error {
+	for {
+		available, resumeAt := rl.BackgroundBudgetAvailable()
+		if available {
+			return nil
+		}
+
+		log.WithFields(log.Fields{
+			"remaining": rl.Status().Remaining,
+			"resume_at": resumeAt,
+		}).Info("provider API budget is low, pausing background tasks")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(resumeAt)):
+		}
+	}
+}
+
+// rateLimitHeader returns the value of a rate-limit header, whether it is
+// prefixed with "X-" (GitHub) or not (GitLab)
+func rateLimitHeader(h http.Header, name string) string {
+	if v := h.Get("X-RateLimit-" + name); v != "" {
+		return v
+	}
+	return h.Get("RateLimit-" + name)
+}
+
+// isRateLimited returns whether the response got rejected because of the rate
+// limit, GitHub responds with 403s when the budget is exhausted
+func isRateLimited(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden &&
+			(resp.Header.Get("Retry-After") != "" || rateLimitHeader(resp.Header, "Remaining") == "0"))
+}
+
+// isRetryable returns whether the request is worth retrying
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return isRateLimited(resp) || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryWait returns how long to wait before retrying the request, honouring the
+// Retry-After and reset headers of rate-limited responses and otherwise backing
+// off exponentially
+func retryWait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil && isRateLimited(resp) {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if reset, err := strconv.ParseInt(rateLimitHeader(resp.Header, "Reset"), 10, 64); err == nil {
+			if wait := time.Until(time.Unix(reset, 0)); wait > 0 {
+				return wait
+			}
+		}
+	}
+
+	// Some jitter spreads the retries of concurrent calls
+	backoff := retryBaseBackoff << attempt
+	return backoff + time.Duration(time.Now().UnixNano()%int64(backoff/2))
+}
@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterUpdate(t *testing.T) {
+	rl := NewRateLimiter(20, 0, time.Second, nil)
+	assert.Equal(t, RateLimitStatus{Limit: -1, Remaining: -1}, rl.Status())
+
+	// GitHub
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", "4999")
+	h.Set("X-RateLimit-Reset", "1622548800")
+	rl.update(h)
+	assert.Equal(t, RateLimitStatus{Limit: 5000, Remaining: 4999, Reset: time.Unix(1622548800, 0)}, rl.Status())
+
+	// GitLab
+	h = http.Header{}
+	h.Set("RateLimit-Limit", "2000")
+	h.Set("RateLimit-Remaining", "1500")
+	h.Set("RateLimit-Reset", "1622548860")
+	rl.update(h)
+	assert.Equal(t, RateLimitStatus{Limit: 2000, Remaining: 1500, Reset: time.Unix(1622548860, 0)}, rl.Status())
+
+	// Responses without the headers are ignored
+	rl.update(http.Header{})
+	assert.Equal(t, 1500, rl.Status().Remaining)
+}
+
+func TestRateLimiterBackgroundBudget(t *testing.T) {
+	rl := NewRateLimiter(20, 0, time.Second, nil)
+
+	// Unknown budget
+	available, _ := rl.BackgroundBudgetAvailable()
+	assert.True(t, available)
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	rl.limit, rl.remaining, rl.reset = 100, 21, reset
+	available, _ = rl.BackgroundBudgetAvailable()
+	assert.True(t, available)
+
+	// Within the reserve
+	rl.remaining = 20
+	available, resumeAt := rl.BackgroundBudgetAvailable()
+	assert.False(t, available)
+	assert.Equal(t, reset, resumeAt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, rl.WaitForBackgroundBudget(ctx))
+
+	// The budget has been reset since
+	rl.reset = time.Now().Add(-time.Second)
+	available, _ = rl.BackgroundBudgetAvailable()
+	assert.True(t, available)
+	assert.NoError(t, rl.WaitForBackgroundBudget(context.Background()))
+
+	// A nil RateLimiter never throttles
+	available, _ = (*RateLimiter)(nil).BackgroundBudgetAvailable()
+	assert.True(t, available)
+}
+
+func TestRateLimiterRoundTripRetries(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/flaky":
+			if calls < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		case "/limited":
+			w.Header().Set("Retry-After", "0")
+			if calls < 2 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		case "/exhausted":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRateLimiter(20, 3, time.Minute, nil)}
+	get := func(path string) int {
+		calls = 0
+		resp, err := client.Get(server.URL + path)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/flaky"))
+	assert.Equal(t, 3, calls)
+
+	assert.Equal(t, http.StatusOK, get("/limited"))
+	assert.Equal(t, 2, calls)
+
+	// Waiting for the reset would take longer than MaxRetryWait
+	assert.Equal(t, http.StatusForbidden, get("/exhausted"))
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, http.StatusNotFound, get("/missing"))
+	assert.Equal(t, 1, calls)
+
+	// Requests with a body get replayed
+	calls = 0
+	resp, err := client.Post(server.URL+"/flaky", "text/plain", strings.NewReader("foo"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryWait(t *testing.T) {
+	wait := retryWait(0, nil)
+	assert.GreaterOrEqual(t, int64(wait), int64(retryBaseBackoff))
+	assert.Less(t, int64(wait), int64(retryBaseBackoff*3/2))
+
+	wait = retryWait(2, &http.Response{StatusCode: http.StatusBadGateway})
+	assert.GreaterOrEqual(t, int64(wait), int64(4*retryBaseBackoff))
+
+	h := http.Header{}
+	h.Set("Retry-After", "12")
+	assert.Equal(t, 12*time.Second, retryWait(0, &http.Response{StatusCode: http.StatusTooManyRequests, Header: h}))
+}
@@ -1,9 +1,11 @@
 package providers
 
 import (
+	"fmt"
 	"hash/crc32"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/lithammer/fuzzysearch/fuzzy"
 )
@@ -17,21 +19,35 @@ type Ref struct {
 	// OriginRef can be used to store the ref onto which a GitLab environment
 	// is pointing to
 	OriginRef *Ref
+
+	// SHA, CommittedAt and Author describe the head commit of the ref, as far
+	// as the provider returns them when listing the refs
+	SHA         string
+	CommittedAt time.Time
+	Author      Author
 }
 
 // Refs holds multiple Ref with their unique identifiers (RefKey)
 type Refs map[RefKey]Ref
 
 // RankedRef can be used when fuzzy searching Refs, attributing a "rank"
-// for the Ref given the pertinence of its attributes given the search
+// for the Ref given the pertinence of its attributes given the search. The
+// Score blends it with the usage, recency or version of the Ref
 type RankedRef struct {
 	Ref
-	Rank int
+	Rank  int
+	Score float64
 }
 
 // RankedRefs is a slice of *RankedRef
 type RankedRefs []*RankedRef
 
+// IsAmbiguous returns whether the best match cannot be determined with
+// certainty, the two most pertinent Refs sharing the same rank
+func (rrs RankedRefs) IsAmbiguous() bool {
+	return len(rrs) > 1 && rrs[0].Rank == rrs[1].Rank
+}
+
 // RefType represents the type of git reference
 type RefType uint8
 
@@ -59,6 +75,24 @@ func (rt RefType) String() string {
 	}[rt]
 }
 
+// GetRefTypeFromString returns a RefType based onto a given string
+func GetRefTypeFromString(t string) (rt RefType, err error) {
+	mapping := map[string]RefType{
+		"branch": RefTypeBranch,
+		"commit": RefTypeCommit,
+		"env":    RefTypeEnvironment,
+		"tag":    RefTypeTag,
+	}
+
+	var found bool
+	rt, found = mapping[t]
+	if !found {
+		err = fmt.Errorf("invalid ref type '%s'", t)
+	}
+
+	return
+}
+
 // RefKey is a unique identifier for a Ref
 type RefKey string
 
@@ -73,19 +107,81 @@ func (rs Refs) GetByKey(k RefKey) (r Ref, ok bool) {
 	return
 }
 
+// refTypesByNamePriority orders the types of the refs which get picked when
+// several refs share the same name, branches first
+var refTypesByNamePriority = []RefType{
+	RefTypeBranch,
+	RefTypeTag,
+	RefTypeEnvironment,
+	RefTypeCommit,
+}
+
+// GetByName returns the Ref matching exactly the given name, branches prevailing
+// when refs of different types share it. The name can also be prefixed by the
+// type of the ref (eg: tag/v1.0.0) to disambiguate it
+func (rs Refs) GetByName(name string) (r Ref, ok bool) {
+	for _, rt := range refTypesByNamePriority {
+		for _, ref := range rs {
+			if ref.Type == rt && ref.Name == name {
+				return ref, true
+			}
+		}
+	}
+
+	for _, ref := range rs {
+		if ref.Type.String()+"/"+ref.Name == name {
+			return ref, true
+		}
+	}
+
+	return
+}
+
+// FilterByType returns the Refs of the given type
+func (rs Refs) FilterByType(rt RefType) Refs {
+	refs := make(Refs)
+	for k, r := range rs {
+		if r.Type == rt {
+			refs[k] = r
+		}
+	}
+	return refs
+}
+
 // Search looks up for references by Name in a fuzzy finding fashion, it will return
 // them sorted by pertinence
-func (rs Refs) Search(filter string, limit int) (refs RankedRefs) {
-	for _, r := range rs {
+func (rs Refs) Search(filter string, limit int) RankedRefs {
+	return rs.SearchWithUsage(filter, limit, RefsUsage{})
+}
+
+// SearchWithUsage looks up for references like Search, ranking the most used,
+// the most recently updated branches and the latest tags first amongst the ones
+// matching the filter as closely
+func (rs Refs) SearchWithUsage(filter string, limit int, usage RefsUsage) (refs RankedRefs) {
+	now := time.Now()
+	for k, r := range rs {
 		if rank := fuzzy.RankMatchNormalizedFold(filter, r.Name); rank >= 0 {
-			refs = append(refs, &RankedRef{
-				Ref:  r,
-				Rank: rank,
-			})
+			rr := &RankedRef{
+				Ref:   r,
+				Rank:  rank,
+				Score: nameMatchScore(filter, r.Name, rank) + usageScore(usage.User[k], usage.Global[k]),
+			}
+
+			// Tags get ranked by version instead
+			if r.Type != RefTypeTag {
+				rr.Score += recencyScore(r.CommittedAt, now)
+			}
+
+			refs = append(refs, rr)
 		}
 	}
 
+	refs.addSemverScores()
+
 	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Score != refs[j].Score {
+			return refs[i].Score > refs[j].Score
+		}
 		if refs[i].Rank == refs[j].Rank {
 			return refs[i].Name > refs[j].Name
 		}
@@ -117,3 +213,8 @@ func (rs Refs) GetByClosestNameMatch(name string) (ref Ref) {
 func (r Ref) IsEmpty() bool {
 	return r.Name == ""
 }
+
+// IsIdenticalTo returns whether both refs are known to point to the same commit
+func (r Ref) IsIdenticalTo(o Ref) bool {
+	return r.SHA != "" && r.SHA == o.SHA
+}
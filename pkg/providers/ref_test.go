@@ -36,3 +36,76 @@ func TestRefsGetByKey(t *testing.T) {
 	assert.False(t, ok)
 	assert.Equal(t, Ref{}, foundRef)
 }
+
+func TestRefsGetByName(t *testing.T) {
+	branch := Ref{
+		Name: "v1",
+		Type: RefTypeBranch,
+	}
+	tag := Ref{
+		Name: "v1.0.0",
+		Type: RefTypeTag,
+	}
+	rs := Refs{
+		branch.Key(): branch,
+		tag.Key():    tag,
+	}
+
+	foundRef, ok := rs.GetByName("v1")
+	assert.True(t, ok)
+	assert.Equal(t, branch, foundRef)
+
+	foundRef, ok = rs.GetByName("tag/v1.0.0")
+	assert.True(t, ok)
+	assert.Equal(t, tag, foundRef)
+
+	_, ok = rs.GetByName("v1.0")
+	assert.False(t, ok)
+
+	// Branches prevail over the tags sharing their name
+	sameNameTag := Ref{Name: "v1", Type: RefTypeTag}
+	rs[sameNameTag.Key()] = sameNameTag
+	for i := 0; i < 10; i++ {
+		foundRef, ok = rs.GetByName("v1")
+		assert.True(t, ok)
+		assert.Equal(t, branch, foundRef)
+	}
+
+	foundRef, ok = rs.GetByName("tag/v1")
+	assert.True(t, ok)
+	assert.Equal(t, sameNameTag, foundRef)
+}
+
+func TestGetRefTypeFromString(t *testing.T) {
+	rt, err := GetRefTypeFromString("tag")
+	assert.NoError(t, err)
+	assert.Equal(t, RefTypeTag, rt)
+
+	_, err = GetRefTypeFromString("foo")
+	assert.Error(t, err)
+}
+
+func TestRefsFilterByType(t *testing.T) {
+	branch := Ref{Name: "v1", Type: RefTypeBranch}
+	tag := Ref{Name: "v1", Type: RefTypeTag}
+	rs := Refs{
+		branch.Key(): branch,
+		tag.Key():    tag,
+	}
+
+	assert.Equal(t, Refs{tag.Key(): tag}, rs.FilterByType(RefTypeTag))
+	assert.Empty(t, rs.FilterByType(RefTypeEnvironment))
+}
+
+func TestRankedRefsIsAmbiguous(t *testing.T) {
+	assert.False(t, RankedRefs{}.IsAmbiguous())
+	assert.False(t, RankedRefs{{Rank: 0}}.IsAmbiguous())
+	assert.False(t, RankedRefs{{Rank: 0}, {Rank: 1}}.IsAmbiguous())
+	assert.True(t, RankedRefs{{Rank: 1}, {Rank: 1}}.IsAmbiguous())
+}
+
+func TestRefIsIdenticalTo(t *testing.T) {
+	assert.True(t, Ref{Name: "main", SHA: "abc"}.IsIdenticalTo(Ref{Name: "v1.0.0", SHA: "abc"}))
+	assert.False(t, Ref{Name: "main", SHA: "abc"}.IsIdenticalTo(Ref{Name: "v1.0.0", SHA: "def"}))
+	assert.False(t, Ref{Name: "main"}.IsIdenticalTo(Ref{Name: "v1.0.0"}))
+}
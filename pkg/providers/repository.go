@@ -17,6 +17,11 @@ type Repository struct {
 	RefsLastUpdate        time.Time
 	RefsCurrentlyUpdating bool
 	WebURL                string
+
+	// RefsLastError is the error the last update of the refs failed with, and
+	// RefsFailures the amount of consecutive updates which failed
+	RefsLastError string
+	RefsFailures  int
 }
 
 // RepositoryKey is a unique identifier for a Repository
@@ -32,15 +37,23 @@ func (r Repository) Key() RepositoryKey {
 type Repositories map[RepositoryKey]Repository
 
 // RankedRepository can be used when fuzzy searching Repositories, attributing a "rank"
-// for the Repository given the pertinence of its attributes given the search
+// for the Repository given the pertinence of its attributes given the search. The
+// Score blends it with the usage of the Repository
 type RankedRepository struct {
 	Repository
-	Rank int
+	Rank  int
+	Score float64
 }
 
 // RankedRepositories is a slice of *RankedRepository
 type RankedRepositories []*RankedRepository
 
+// IsAmbiguous returns whether the best match cannot be determined with
+// certainty, the two most pertinent Repositories sharing the same rank
+func (rrs RankedRepositories) IsAmbiguous() bool {
+	return len(rrs) > 1 && rrs[0].Rank == rrs[1].Rank
+}
+
 // GetByKey returns a Repository given its RepositoryKey
 func (rs Repositories) GetByKey(k RepositoryKey) (r Repository, ok bool) {
 	r, ok = rs[k]
@@ -49,22 +62,32 @@ func (rs Repositories) GetByKey(k RepositoryKey) (r Repository, ok bool) {
 
 // Search looks up for repositories by Name in a fuzzy finding fashion, it will return
 // them sorted by pertinence
-func (rs Repositories) Search(filter string, limit int) (repos RankedRepositories) {
-	for _, r := range rs {
-		if len(filter) == 0 {
-			repos = append(repos, &RankedRepository{
-				Repository: r,
-				Rank:       0,
-			})
-		} else if rank := fuzzy.RankMatchNormalizedFold(filter, r.Name); rank >= 0 {
-			repos = append(repos, &RankedRepository{
-				Repository: r,
-				Rank:       rank,
-			})
+func (rs Repositories) Search(filter string, limit int) RankedRepositories {
+	return rs.SearchWithUsage(filter, limit, RepositoriesUsage{})
+}
+
+// SearchWithUsage looks up for repositories like Search, ranking the most used
+// ones first amongst the ones matching the filter as closely
+func (rs Repositories) SearchWithUsage(filter string, limit int, usage RepositoriesUsage) (repos RankedRepositories) {
+	for k, r := range rs {
+		rank := 0
+		if len(filter) > 0 {
+			if rank = fuzzy.RankMatchNormalizedFold(filter, r.Name); rank < 0 {
+				continue
+			}
 		}
+
+		repos = append(repos, &RankedRepository{
+			Repository: r,
+			Rank:       rank,
+			Score:      nameMatchScore(filter, r.Name, rank) + usageScore(usage.User[k], usage.Global[k]),
+		})
 	}
 
 	sort.SliceStable(repos, func(i, j int) bool {
+		if repos[i].Score != repos[j].Score {
+			return repos[i].Score > repos[j].Score
+		}
 		if repos[i].Rank == repos[j].Rank {
 			return repos[i].Name > repos[j].Name
 		}
@@ -96,3 +119,26 @@ func (rs Repositories) GetByClosestNameMatch(name string) (repo Repository) {
 func (r Repository) IsEmpty() bool {
 	return r.Name == ""
 }
+
+// KeysByRefsStaleness returns the keys of the Repositories in the order their
+// refs should be updated: the least recently updated first, the ones whose last
+// update failed last
+func (rs Repositories) KeysByRefsStaleness() (keys []RepositoryKey) {
+	for k := range rs {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rs[keys[i]], rs[keys[j]]
+		if (ri.RefsFailures > 0) != (rj.RefsFailures > 0) {
+			return rj.RefsFailures > 0
+		}
+
+		if !ri.RefsLastUpdate.Equal(rj.RefsLastUpdate) {
+			return ri.RefsLastUpdate.Before(rj.RefsLastUpdate)
+		}
+
+		return keys[i] < keys[j]
+	})
+	return
+}
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,3 +30,27 @@ func TestRepositoriesGetByKey(t *testing.T) {
 	assert.False(t, ok)
 	assert.Equal(t, Repository{}, foundRepository)
 }
+
+func TestRankedRepositoriesIsAmbiguous(t *testing.T) {
+	assert.False(t, RankedRepositories{{Rank: 0}, {Rank: 3}}.IsAmbiguous())
+	assert.True(t, RankedRepositories{{Rank: 2}, {Rank: 2}}.IsAmbiguous())
+}
+
+func TestRepositoriesKeysByRefsStaleness(t *testing.T) {
+	now := time.Now()
+	rs := make(Repositories)
+	for _, r := range []Repository{
+		{Name: "recent", RefsLastUpdate: now},
+		{Name: "old", RefsLastUpdate: now.Add(-time.Hour)},
+		{Name: "never"},
+		{Name: "failing", RefsFailures: 2},
+	} {
+		rs[r.Key()] = r
+	}
+
+	var names []string
+	for _, k := range rs.KeysByRefsStaleness() {
+		names = append(names, rs[k].Name)
+	}
+	assert.Equal(t, []string{"never", "old", "recent", "failing"}, names)
+}
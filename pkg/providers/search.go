@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weights of the signals blended into the scores of the search results. How
+// closely the names match the filter prevails, the usage and recency of the
+// repositories and refs then telling apart the ones matching it equally well
+const (
+	searchExactMatchScore         = 100.0
+	searchSegmentMatchScore       = 50.0
+	searchPrefixMatchScore        = 30.0
+	searchSegmentPrefixMatchScore = 20.0
+	searchFuzzyRankPenalty        = 1.0
+	searchUserUsageWeight         = 10.0
+	searchGlobalUsageWeight       = 5.0
+	searchRecencyWeight           = 10.0
+	searchSemverWeight            = 10.0
+
+	// searchRecencyHalfLife is the age at which a branch gets half of the
+	// recency score of one which has just been updated
+	searchRecencyHalfLife = 7 * 24 * time.Hour
+)
+
+// nameSeparators delimit the segments of the names of the repositories and
+// refs (eg: platform/api-gateway is made of platform, api and gateway)
+const nameSeparators = "/-_."
+
+// semverPattern matches the names of the tags following semantic versioning
+var semverPattern = regexp.MustCompile(`^[vV]?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// RepositoriesUsage holds how many times the repositories got compared, by the
+// user searching them and by everyone
+type RepositoriesUsage struct {
+	User   map[RepositoryKey]int
+	Global map[RepositoryKey]int
+}
+
+// RefsUsage holds how many times the refs of a repository got compared, by the
+// user searching them and by everyone
+type RefsUsage struct {
+	User   map[RefKey]int
+	Global map[RefKey]int
+}
+
+// nameMatchScore scores how closely the name matches the filter given its fuzzy
+// rank, exact matches of the name or of one of its segments (eg: api for
+// platform/api) coming first, then the prefixes
+func nameMatchScore(filter, name string, rank int) (score float64) {
+	if len(filter) == 0 {
+		return
+	}
+
+	filter, name = strings.ToLower(filter), strings.ToLower(name)
+	segments := strings.FieldsFunc(name, func(r rune) bool {
+		return strings.ContainsRune(nameSeparators, r)
+	})
+
+	switch {
+	case name == filter:
+		score = searchExactMatchScore
+	case containsString(segments, filter):
+		score = searchSegmentMatchScore
+	case strings.HasPrefix(name, filter):
+		score = searchPrefixMatchScore
+	case segmentHasPrefix(segments, filter):
+		score = searchSegmentPrefixMatchScore
+	}
+
+	return score - float64(rank)*searchFuzzyRankPenalty
+}
+
+// usageScore scores how many times an item got used, the first uses weighing
+// more than the following ones
+func usageScore(userCount, globalCount int) float64 {
+	return searchUserUsageWeight*math.Log2(1+float64(userCount)) +
+		searchGlobalUsageWeight*math.Log2(1+float64(globalCount))
+}
+
+// recencyScore scores how recently a ref got updated, halving every searchRecencyHalfLife
+func recencyScore(updatedAt, now time.Time) float64 {
+	if updatedAt.IsZero() {
+		return 0
+	}
+
+	age := now.Sub(updatedAt)
+	if age < 0 {
+		age = 0
+	}
+
+	return searchRecencyWeight * math.Pow(0.5, float64(age)/float64(searchRecencyHalfLife))
+}
+
+// semver holds the components of a semantic version
+type semver struct {
+	numbers    [3]int
+	prerelease string
+}
+
+// parseSemver returns the semantic version of a tag name (eg: v1.2.3-rc.1)
+func parseSemver(name string) (v semver, ok bool) {
+	matches := semverPattern.FindStringSubmatch(name)
+	if matches == nil {
+		return
+	}
+
+	for i := range v.numbers {
+		if matches[i+1] == "" {
+			continue
+		}
+
+		var err error
+		if v.numbers[i], err = strconv.Atoi(matches[i+1]); err != nil {
+			return
+		}
+	}
+
+	v.prerelease = matches[4]
+	return v, true
+}
+
+// less returns whether the version precedes the other one, pre-releases
+// preceding the release of the same version
+func (v semver) less(o semver) bool {
+	for i := range v.numbers {
+		if v.numbers[i] != o.numbers[i] {
+			return v.numbers[i] < o.numbers[i]
+		}
+	}
+
+	if (v.prerelease == "") != (o.prerelease == "") {
+		return v.prerelease != ""
+	}
+
+	return v.prerelease < o.prerelease
+}
+
+// addSemverScores scores the tags following semantic versioning given their
+// order, the latest version getting the full searchSemverWeight
+func (rrs RankedRefs) addSemverScores() {
+	type versionedRef struct {
+		ref     *RankedRef
+		version semver
+	}
+
+	var tags []versionedRef
+	for _, r := range rrs {
+		if r.Type != RefTypeTag {
+			continue
+		}
+
+		if v, ok := parseSemver(r.Name); ok {
+			tags = append(tags, versionedRef{ref: r, version: v})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].version.less(tags[j].version)
+	})
+
+	for i, t := range tags {
+		t.ref.Score += searchSemverWeight * float64(i+1) / float64(len(tags))
+	}
+}
+
+// containsString returns whether the slice contains the string
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentHasPrefix returns whether one of the segments starts with the prefix
+func segmentHasPrefix(segments []string, prefix string) bool {
+	for _, s := range segments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameMatchScore(t *testing.T) {
+	assert.Zero(t, nameMatchScore("", "platform/api", 12))
+	assert.Equal(t, searchExactMatchScore, nameMatchScore("API", "api", 0))
+	assert.Equal(t, searchSegmentMatchScore-9, nameMatchScore("api", "platform/api", 9))
+	assert.Equal(t, searchPrefixMatchScore-5, nameMatchScore("plat", "platform/api", 5))
+	assert.Equal(t, searchSegmentPrefixMatchScore-8, nameMatchScore("gate", "platform/api-gateway", 8))
+	assert.Equal(t, -4.0, nameMatchScore("ptfm", "platform", 4))
+}
+
+func TestUsageScore(t *testing.T) {
+	assert.Zero(t, usageScore(0, 0))
+	assert.Equal(t, searchUserUsageWeight+searchGlobalUsageWeight*2, usageScore(1, 3))
+	assert.Greater(t, usageScore(2, 0), usageScore(0, 2))
+}
+
+func TestRecencyScore(t *testing.T) {
+	now := time.Now()
+	assert.Zero(t, recencyScore(time.Time{}, now))
+	assert.Equal(t, searchRecencyWeight, recencyScore(now.Add(time.Hour), now))
+	assert.InDelta(t, searchRecencyWeight/2, recencyScore(now.Add(-searchRecencyHalfLife), now), 0.001)
+}
+
+func TestParseSemver(t *testing.T) {
+	v, ok := parseSemver("v1.2.3-rc.1")
+	assert.True(t, ok)
+	assert.Equal(t, semver{numbers: [3]int{1, 2, 3}, prerelease: "rc.1"}, v)
+
+	v, ok = parseSemver("2.0")
+	assert.True(t, ok)
+	assert.Equal(t, semver{numbers: [3]int{2, 0, 0}}, v)
+
+	_, ok = parseSemver("release-1")
+	assert.False(t, ok)
+}
+
+func TestSemverLess(t *testing.T) {
+	parse := func(s string) semver {
+		v, _ := parseSemver(s)
+		return v
+	}
+
+	assert.True(t, parse("v1.9.0").less(parse("v1.10.0")))
+	assert.True(t, parse("v1.0.0-rc.1").less(parse("v1.0.0")))
+	assert.True(t, parse("v1.0.0-alpha").less(parse("v1.0.0-beta")))
+	assert.False(t, parse("v2.0.0").less(parse("v1.99.99")))
+}
+
+func TestRefsSearchWithUsage(t *testing.T) {
+	now := time.Now()
+	refs := Refs{}
+	for _, r := range []Ref{
+		{Name: "main", Type: RefTypeBranch, CommittedAt: now.Add(-time.Hour)},
+		{Name: "maint", Type: RefTypeBranch, CommittedAt: now.Add(-90 * 24 * time.Hour)},
+		{Name: "feature/login", Type: RefTypeBranch, CommittedAt: now.Add(-24 * time.Hour)},
+		{Name: "fix/login", Type: RefTypeBranch, CommittedAt: now.Add(-60 * 24 * time.Hour)},
+		{Name: "v1.9.0", Type: RefTypeTag},
+		{Name: "v1.10.0", Type: RefTypeTag},
+		{Name: "v1.10.0-rc.1", Type: RefTypeTag},
+	} {
+		refs[r.Key()] = r
+	}
+
+	names := func(rrs RankedRefs) (names []string) {
+		for _, r := range rrs {
+			names = append(names, r.Name)
+		}
+		return
+	}
+
+	// Exact matches first
+	assert.Equal(t, []string{"main", "maint"}, names(refs.Search("main", 2)))
+
+	// Equal matches get ranked by recency
+	assert.Equal(t, []string{"feature/login", "fix/login"}, names(refs.Search("login", 2)))
+
+	// And the tags by version
+	assert.Equal(t, []string{"v1.10.0", "v1.10.0-rc.1", "v1.9.0"}, names(refs.FilterByType(RefTypeTag).Search("", 3)))
+
+	// Unless some refs got used more
+	fixLogin := Ref{Name: "fix/login", Type: RefTypeBranch}
+	assert.Equal(t, "fix/login", refs.SearchWithUsage("login", 1, RefsUsage{
+		User: map[RefKey]int{fixLogin.Key(): 2},
+	})[0].Name)
+}
+
+func TestRepositoriesSearchWithUsage(t *testing.T) {
+	repos := Repositories{}
+	for _, name := range []string{"platform/api", "alice/api", "bob/apix", "foo/rapid"} {
+		r := Repository{Name: name, ProviderType: ProviderTypeGitHub}
+		repos[r.Key()] = r
+	}
+
+	// Shorter names matching a segment come first without usage, fuzzy matches last
+	rrs := repos.Search("api", 10)
+	assert.Len(t, rrs, 4)
+	assert.Equal(t, "alice/api", rrs[0].Name)
+	assert.Equal(t, "foo/rapid", rrs[3].Name)
+
+	// The repositories used by everyone get ranked first
+	platformAPI := Repository{Name: "platform/api", ProviderType: ProviderTypeGitHub}
+	rrs = repos.SearchWithUsage("api", 10, RepositoriesUsage{
+		Global: map[RepositoryKey]int{platformAPI.Key(): 10},
+	})
+	assert.Equal(t, "platform/api", rrs[0].Name)
+	assert.Equal(t, 9, rrs[0].Rank)
+
+	// Exact matches still prevail
+	assert.Equal(t, "alice/api", repos.SearchWithUsage("alice/api", 1, RepositoriesUsage{
+		Global: map[RepositoryKey]int{platformAPI.Key(): 10},
+	})[0].Name)
+}
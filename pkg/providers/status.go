@@ -0,0 +1,60 @@
+package providers
+
+// CommitStatusState represents the state of the CI pipelines/checks of a commit.
+// The values are ordered by precedence, the highest one being the one to retain
+// when merging multiple states together
+type CommitStatusState uint8
+
+const (
+	// CommitStatusStateUnknown when no pipelines or checks were found, or they
+	// got skipped
+	CommitStatusStateUnknown CommitStatusState = iota
+
+	// CommitStatusStateSuccess when all pipelines or checks succeeded
+	CommitStatusStateSuccess
+
+	// CommitStatusStateCanceled when pipelines or checks got canceled
+	CommitStatusStateCanceled
+
+	// CommitStatusStatePending when pipelines or checks are waiting to be run,
+	// manual actions included
+	CommitStatusStatePending
+
+	// CommitStatusStateRunning when pipelines or checks are currently running
+	CommitStatusStateRunning
+
+	// CommitStatusStateFailure when at least one pipeline or check failed
+	CommitStatusStateFailure
+)
+
+// String returns the state as a readable string
+func (s CommitStatusState) String() string {
+	return [...]string{
+		"unknown",
+		"success",
+		"canceled",
+		"pending",
+		"running",
+		"failure",
+	}[s]
+}
+
+// Merge returns the state which has the highest precedence
+func (s CommitStatusState) Merge(o CommitStatusState) CommitStatusState {
+	if o > s {
+		return o
+	}
+	return s
+}
+
+// CommitStatus holds the CI status of the head commit of a Ref
+type CommitStatus struct {
+	SHA    string
+	State  CommitStatusState
+	WebURL string
+}
+
+// IsEmpty assess the variable is empty or not
+func (cs CommitStatus) IsEmpty() bool {
+	return cs.State == CommitStatusStateUnknown
+}
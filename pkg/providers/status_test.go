@@ -0,0 +1,22 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitStatusStateString(t *testing.T) {
+	assert.Equal(t, "unknown", CommitStatusStateUnknown.String())
+	assert.Equal(t, "success", CommitStatusStateSuccess.String())
+	assert.Equal(t, "canceled", CommitStatusStateCanceled.String())
+	assert.Equal(t, "pending", CommitStatusStatePending.String())
+	assert.Equal(t, "running", CommitStatusStateRunning.String())
+	assert.Equal(t, "failure", CommitStatusStateFailure.String())
+}
+
+func TestCommitStatusStateMerge(t *testing.T) {
+	assert.Equal(t, CommitStatusStateSuccess, CommitStatusStateUnknown.Merge(CommitStatusStateSuccess))
+	assert.Equal(t, CommitStatusStateRunning, CommitStatusStateRunning.Merge(CommitStatusStateSuccess))
+	assert.Equal(t, CommitStatusStateFailure, CommitStatusStateRunning.Merge(CommitStatusStateFailure))
+}
@@ -0,0 +1,229 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// CommandType represents the type of subcommand given to the slash command
+type CommandType uint8
+
+const (
+	// CommandTypeCompare opens the modal or posts a comparison (default)
+	CommandTypeCompare CommandType = iota
+
+	// CommandTypeHelp displays the usage of the command
+	CommandTypeHelp
+
+	// CommandTypeRefresh triggers an update of the repositories or refs lists
+	CommandTypeRefresh
+
+	// CommandTypeWatch lists or runs the watches of the channel
+	CommandTypeWatch
+
+	// CommandTypeBind binds a repository to the channel
+	CommandTypeBind
+
+	// CommandTypeUnbind removes the binding of a repository to the channel
+	CommandTypeUnbind
+
+	// CommandTypeLast reopens the last comparison of the user
+	CommandTypeLast
+
+	// CommandTypePrefer sets the preferred behavior of the user when all the
+	// arguments of the command are given
+	CommandTypePrefer
+
+	// CommandTypeHistory lists the latest comparisons requested from the channel
+	CommandTypeHistory
+
+	// CommandTypeFavorites lists the comparisons pinned to the channel
+	CommandTypeFavorites
+)
+
+// String returns the name of the subcommand
+func (ct CommandType) String() string {
+	return [...]string{
+		"compare",
+		"help",
+		"refresh",
+		"watch",
+		"bind",
+		"unbind",
+		"last",
+		"prefer",
+		"history",
+		"favorites",
+	}[ct]
+}
+
+// Usage returns the usage of the subcommand
+func (ct CommandType) Usage() string {
+	return [...]string{
+		"`/compare [repository] [from_ref] [to_ref] [--post|--ephemeral] [--type=branch|tag|env|commit]`",
+		"`/compare help`",
+		"`/compare refresh [repository]`",
+		"`/compare watch [list|run]`",
+		"`/compare bind [repository]`",
+		"`/compare unbind <repository>`",
+		"`/compare last [--post|--ephemeral]`",
+		"`/compare prefer <modal|post>`",
+		"`/compare history [repository]`",
+		"`/compare favorites`",
+	}[ct]
+}
+
+// Command holds the parsed content of a slash command
+type Command struct {
+	Type  CommandType
+	Args  []string
+	Flags CommandFlags
+}
+
+// CommandFlags holds the flags which can be given to the slash command
+type CommandFlags struct {
+	// Post the comparison straight into the channel, without opening the modal
+	Post bool
+
+	// Ephemeral renders the comparison as a preview only visible to the requester,
+	// who can then decide to post it to the channel or discard it
+	Ephemeral bool
+
+	// RefType restricts the lookup of the refs to a given type
+	RefType *providers.RefType
+}
+
+// CommandUsageError is returned when the slash command could not be parsed
+type CommandUsageError struct {
+	Type    CommandType
+	Message string
+}
+
+// Error implements the error interface
+func (e CommandUsageError) Error() string {
+	return fmt.Sprintf(":warning: %s\nusage: %s", e.Message, e.Type.Usage())
+}
+
+var subcommands = map[string]CommandType{
+	"help":      CommandTypeHelp,
+	"refresh":   CommandTypeRefresh,
+	"watch":     CommandTypeWatch,
+	"bind":      CommandTypeBind,
+	"unbind":    CommandTypeUnbind,
+	"last":      CommandTypeLast,
+	"prefer":    CommandTypePrefer,
+	"history":   CommandTypeHistory,
+	"favorites": CommandTypeFavorites,
+}
+
+// ParseCommand parses the text given to the slash command
+func ParseCommand(text string) (cmd Command, err error) {
+	var args []string
+	for _, field := range strings.Fields(text) {
+		if !strings.HasPrefix(field, "--") {
+			args = append(args, field)
+			continue
+		}
+
+		if err = cmd.Flags.parse(field); err != nil {
+			return
+		}
+	}
+
+	if len(args) > 0 {
+		if ct, found := subcommands[args[0]]; found {
+			cmd.Type = ct
+			args = args[1:]
+		}
+	}
+
+	cmd.Args = args
+	usageErr := func(format string, a ...interface{}) error {
+		return CommandUsageError{Type: cmd.Type, Message: fmt.Sprintf(format, a...)}
+	}
+
+	switch cmd.Type {
+	case CommandTypeCompare:
+		if len(cmd.Args) > 3 {
+			return cmd, usageErr("too many arguments")
+		}
+	case CommandTypeHelp, CommandTypeLast, CommandTypeFavorites:
+		if len(cmd.Args) > 0 {
+			return cmd, usageErr("unexpected argument '%s'", cmd.Args[0])
+		}
+	case CommandTypeRefresh, CommandTypeBind, CommandTypeHistory:
+		if len(cmd.Args) > 1 {
+			return cmd, usageErr("too many arguments")
+		}
+	case CommandTypeUnbind:
+		if len(cmd.Args) != 1 {
+			return cmd, usageErr("a repository is required")
+		}
+	case CommandTypePrefer:
+		if len(cmd.Args) != 1 || (cmd.Args[0] != "modal" && cmd.Args[0] != "post") {
+			return cmd, usageErr("either 'modal' or 'post' is required")
+		}
+	case CommandTypeWatch:
+		if len(cmd.Args) > 1 || (len(cmd.Args) == 1 && cmd.Args[0] != "list" && cmd.Args[0] != "run") {
+			return cmd, usageErr("invalid arguments")
+		}
+	}
+
+	if cmd.Type != CommandTypeCompare && cmd.Type != CommandTypeLast &&
+		(cmd.Flags.Post || cmd.Flags.Ephemeral || cmd.Flags.RefType != nil) {
+		return cmd, usageErr("flags are not supported by the '%s' subcommand", cmd.Type)
+	}
+
+	if cmd.Type == CommandTypeLast && cmd.Flags.RefType != nil {
+		return cmd, usageErr("the '--type' flag is not supported by the 'last' subcommand")
+	}
+
+	if cmd.Flags.Post && cmd.Flags.Ephemeral {
+		return cmd, usageErr("'--post' and '--ephemeral' cannot be used together")
+	}
+
+	return
+}
+
+func (f *CommandFlags) parse(flag string) error {
+	name, value := flag, ""
+	if i := strings.Index(flag, "="); i != -1 {
+		name, value = flag[:i], flag[i+1:]
+	}
+
+	switch name {
+	case "--post":
+		f.Post = true
+	case "--ephemeral":
+		f.Ephemeral = true
+	case "--type":
+		rt, err := providers.GetRefTypeFromString(value)
+		if err != nil {
+			return CommandUsageError{Type: CommandTypeCompare, Message: err.Error()}
+		}
+		f.RefType = &rt
+	default:
+		return CommandUsageError{Type: CommandTypeHelp, Message: fmt.Sprintf("unknown flag '%s'", name)}
+	}
+
+	return nil
+}
+
+// CommandHelp returns the usage of all the subcommands
+func CommandHelp() string {
+	return strings.Join([]string{
+		"*Usage*",
+		CommandTypeCompare.Usage() + " compare refs of a repository",
+		CommandTypeLast.Usage() + " compare your last refs again",
+		CommandTypePrefer.Usage() + " open the modal or post directly when all the arguments are given",
+		CommandTypeRefresh.Usage() + " refresh the repositories list, or the refs of a repository",
+		CommandTypeBind.Usage() + " bind a repository to this channel, or list the bound ones",
+		CommandTypeUnbind.Usage() + " remove a repository binding from this channel",
+		CommandTypeWatch.Usage() + " list or run the watches posting in this channel",
+		CommandTypeHistory.Usage() + " list the latest comparisons requested from this channel",
+		CommandTypeFavorites.Usage() + " list the comparisons pinned to this channel from the App Home tab",
+		CommandTypeHelp.Usage() + " display this message",
+	}, "\n")
+}
@@ -0,0 +1,83 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	cmd, err := ParseCommand("")
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Type: CommandTypeCompare}, cmd)
+
+	cmd, err = ParseCommand(" foo/bar  main --type=tag v1.0.0 --post")
+	assert.NoError(t, err)
+	tag := providers.RefTypeTag
+	assert.Equal(t, Command{
+		Type: CommandTypeCompare,
+		Args: []string{"foo/bar", "main", "v1.0.0"},
+		Flags: CommandFlags{
+			Post:    true,
+			RefType: &tag,
+		},
+	}, cmd)
+
+	cmd, err = ParseCommand("refresh foo/bar")
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Type: CommandTypeRefresh, Args: []string{"foo/bar"}}, cmd)
+
+	cmd, err = ParseCommand("last --ephemeral")
+	assert.NoError(t, err)
+	assert.Equal(t, CommandTypeLast, cmd.Type)
+	assert.Empty(t, cmd.Args)
+	assert.Equal(t, CommandFlags{Ephemeral: true}, cmd.Flags)
+
+	cmd, err = ParseCommand("prefer post")
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Type: CommandTypePrefer, Args: []string{"post"}}, cmd)
+
+	cmd, err = ParseCommand("watch run")
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Type: CommandTypeWatch, Args: []string{"run"}}, cmd)
+
+	cmd, err = ParseCommand("history foo")
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Type: CommandTypeHistory, Args: []string{"foo"}}, cmd)
+
+	cmd, err = ParseCommand("favorites")
+	assert.NoError(t, err)
+	assert.Equal(t, CommandTypeFavorites, cmd.Type)
+	assert.Empty(t, cmd.Args)
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	for _, text := range []string{
+		"foo bar baz qux",
+		"--foo",
+		"foo --type=bar",
+		"foo --post --ephemeral",
+		"help foo",
+		"refresh --post",
+		"unbind",
+		"watch foo",
+		"last --type=tag",
+		"favorites foo",
+		"prefer",
+		"prefer foo",
+		"history foo bar",
+		"history --post",
+	} {
+		_, err := ParseCommand(text)
+		assert.Error(t, err, text)
+		assert.IsType(t, CommandUsageError{}, err, text)
+	}
+}
+
+func TestCommandUsageError(t *testing.T) {
+	assert.Equal(t, ":warning: a repository is required\nusage: `/compare unbind <repository>`", CommandUsageError{
+		Type:    CommandTypeUnbind,
+		Message: "a repository is required",
+	}.Error())
+}
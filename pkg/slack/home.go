@@ -0,0 +1,110 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/slack-go/slack"
+	"github.com/xeonx/timeago"
+)
+
+// HomeTabComparison holds the details of a comparison listed in the App Home tab
+type HomeTabComparison struct {
+	// Key is used to identify the comparison when interacting with its buttons
+	Key        string
+	Repository providers.Repository
+	FromRef    providers.Ref
+	ToRef      providers.Ref
+	ComparedAt time.Time
+
+	// ChannelID is the channel the comparison got requested from, or pinned for
+	ChannelID string
+}
+
+// HomeTabOptions ..
+type HomeTabOptions struct {
+	Favorites        []HomeTabComparison
+	ChannelFavorites []HomeTabComparison
+	Recent           []HomeTabComparison
+}
+
+// GetHomeTabRequest ..
+func GetHomeTabRequest(opts HomeTabOptions) (htvr slack.HomeTabViewRequest) {
+	htvr.Type = slack.VTHomeTab
+
+	htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, ":star: Favorites", true, false)))
+	if len(opts.Favorites) == 0 {
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "_pin a recent comparison to find it here_", false, false)))
+	}
+
+	for _, hc := range opts.Favorites {
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, homeTabComparisonBlocks(hc, false, homeTabButton("home_unpin", "Unpin", hc))...)
+	}
+
+	// The favorites of the channels are only listed once some got pinned
+	if len(opts.ChannelFavorites) > 0 {
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewDividerBlock())
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, ":busts_in_silhouette: Channel favorites", true, false)))
+	}
+
+	for _, hc := range opts.ChannelFavorites {
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, homeTabComparisonBlocks(hc, true, homeTabButton("home_unpin_channel", "Unpin from channel", hc))...)
+	}
+
+	htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewDividerBlock())
+	htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, ":clock3: Recent comparisons", true, false)))
+	if len(opts.Recent) == 0 {
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "_use the `/compare` command to get started_", false, false)))
+	}
+
+	for _, hc := range opts.Recent {
+		buttons := []slack.BlockElement{homeTabButton("home_pin", "Pin", hc)}
+		if IsChannelID(hc.ChannelID) {
+			buttons = append(buttons, homeTabButton("home_pin_channel", "Pin to channel", hc))
+		}
+		htvr.Blocks.BlockSet = append(htvr.Blocks.BlockSet, homeTabComparisonBlocks(hc, false, buttons...)...)
+	}
+
+	return
+}
+
+// IsChannelID returns whether a conversation ID references a public or private
+// channel, rather than a direct message
+func IsChannelID(conversationID string) bool {
+	return strings.HasPrefix(conversationID, "C") || strings.HasPrefix(conversationID, "G")
+}
+
+func homeTabButton(actionID, text string, hc HomeTabComparison) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(actionID, hc.Key, slack.NewTextBlockObject(slack.PlainTextType, text, false, false))
+}
+
+func homeTabComparisonBlocks(hc HomeTabComparison, pinned bool, buttons ...slack.BlockElement) []slack.Block {
+	text := fmt.Sprintf(
+		":%s: *%s*\n`%s/%s` :arrow_right: `%s/%s`",
+		hc.Repository.ProviderType,
+		hc.Repository.Name,
+		hc.FromRef.Type,
+		hc.FromRef.Name,
+		hc.ToRef.Type,
+		hc.ToRef.Name,
+	)
+
+	switch {
+	case pinned:
+		text += fmt.Sprintf("\n_pinned in <#%s>_", hc.ChannelID)
+	case !hc.ComparedAt.IsZero() && IsChannelID(hc.ChannelID):
+		text += fmt.Sprintf("\n_compared %s in <#%s>_", timeago.English.Format(hc.ComparedAt), hc.ChannelID)
+	case !hc.ComparedAt.IsZero():
+		text += fmt.Sprintf("\n_compared %s_", timeago.English.Format(hc.ComparedAt))
+	}
+
+	compareButton := homeTabButton("home_compare", "Compare again", hc)
+	compareButton.WithStyle(slack.StylePrimary)
+
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewActionBlock("", append([]slack.BlockElement{compareButton}, buttons...)...),
+	}
+}
@@ -0,0 +1,44 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsChannelID(t *testing.T) {
+	assert.True(t, IsChannelID("C123"))
+	assert.True(t, IsChannelID("G123"))
+	assert.False(t, IsChannelID("D123"))
+	assert.False(t, IsChannelID("U123"))
+	assert.False(t, IsChannelID(""))
+}
+
+func TestGetHomeTabRequest(t *testing.T) {
+	hc := HomeTabComparison{
+		Key:        "1/2/3/C1",
+		Repository: providers.Repository{Name: "foo/bar"},
+		FromRef:    providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag},
+		ToRef:      providers.Ref{Name: "main", Type: providers.RefTypeBranch},
+		ChannelID:  "C1",
+	}
+
+	b, err := json.Marshal(GetHomeTabRequest(HomeTabOptions{Recent: []HomeTabComparison{hc}}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"action_id":"home_pin_channel"`)
+	assert.NotContains(t, string(b), "Channel favorites")
+
+	b, err = json.Marshal(GetHomeTabRequest(HomeTabOptions{ChannelFavorites: []HomeTabComparison{hc}}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Channel favorites")
+	assert.Contains(t, string(b), `"action_id":"home_unpin_channel"`)
+	assert.Contains(t, string(b), `pinned in \u003c#C1\u003e`)
+
+	// Comparisons requested from direct messages cannot be pinned to a channel
+	hc.ChannelID = "D1"
+	b, err = json.Marshal(GetHomeTabRequest(HomeTabOptions{Recent: []HomeTabComparison{hc}}))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "home_pin_channel")
+}
@@ -7,20 +7,33 @@ import (
 
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 	"github.com/openlyinc/pointy"
+	log "github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
 	"github.com/xeonx/timeago"
 )
 
+// optionDescriptionMaxLength is the maximum length of the descriptions of the
+// options of the selectors accepted by Slack
+const optionDescriptionMaxLength = 75
+
 // ModalRequestOptions ..
 type ModalRequestOptions struct {
 	ConversationID                  string
+	ThreadTS                        string
 	Repository                      providers.Repository
 	FromRef                         providers.Ref
 	ToRef                           providers.Ref
 	Comparison                      *providers.Comparison
 	LastRepositoriesUpdate          time.Time
+	StaleRepositoriesSources        []providers.RepositoriesSourceStatus
 	CurrentlyUpdatingRepositories   bool
 	CurrentlyUpdatingRepositoryRefs bool
+
+	// CurrentlyComparing renders the modal in a loading state while the
+	// comparison is being computed in the background, and ComparisonError
+	// explains why it could not be
+	CurrentlyComparing bool
+	ComparisonError    string
 }
 
 // ViewSubmissionResponse ..
@@ -30,15 +43,19 @@ type ViewSubmissionResponse struct {
 }
 
 // GetModalRequest ..
-func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
+func (s Slack) GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 	mvr.Type = slack.ViewType("modal")
 	mvr.Title = slack.NewTextBlockObject(slack.PlainTextType, "git compare", false, false)
 	mvr.Close = slack.NewTextBlockObject(slack.PlainTextType, "Close", false, false)
 	mvr.Submit = slack.NewTextBlockObject(slack.PlainTextType, "Post to channel", false, false)
 	mvr.CallbackID = opts.ConversationID
+	mvr.PrivateMetadata = opts.ThreadTS
 
 	if opts.CurrentlyUpdatingRepositories {
 		mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, ":repeat: updating repostories list..", true, false), nil, nil))
+		if len(opts.StaleRepositoriesSources) > 0 {
+			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, staleRepositoriesSourcesBlock(opts.StaleRepositoriesSources))
+		}
 		return
 	}
 
@@ -70,6 +87,9 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 
 	mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, repositoriesInput)
 	mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, repositoriesUpdateSection)
+	if len(opts.StaleRepositoriesSources) > 0 {
+		mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, staleRepositoriesSourcesBlock(opts.StaleRepositoriesSources))
+	}
 
 	if !opts.Repository.IsEmpty() {
 		// This is only useful when specifying the repository name as part of the slash command
@@ -92,16 +112,7 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 			fromRefElement := slack.NewOptionsSelectBlockElement(slack.OptTypeExternal, nil, fmt.Sprintf("from_ref/%s", string(opts.Repository.Key())))
 			fromRefElement.MinQueryLength = pointy.Int(0)
 			if !opts.FromRef.IsEmpty() {
-				fromRefElement.InitialOption = slack.NewOptionBlockObject(
-					fmt.Sprintf("x/%s", opts.FromRef.Key()),
-					slack.NewTextBlockObject(
-						slack.PlainTextType,
-						fmt.Sprintf("%s/%s", opts.FromRef.Type, opts.FromRef.Name),
-						true,
-						false,
-					),
-					nil,
-				)
+				fromRefElement.InitialOption = NewRefOptionBlockObject(fmt.Sprintf("x/%s", opts.FromRef.Key()), opts.FromRef)
 			}
 
 			fromRefInput := slack.NewInputBlock(
@@ -115,16 +126,7 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 			toRefElement := slack.NewOptionsSelectBlockElement(slack.OptTypeExternal, nil, fmt.Sprintf("to_ref/%s", string(opts.Repository.Key())))
 			toRefElement.MinQueryLength = pointy.Int(0)
 			if !opts.ToRef.IsEmpty() {
-				toRefElement.InitialOption = slack.NewOptionBlockObject(
-					fmt.Sprintf("x/%s", opts.ToRef.Key()),
-					slack.NewTextBlockObject(
-						slack.PlainTextType,
-						fmt.Sprintf("%s/%s", opts.ToRef.Type, opts.ToRef.Name),
-						true,
-						false,
-					),
-					nil,
-				)
+				toRefElement.InitialOption = NewRefOptionBlockObject(fmt.Sprintf("x/%s", opts.ToRef.Key()), opts.ToRef)
 			}
 
 			toRefInput := slack.NewInputBlock(
@@ -152,15 +154,51 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 				),
 			)
 
+			// Preview
+			previewInput := slack.NewInputBlock(
+				"options",
+				slack.NewTextBlockObject(slack.PlainTextType, "Options", false, false),
+				slack.NewCheckboxGroupsBlockElement(
+					"preview",
+					slack.NewOptionBlockObject(
+						"preview",
+						slack.NewTextBlockObject(slack.PlainTextType, "Preview it to me before posting", false, false),
+						nil,
+					),
+				),
+			)
+			previewInput.Optional = true
+
 			// Add the refs selectors
 			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, fromRefInput)
 			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, toRefInput)
 			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, refsUpdateSection)
+			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, previewInput)
+
+			switch {
+			case opts.CurrentlyComparing:
+				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewDividerBlock())
+				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, ":hourglass_flowing_sand: comparing refs..", false, false), nil, nil))
+				return
+			case opts.ComparisonError != "":
+				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewDividerBlock())
+				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf(":warning: *could not compare the refs*\n%s", opts.ComparisonError), false, false), nil, nil))
+				return
+			}
 
 			if opts.Comparison != nil {
 				// Add a divider
 				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewDividerBlock())
 
+				if s.Templates.ModalSummary != nil {
+					blocks, err := s.Templates.ModalSummary.Render(newTemplateData(opts.Repository, opts.FromRef, opts.ToRef, *opts.Comparison, ""))
+					if err == nil {
+						mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, blocks...)
+						return
+					}
+					log.WithError(err).Warning("falling back onto the default modal summary")
+				}
+
 				var msg string
 				if opts.Comparison.CommitCount() == 0 {
 					msg = ":shrug: there are no difference between the refs"
@@ -177,6 +215,10 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 				headerButton.URL = opts.Comparison.WebURL
 
 				mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", msg, false, false), nil, slack.NewAccessory(headerButton)))
+
+				if text := commitStatusesText(opts.FromRef, opts.ToRef, *opts.Comparison); text != "" {
+					mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", text, false, false)))
+				}
 			}
 		} else {
 			mvr.Blocks.BlockSet = append(mvr.Blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", ":repeat: updating refs list..", false, false), nil, nil))
@@ -186,8 +228,151 @@ func GetModalRequest(opts ModalRequestOptions) (mvr slack.ModalViewRequest) {
 	return
 }
 
-// GenerateComparisonMessage ..
-func GenerateComparisonMessage(repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, slackUserID string) slack.Blocks {
+// GenerateComparisonMessage renders the comparison along with buttons allowing
+// to refresh it or to notify its authors, the value is passed onto these buttons
+func (s Slack) GenerateComparisonMessage(repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, slackUserID, value string) slack.Blocks {
+	blocks := s.comparisonBlocks(repo, fromRef, toRef, cmp, slackUserID)
+
+	buttons := []slack.BlockElement{
+		slack.NewButtonBlockElement("refresh", value, slack.NewTextBlockObject(slack.PlainTextType, ":repeat: Refresh", true, false)),
+	}
+
+	// Only worth it if some of the authors can be reached
+	for _, author := range cmp.GetAuthors() {
+		if author.SlackUserID != "" {
+			buttons = append(buttons, slack.NewButtonBlockElement("notify_authors", value, slack.NewTextBlockObject(slack.PlainTextType, ":bell: Notify authors", true, false)))
+			break
+		}
+	}
+
+	blocks.BlockSet = append(blocks.BlockSet, slack.NewActionBlock("comparison", buttons...))
+	return blocks
+}
+
+// GenerateWatchesDigestMessage renders the digest of the watches whose drift
+// crossed their thresholds, one line per comparison. The comparisons themselves
+// get posted as replies to it
+func GenerateWatchesDigestMessage(comparisons []ModalRequestOptions) slack.Blocks {
+	watchesString := "watch"
+	if len(comparisons) > 1 {
+		watchesString += "es"
+	}
+
+	blocks := slack.Blocks{
+		BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", fmt.Sprintf(":calendar: *scheduled drift digest*, the drift of %d %s crossed the thresholds", len(comparisons), watchesString), false, false), nil, nil),
+		},
+	}
+
+	var text string
+	for _, opts := range comparisons {
+		commitString := "commit"
+		if opts.Comparison.CommitCount() > 1 {
+			commitString += "s"
+		}
+
+		text += fmt.Sprintf(
+			"> :%s: *<%s|%s>* `%s/%s` :arrow_right: `%s/%s` | <%s|*%d %s*>, the oldest one %s\n",
+			opts.Repository.ProviderType,
+			opts.Repository.WebURL,
+			opts.Repository.Name,
+			opts.FromRef.Type,
+			opts.FromRef.Name,
+			opts.ToRef.Type,
+			opts.ToRef.Name,
+			opts.Comparison.WebURL,
+			opts.Comparison.CommitCount(),
+			commitString,
+			timeago.English.Format(opts.Comparison.OldestCommitCreatedAt()),
+		)
+	}
+
+	for _, t := range splitText(text, sectionTextMaxLength, templateMaxSections) {
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", t, false, false), nil, nil))
+	}
+
+	blocks.BlockSet = append(blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", "_the details of each comparison are in the thread_", false, false)))
+	return blocks
+}
+
+// RemoveNotifyAuthorsButton removes the button allowing to notify the authors
+// from a message generated by GenerateComparisonMessage
+func RemoveNotifyAuthorsButton(blocks slack.Blocks) slack.Blocks {
+	for _, b := range blocks.BlockSet {
+		actions, ok := b.(*slack.ActionBlock)
+		if !ok || actions.BlockID != "comparison" {
+			continue
+		}
+
+		var elements []slack.BlockElement
+		for _, e := range actions.Elements.ElementSet {
+			if button, ok := e.(*slack.ButtonBlockElement); ok && button.ActionID == "notify_authors" {
+				continue
+			}
+			elements = append(elements, e)
+		}
+		actions.Elements.ElementSet = elements
+	}
+	return blocks
+}
+
+// GenerateAuthorNotificationMessage renders the commits of an author which are
+// part of a comparison, along with a link to the message the comparison got posted in
+func GenerateAuthorNotificationMessage(repo providers.Repository, fromRef, toRef providers.Ref, commits providers.Commits, slackUserID, permalink string) slack.Blocks {
+	commitString, verb := "commit", "is"
+	if len(commits) > 1 {
+		commitString, verb = "commits", "are"
+	}
+
+	headerText := fmt.Sprintf(
+		":bell: <@%s> wanted to let you know that your %s in :%s: *<%s|%s>* `%s/%s` :arrow_right: `%s/%s` %s being released",
+		slackUserID,
+		commitString,
+		repo.ProviderType,
+		repo.WebURL,
+		repo.Name,
+		fromRef.Type,
+		fromRef.Name,
+		toRef.Type,
+		toRef.Name,
+		verb,
+	)
+
+	var commitsText string
+	for i, c := range commits {
+		if i >= 15 {
+			commitsText += fmt.Sprintf("> _and %d more_\n", len(commits)-i)
+			break
+		}
+
+		commitsText += fmt.Sprintf("> <%s|%s> | _%s_\n", c.WebURL, c.ShortID, c.ShortMessage())
+	}
+
+	blocks := slack.Blocks{
+		BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", headerText, false, false), nil, nil),
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", commitsText, false, false), nil, nil),
+		},
+	}
+
+	if permalink != "" {
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("<%s|view the comparison>", permalink), false, false)))
+	}
+
+	return blocks
+}
+
+// comparisonBlocks renders the comparison using the configured template, or the
+// default layout if there is none
+func (s Slack) comparisonBlocks(repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, slackUserID string) slack.Blocks {
+	if s.Templates.ComparisonMessage != nil {
+		blocks, err := s.Templates.ComparisonMessage.Render(newTemplateData(repo, fromRef, toRef, cmp, slackUserID))
+		if err == nil {
+			return slack.Blocks{BlockSet: blocks}
+		}
+		log.WithError(err).Warning("falling back onto the default comparison message")
+	}
+
 	headerText := fmt.Sprintf(
 		":%s: *<%s|%s>*\n`%s/%s` :arrow_right: `%s/%s`",
 		repo.ProviderType,
@@ -221,14 +406,162 @@ func GenerateComparisonMessage(repo providers.Repository, fromRef, toRef provide
 	}
 
 	footerText := fmt.Sprintf("diff requested by <@%s> | %s", slackUserID, cmp.AuthorsSlackString())
+	if slackUserID == "" {
+		footerText = fmt.Sprintf("scheduled drift digest | %s", cmp.AuthorsSlackString())
+	}
 	blocks := slack.Blocks{
 		BlockSet: []slack.Block{
 			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", headerText, false, false), nil, slack.NewAccessory(headerButton)),
-			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", commitsText, false, false), nil, nil),
-			slack.NewDividerBlock(),
-			slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", footerText, false, false)),
 		},
 	}
 
+	if text := commitStatusesText(fromRef, toRef, cmp); text != "" {
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", text, false, false)))
+	}
+
+	blocks.BlockSet = append(blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", commitsText, false, false), nil, nil))
+
+	if len(cmp.Issues) > 0 {
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", issuesText(cmp.Issues), false, false), nil, nil))
+	}
+
+	blocks.BlockSet = append(blocks.BlockSet,
+		slack.NewDividerBlock(),
+		slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", footerText, false, false)),
+	)
+
+	return blocks
+}
+
+// GenerateComparisonPreviewMessage renders the comparison along with buttons
+// allowing the requester to post it to the channel or to discard it, the value
+// is passed onto these buttons
+func (s Slack) GenerateComparisonPreviewMessage(repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, slackUserID, value string) slack.Blocks {
+	blocks := s.comparisonBlocks(repo, fromRef, toRef, cmp, slackUserID)
+
+	postButton := slack.NewButtonBlockElement("preview_post", value, slack.NewTextBlockObject(slack.PlainTextType, "Post to channel", false, false))
+	postButton.WithStyle(slack.StylePrimary)
+
+	discardButton := slack.NewButtonBlockElement("preview_discard", value, slack.NewTextBlockObject(slack.PlainTextType, "Discard", false, false))
+
+	blocks.BlockSet = append(blocks.BlockSet, slack.NewActionBlock("preview", postButton, discardButton))
 	return blocks
 }
+
+// staleRepositoriesSourcesBlock warns about the sources whose repositories
+// could not be listed, the selector offering their last known ones
+func staleRepositoriesSourcesBlock(sources []providers.RepositoriesSourceStatus) *slack.ContextBlock {
+	lines := make([]string, len(sources))
+	for i, s := range sources {
+		lastListed := "never listed"
+		if !s.LastUpdate.IsZero() {
+			lastListed = fmt.Sprintf("last listed %s", timeago.English.Format(s.LastUpdate))
+		}
+		lines[i] = fmt.Sprintf(":warning: _could not list the repositories of `%s` (%s), %s_", s.Owner, s.ProviderType.StringPretty(), lastListed)
+	}
+
+	return slack.NewContextBlock("stale_repositories_sources", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(lines, "\n"), false, false))
+}
+
+// NewRefOptionBlockObject returns the option of a ref selector, described by
+// when its head commit was made and by whom when known (eg: updated 3 hours ago by @alice)
+func NewRefOptionBlockObject(value string, ref providers.Ref) *slack.OptionBlockObject {
+	var description *slack.TextBlockObject
+	if d := refDescription(ref); d != "" {
+		description = slack.NewTextBlockObject(slack.PlainTextType, d, false, false)
+	}
+
+	return slack.NewOptionBlockObject(
+		value,
+		slack.NewTextBlockObject(slack.PlainTextType, fmt.Sprintf("%s/%s", ref.Type, ref.Name), true, false),
+		description,
+	)
+}
+
+// refDescription returns when and by whom the head commit of the ref was made
+func refDescription(ref providers.Ref) (description string) {
+	if ref.CommittedAt.IsZero() {
+		return
+	}
+
+	description = fmt.Sprintf("updated %s", timeago.English.Format(ref.CommittedAt))
+	switch {
+	case ref.Author.Login != "":
+		description += fmt.Sprintf(" by @%s", ref.Author.Login)
+	case ref.Author.Name != "":
+		description += fmt.Sprintf(" by %s", ref.Author.Name)
+	}
+
+	// Slack does not accept longer descriptions
+	if runes := []rune(description); len(runes) > optionDescriptionMaxLength {
+		description = string(runes[:optionDescriptionMaxLength-1]) + "…"
+	}
+	return
+}
+
+// issuesText renders the issues as a list of links, the ones which do not fit
+// in a section being counted instead
+func issuesText(issues providers.Issues) string {
+	issueString := "issue"
+	if len(issues) > 1 {
+		issueString += "s"
+	}
+
+	text := fmt.Sprintf(":ticket: *%d linked %s*: ", len(issues), issueString)
+	for i, issue := range issues {
+		link := fmt.Sprintf("<%s|%s>", issue.WebURL, issue.Key)
+		if i > 0 {
+			link = ", " + link
+		}
+
+		// Leave room for the count of the remaining issues
+		more := ""
+		if remaining := len(issues) - i - 1; remaining > 0 {
+			more = fmt.Sprintf(" and %d more", remaining)
+		}
+
+		if len([]rune(text+link+more)) > sectionTextMaxLength {
+			return text + fmt.Sprintf(" and %d more", len(issues)-i)
+		}
+
+		text += link
+	}
+
+	return text
+}
+
+// commitStatusesText renders the CI statuses of the compared refs as badges,
+// it returns an empty string if none of them could be determined
+func commitStatusesText(fromRef, toRef providers.Ref, cmp providers.Comparison) string {
+	if cmp.FromStatus.IsEmpty() && cmp.ToStatus.IsEmpty() {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"`%s/%s` %s | `%s/%s` %s",
+		fromRef.Type,
+		fromRef.Name,
+		commitStatusBadge(cmp.FromStatus),
+		toRef.Type,
+		toRef.Name,
+		commitStatusBadge(cmp.ToStatus),
+	)
+}
+
+// commitStatusBadge renders a CI status with an emoji and a link to its details
+func commitStatusBadge(cs providers.CommitStatus) string {
+	emoji := map[providers.CommitStatusState]string{
+		providers.CommitStatusStateUnknown:  ":grey_question:",
+		providers.CommitStatusStateSuccess:  ":white_check_mark:",
+		providers.CommitStatusStateCanceled: ":no_entry_sign:",
+		providers.CommitStatusStatePending:  ":hourglass_flowing_sand:",
+		providers.CommitStatusStateRunning:  ":arrows_counterclockwise:",
+		providers.CommitStatusStateFailure:  ":x:",
+	}[cs.State]
+
+	if cs.WebURL == "" {
+		return fmt.Sprintf("%s %s", emoji, cs.State)
+	}
+
+	return fmt.Sprintf("%s <%s|%s>", emoji, cs.WebURL, cs.State)
+}
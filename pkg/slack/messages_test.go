@@ -0,0 +1,224 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitStatusesText(t *testing.T) {
+	fromRef := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	toRef := providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag}
+
+	assert.Equal(t, "", commitStatusesText(fromRef, toRef, providers.Comparison{}))
+	assert.Equal(t, "`branch/main` :white_check_mark: <http://foo|success> | `tag/v1.0.0` :grey_question: unknown", commitStatusesText(fromRef, toRef, providers.Comparison{
+		FromStatus: providers.CommitStatus{
+			State:  providers.CommitStatusStateSuccess,
+			WebURL: "http://foo",
+		},
+	}))
+}
+
+func TestIssuesText(t *testing.T) {
+	assert.Equal(t, ":ticket: *1 linked issue*: <http://foo/FOO-1|FOO-1>", issuesText(providers.Issues{
+		{Key: "FOO-1", WebURL: "http://foo/FOO-1"},
+	}))
+
+	// The issues which do not fit in a section get counted
+	var issues providers.Issues
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("FOO-%d", i)
+		issues = append(issues, providers.Issue{Key: key, WebURL: "http://foo/" + key})
+	}
+
+	text := issuesText(issues)
+	assert.LessOrEqual(t, len([]rune(text)), sectionTextMaxLength)
+	assert.True(t, strings.HasPrefix(text, ":ticket: *500 linked issues*: <http://foo/FOO-0|FOO-0>, "))
+	assert.Regexp(t, `\|FOO-\d+> and \d+ more$`, text)
+}
+
+func TestNewRefOptionBlockObject(t *testing.T) {
+	ref := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	o := NewRefOptionBlockObject("x/foo", ref)
+	assert.Equal(t, "x/foo", o.Value)
+	assert.Equal(t, "branch/main", o.Text.Text)
+	assert.Nil(t, o.Description)
+
+	ref.CommittedAt = time.Now().Add(-3 * time.Hour)
+	ref.Author = providers.Author{Name: "Alice"}
+	assert.Equal(t, "updated 3 hours ago by Alice", NewRefOptionBlockObject("x/foo", ref).Description.Text)
+
+	ref.Author.Login = "alice"
+	assert.Equal(t, "updated 3 hours ago by @alice", NewRefOptionBlockObject("x/foo", ref).Description.Text)
+
+	ref.Author.Login = strings.Repeat("a", 100)
+	assert.Len(t, []rune(NewRefOptionBlockObject("x/foo", ref).Description.Text), optionDescriptionMaxLength)
+}
+
+func TestGetModalRequestStaleRepositoriesSources(t *testing.T) {
+	mvr := Slack{}.GetModalRequest(ModalRequestOptions{
+		LastRepositoriesUpdate: time.Now(),
+		StaleRepositoriesSources: []providers.RepositoriesSourceStatus{
+			{
+				RepositoriesSource: providers.RepositoriesSource{ProviderType: providers.ProviderTypeGitLab, Owner: "foo"},
+				LastError:          "boom",
+			},
+		},
+	})
+
+	if assert.Len(t, mvr.Blocks.BlockSet, 3) {
+		context, ok := mvr.Blocks.BlockSet[2].(*slack.ContextBlock)
+		if assert.True(t, ok) {
+			assert.Equal(t, ":warning: _could not list the repositories of `foo` (GitLab), never listed_", context.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+		}
+	}
+
+	assert.Len(t, Slack{}.GetModalRequest(ModalRequestOptions{LastRepositoriesUpdate: time.Now()}).Blocks.BlockSet, 2)
+}
+
+func TestGetModalRequestComparisonStates(t *testing.T) {
+	ref := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	opts := ModalRequestOptions{
+		LastRepositoriesUpdate: time.Now(),
+		Repository: providers.Repository{
+			Name:           "foo/bar",
+			Refs:           providers.Refs{ref.Key(): ref},
+			RefsLastUpdate: time.Now(),
+		},
+		FromRef: ref,
+		ToRef:   ref,
+	}
+
+	lastSectionText := func(mvr slack.ModalViewRequest) string {
+		section, ok := mvr.Blocks.BlockSet[len(mvr.Blocks.BlockSet)-1].(*slack.SectionBlock)
+		if !assert.True(t, ok) {
+			return ""
+		}
+		return section.Text.Text
+	}
+
+	opts.CurrentlyComparing = true
+	assert.Equal(t, ":hourglass_flowing_sand: comparing refs..", lastSectionText(Slack{}.GetModalRequest(opts)))
+
+	opts.CurrentlyComparing = false
+	opts.ComparisonError = "the provider took too long to respond"
+	assert.Equal(t, ":warning: *could not compare the refs*\nthe provider took too long to respond", lastSectionText(Slack{}.GetModalRequest(opts)))
+}
+
+func TestGenerateComparisonPreviewMessage(t *testing.T) {
+	blocks := Slack{}.GenerateComparisonPreviewMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{},
+		"U123",
+		"repo/from/to",
+	)
+
+	actions, ok := blocks.BlockSet[len(blocks.BlockSet)-1].(*slack.ActionBlock)
+	if assert.True(t, ok) {
+		assert.Equal(t, "preview", actions.BlockID)
+		if assert.Len(t, actions.Elements.ElementSet, 2) {
+			assert.Equal(t, "preview_post", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).ActionID)
+			assert.Equal(t, "repo/from/to", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).Value)
+			assert.Equal(t, "preview_discard", actions.Elements.ElementSet[1].(*slack.ButtonBlockElement).ActionID)
+		}
+	}
+}
+
+func TestGenerateComparisonMessage(t *testing.T) {
+	blocks := Slack{}.GenerateComparisonMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{},
+		"U123",
+		"repo/from/to",
+	)
+
+	actions, ok := blocks.BlockSet[len(blocks.BlockSet)-1].(*slack.ActionBlock)
+	if assert.True(t, ok) {
+		if assert.Len(t, actions.Elements.ElementSet, 1) {
+			assert.Equal(t, "refresh", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).ActionID)
+			assert.Equal(t, "repo/from/to", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).Value)
+		}
+	}
+
+	// With authors which can be notified
+	blocks = Slack{}.GenerateComparisonMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{Commits: providers.Commits{{Author: providers.Author{SlackUserID: "U456"}}}},
+		"U123",
+		"repo/from/to",
+	)
+
+	actions, ok = blocks.BlockSet[len(blocks.BlockSet)-1].(*slack.ActionBlock)
+	if assert.True(t, ok) && assert.Len(t, actions.Elements.ElementSet, 2) {
+		assert.Equal(t, "notify_authors", actions.Elements.ElementSet[1].(*slack.ButtonBlockElement).ActionID)
+	}
+}
+
+func TestRemoveNotifyAuthorsButton(t *testing.T) {
+	blocks := RemoveNotifyAuthorsButton(Slack{}.GenerateComparisonMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{Commits: providers.Commits{{Author: providers.Author{SlackUserID: "U456"}}}},
+		"U123",
+		"repo/from/to",
+	))
+
+	actions, ok := blocks.BlockSet[len(blocks.BlockSet)-1].(*slack.ActionBlock)
+	if assert.True(t, ok) && assert.Len(t, actions.Elements.ElementSet, 1) {
+		assert.Equal(t, "refresh", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).ActionID)
+	}
+}
+
+func TestGenerateAuthorNotificationMessage(t *testing.T) {
+	repo := providers.Repository{Name: "foo/bar"}
+	fromRef := providers.Ref{Name: "main", Type: providers.RefTypeBranch}
+	toRef := providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag}
+
+	blocks := GenerateAuthorNotificationMessage(repo, fromRef, toRef, providers.Commits{{ID: "a"}}, "U123", "")
+	assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "your commit in")
+	assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "is being released")
+
+	blocks = GenerateAuthorNotificationMessage(repo, fromRef, toRef, providers.Commits{{ID: "a"}, {ID: "b"}}, "U123", "https://slack.com/archives/C1/p1")
+	assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "your commits in")
+	assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "are being released")
+	assert.Len(t, blocks.BlockSet, 3)
+}
+
+func TestGenerateWatchesDigestMessage(t *testing.T) {
+	blocks := GenerateWatchesDigestMessage([]ModalRequestOptions{
+		{
+			Repository: providers.Repository{Name: "foo/bar"},
+			FromRef:    providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag},
+			ToRef:      providers.Ref{Name: "main", Type: providers.RefTypeBranch},
+			Comparison: &providers.Comparison{Commits: providers.Commits{{CreatedAt: time.Now()}}, WebURL: "http://foo"},
+		},
+		{
+			Repository: providers.Repository{Name: "foo/baz"},
+			FromRef:    providers.Ref{Name: "production", Type: providers.RefTypeBranch},
+			ToRef:      providers.Ref{Name: "main", Type: providers.RefTypeBranch},
+			Comparison: &providers.Comparison{Commits: providers.Commits{{}, {}}},
+		},
+	})
+
+	if assert.Len(t, blocks.BlockSet, 3) {
+		assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "the drift of 2 watches")
+
+		lines := strings.Split(strings.TrimSpace(blocks.BlockSet[1].(*slack.SectionBlock).Text.Text), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[0], "`tag/v1.0.0` :arrow_right: `branch/main` | <http://foo|*1 commit*>")
+			assert.Contains(t, lines[1], "*2 commits*")
+		}
+	}
+}
@@ -16,6 +16,7 @@ type Slack struct {
 	Client        *slack.Client
 	SigningSecret string
 	CustomUsers   config.Users
+	Templates     Templates
 }
 
 // NewOptions holds configuration parameters to create a new and
@@ -25,11 +26,13 @@ type NewOptions struct {
 	Token         string
 }
 
-// New creates and configures a new Slack object
-func New(cfg config.Slack, customUsers config.Users) (s Slack) {
+// New creates and configures a new Slack object, it returns an error if the
+// configured templates cannot be rendered
+func New(cfg config.Slack, customUsers config.Users) (s Slack, err error) {
 	s.Client = slack.New(cfg.Token)
 	s.SigningSecret = cfg.SigningSecret
 	s.CustomUsers = customUsers
+	s.Templates, err = NewTemplates(cfg.Templates)
 
 	return
 }
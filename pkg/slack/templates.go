@@ -0,0 +1,241 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/slack-go/slack"
+)
+
+// Slack rejects the section blocks whose text exceeds sectionTextMaxLength
+// characters, hence splitting the output of the mrkdwn templates into up to
+// templateMaxSections of them, the rest getting truncated
+const (
+	sectionTextMaxLength = 3000
+	templateMaxSections  = 10
+)
+
+// errEmptyTemplateOutput is returned when a template renders nothing, in which
+// case the default rendering is used instead
+var errEmptyTemplateOutput = errors.New("empty output")
+
+// TemplateFormat represents how the output of a Template gets interpreted
+type TemplateFormat uint8
+
+const (
+	// TemplateFormatMarkdown renders the output as the text of section blocks
+	TemplateFormatMarkdown TemplateFormat = iota
+
+	// TemplateFormatBlocks parses the output as a JSON array of Block Kit blocks
+	TemplateFormatBlocks
+)
+
+// TemplateData is the data model the templates are rendered against
+type TemplateData struct {
+	// Repository being compared, eg: {{ .Repository.Name }}, {{ .Repository.WebURL }}
+	Repository providers.Repository
+
+	// FromRef and ToRef being compared, eg: {{ .FromRef.Type }}/{{ .FromRef.Name }}
+	FromRef providers.Ref
+	ToRef   providers.Ref
+
+	// Comparison holds the commits, issues and CI statuses, eg: {{ .Comparison.CommitCount }},
+	// {{ range .Comparison.Commits }}{{ .ShortID }} {{ .ShortMessage }}{{ end }}
+	Comparison providers.Comparison
+
+	// Authors of the commits, the ones resolved to Slack users first
+	Authors providers.Authors
+
+	// Requester is the Slack user ID of the user who requested the comparison, it
+	// is empty for scheduled digests and within the modal
+	Requester string
+}
+
+// Template renders comparisons according to the configuration of the operators
+type Template struct {
+	Format   TemplateFormat
+	template *template.Template
+}
+
+// Templates holds the Templates overriding the default rendering of the comparisons
+type Templates struct {
+	ComparisonMessage *Template
+	ModalSummary      *Template
+}
+
+var templateFuncs = template.FuncMap{
+	// slackUser renders a mention of a Slack user given its ID
+	"slackUser": func(id string) string {
+		return fmt.Sprintf("<@%s>", id)
+	},
+	// json escapes a value to be safely embedded in a Block Kit template
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// NewTemplate parses the configuration of a template and ensures it can be
+// rendered. It returns nil if no template is configured
+func NewTemplate(name string, cfg config.SlackTemplate) (*Template, error) {
+	if cfg.Template == "" {
+		return nil, nil
+	}
+
+	t := &Template{}
+	switch cfg.Format {
+	case "blocks":
+		t.Format = TemplateFormatBlocks
+	case "mrkdwn", "":
+		t.Format = TemplateFormatMarkdown
+	default:
+		return nil, fmt.Errorf("template '%s': invalid format '%s'", name, cfg.Format)
+	}
+
+	var err error
+	if t.template, err = template.New(name).Funcs(templateFuncs).Parse(cfg.Template); err != nil {
+		return nil, fmt.Errorf("parsing template '%s': %v", name, err)
+	}
+
+	// Templates may render nothing on purpose, eg: to only override the rendering of some comparisons
+	if _, err = t.Render(sampleTemplateData()); err != nil && !errors.Is(err, errEmptyTemplateOutput) {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// NewTemplates returns the Templates configured by the operators
+func NewTemplates(cfg config.SlackTemplates) (ts Templates, err error) {
+	if ts.ComparisonMessage, err = NewTemplate("comparison_message", cfg.ComparisonMessage); err != nil {
+		return
+	}
+
+	ts.ModalSummary, err = NewTemplate("modal_summary", cfg.ModalSummary)
+	return
+}
+
+// Render executes the template against the data and returns the resulting blocks
+func (t Template) Render(data TemplateData) ([]slack.Block, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("rendering template '%s': %v", t.template.Name(), err)
+	}
+
+	if strings.TrimSpace(buf.String()) == "" {
+		return nil, fmt.Errorf("rendering template '%s': %w", t.template.Name(), errEmptyTemplateOutput)
+	}
+
+	if t.Format == TemplateFormatMarkdown {
+		var blocks []slack.Block
+		for _, text := range splitText(buf.String(), sectionTextMaxLength, templateMaxSections) {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+		}
+		return blocks, nil
+	}
+
+	var blocks slack.Blocks
+	if err := json.Unmarshal(buf.Bytes(), &blocks); err != nil {
+		return nil, fmt.Errorf("rendering template '%s': invalid blocks: %v", t.template.Name(), err)
+	}
+
+	if len(blocks.BlockSet) == 0 {
+		return nil, fmt.Errorf("rendering template '%s': %w", t.template.Name(), errEmptyTemplateOutput)
+	}
+
+	return blocks.BlockSet, nil
+}
+
+// splitText splits the text into up to maxParts parts of at most maxLength
+// characters, preferably on line breaks. What does not fit gets truncated
+func splitText(text string, maxLength, maxParts int) (parts []string) {
+	const truncated = "\n_truncated_"
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		if len(parts) == maxParts-1 && len(runes) > maxLength {
+			cut := maxLength - len(truncated)
+			if i := lastIndexRune(runes[:cut], '\n'); i > 0 {
+				cut = i
+			}
+			return append(parts, string(runes[:cut])+truncated)
+		}
+
+		cut := len(runes)
+		if cut > maxLength {
+			cut = maxLength
+			if i := lastIndexRune(runes[:cut], '\n'); i > 0 {
+				cut = i + 1
+			}
+		}
+
+		parts = append(parts, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return
+}
+
+// lastIndexRune returns the index of the last occurrence of r in runes, or -1
+func lastIndexRune(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// newTemplateData returns the data model of a comparison
+func newTemplateData(repo providers.Repository, fromRef, toRef providers.Ref, cmp providers.Comparison, slackUserID string) TemplateData {
+	return TemplateData{
+		Repository: repo,
+		FromRef:    fromRef,
+		ToRef:      toRef,
+		Comparison: cmp,
+		Authors:    cmp.GetAuthors(),
+		Requester:  slackUserID,
+	}
+}
+
+// sampleTemplateData is used to ensure the templates can be rendered at startup
+func sampleTemplateData() TemplateData {
+	repo := providers.Repository{
+		ProviderType: providers.ProviderTypeGitHub,
+		Name:         "foo/bar",
+		WebURL:       "https://github.com/foo/bar",
+	}
+
+	cmp := providers.Comparison{
+		Commits: providers.Commits{
+			{
+				ID:        "0123456789abcdef0123456789abcdef01234567",
+				ShortID:   "0123456",
+				Author:    providers.Author{Name: "Alice", Email: "alice@example.com", SlackUserID: "U123456789"},
+				CreatedAt: time.Now(),
+				Message:   "feat: add foo\n\nFixes #1",
+				WebURL:    "https://github.com/foo/bar/commit/0123456789abcdef0123456789abcdef01234567",
+				Issues:    providers.Issues{{Key: "#1", WebURL: "https://github.com/foo/bar/issues/1"}},
+			},
+		},
+		Issues: providers.Issues{{Key: "#1", WebURL: "https://github.com/foo/bar/issues/1"}},
+		WebURL: "https://github.com/foo/bar/compare/v1.0.0...main",
+	}
+
+	return newTemplateData(
+		repo,
+		providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag},
+		providers.Ref{Name: "main", Type: providers.RefTypeBranch},
+		cmp,
+		"U234567891",
+	)
+}
@@ -0,0 +1,135 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/config"
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("foo", config.SlackTemplate{})
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = NewTemplate("foo", config.SlackTemplate{Template: "{{ .Foo }}"})
+	assert.Error(t, err)
+
+	_, err = NewTemplate("foo", config.SlackTemplate{Template: "{{ if }}"})
+	assert.Error(t, err)
+
+	_, err = NewTemplate("foo", config.SlackTemplate{Format: "blocks", Template: "not json"})
+	assert.Error(t, err)
+
+	_, err = NewTemplate("foo", config.SlackTemplate{Format: "foo", Template: "bar"})
+	assert.Error(t, err)
+
+	// Templates rendering nothing are valid, the default rendering gets used instead
+	tmpl, err = NewTemplate("foo", config.SlackTemplate{Template: "{{ if eq .Repository.Name \"foo\" }}bar{{ end }}"})
+	assert.NoError(t, err)
+	_, err = tmpl.Render(sampleTemplateData())
+	assert.ErrorIs(t, err, errEmptyTemplateOutput)
+}
+
+func TestTemplateRender(t *testing.T) {
+	data := newTemplateData(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "v1.0.0", Type: providers.RefTypeTag},
+		providers.Ref{Name: "main", Type: providers.RefTypeBranch},
+		providers.Comparison{Commits: providers.Commits{{ShortID: "abc"}}},
+		"U123",
+	)
+
+	tmpl, err := NewTemplate("mrkdwn", config.SlackTemplate{
+		Format:   "mrkdwn",
+		Template: "{{ .Repository.Name }}: {{ .Comparison.CommitCount }} commit(s) requested by {{ slackUser .Requester }}",
+	})
+	assert.NoError(t, err)
+
+	blocks, err := tmpl.Render(data)
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 1) {
+		assert.Equal(t, "foo/bar: 1 commit(s) requested by <@U123>", blocks[0].(*slack.SectionBlock).Text.Text)
+	}
+
+	tmpl, err = NewTemplate("blocks", config.SlackTemplate{
+		Format:   "blocks",
+		Template: `[{"type": "section", "text": {"type": "mrkdwn", "text": {{ json .ToRef.Name }}}}, {"type": "divider"}]`,
+	})
+	assert.NoError(t, err)
+
+	blocks, err = tmpl.Render(data)
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 2) {
+		assert.Equal(t, "main", blocks[0].(*slack.SectionBlock).Text.Text)
+	}
+}
+
+func TestGenerateComparisonMessageWithTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("comparison_message", config.SlackTemplate{Template: "{{ .Repository.Name }}"})
+	assert.NoError(t, err)
+
+	blocks := Slack{Templates: Templates{ComparisonMessage: tmpl}}.GenerateComparisonMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{},
+		"U123",
+		"repo/from/to",
+	)
+
+	// The template output followed by the buttons
+	if assert.Len(t, blocks.BlockSet, 2) {
+		assert.Equal(t, "foo/bar", blocks.BlockSet[0].(*slack.SectionBlock).Text.Text)
+	}
+
+	// Falling back onto the default layout when the template renders nothing
+	tmpl, err = NewTemplate("comparison_message", config.SlackTemplate{Template: "{{ if .Comparison.Commits }}{{ .Repository.Name }}{{ end }}"})
+	assert.NoError(t, err)
+
+	blocks = Slack{Templates: Templates{ComparisonMessage: tmpl}}.GenerateComparisonMessage(
+		providers.Repository{Name: "foo/bar"},
+		providers.Ref{Name: "main"},
+		providers.Ref{Name: "v1.0.0"},
+		providers.Comparison{},
+		"U123",
+		"repo/from/to",
+	)
+	assert.Contains(t, blocks.BlockSet[0].(*slack.SectionBlock).Text.Text, "*<|foo/bar>*")
+}
+
+func TestTemplateRenderLongMarkdown(t *testing.T) {
+	tmpl, err := NewTemplate("mrkdwn", config.SlackTemplate{Template: `{{ range .Comparison.Commits }}{{ .Message }}{{ "\n" }}{{ end }}`})
+	assert.NoError(t, err)
+
+	var commits providers.Commits
+	for i := 0; i < 100; i++ {
+		commits = append(commits, providers.Commit{Message: strings.Repeat("é", 99)})
+	}
+
+	blocks, err := tmpl.Render(newTemplateData(providers.Repository{}, providers.Ref{}, providers.Ref{}, providers.Comparison{Commits: commits}, ""))
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 4) {
+		for _, b := range blocks {
+			text := b.(*slack.SectionBlock).Text.Text
+			assert.LessOrEqual(t, len([]rune(text)), sectionTextMaxLength)
+			assert.True(t, strings.HasSuffix(text, "\n"))
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	assert.Equal(t, []string{"foo"}, splitText("foo", 10, 2))
+	assert.Equal(t, []string{"foo\nbar\n", "baz"}, splitText("foo\nbar\nbaz", 8, 2))
+	assert.Equal(t, []string{"foobarbaz", "qux"}, splitText("foobarbazqux", 9, 2))
+
+	// What does not fit gets truncated
+	parts := splitText(strings.Repeat("foo\n", 30), 20, 2)
+	if assert.Len(t, parts, 2) {
+		assert.Equal(t, strings.Repeat("foo\n", 5), parts[0])
+		assert.Equal(t, "foo\nfoo\n_truncated_", parts[1])
+	}
+}
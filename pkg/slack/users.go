@@ -5,6 +5,20 @@ import (
 	"github.com/slack-go/slack"
 )
 
+// LookupUserIDByEmail returns the ID of the Slack user owning the email address,
+// or an empty string if there is none
+func (s *Slack) LookupUserIDByEmail(email string) (string, error) {
+	u, err := s.Client.GetUserByEmail(email)
+	if err != nil {
+		if err.Error() == "users_not_found" {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
 // ListSlackUserEmailMappings returns a mapping between email addresses and slack user IDs
 func (s *Slack) ListSlackUserEmailMappings() (mapping map[string]string, err error) {
 	mapping = make(map[string]string)
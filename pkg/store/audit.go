@@ -0,0 +1,42 @@
+package store
+
+import "github.com/mvisonneau/slack-git-compare/pkg/audit"
+
+// AddAuditRecord appends a record to the audit log, overwriting the oldest one
+// beyond the limit: the records are kept in a ring buffer
+func (s *Store) AddAuditRecord(r audit.Record, limit int) {
+	s.auditRecordsMutex.Lock()
+	defer s.auditRecordsMutex.Unlock()
+
+	// The limit changed since the previous records got added
+	if limit <= 0 || len(s.auditRecords) > limit || (len(s.auditRecords) < limit && s.auditRecordsOldest > 0) {
+		s.auditRecords = s.orderedAuditRecords()
+		if limit > 0 && len(s.auditRecords) > limit {
+			s.auditRecords = s.auditRecords[len(s.auditRecords)-limit:]
+		}
+		s.auditRecordsOldest = 0
+	}
+
+	if limit <= 0 || len(s.auditRecords) < limit {
+		s.auditRecords = append(s.auditRecords, r)
+		return
+	}
+
+	s.auditRecords[s.auditRecordsOldest] = r
+	s.auditRecordsOldest = (s.auditRecordsOldest + 1) % limit
+}
+
+// GetAuditRecords returns the records of the audit log, oldest first
+func (s *Store) GetAuditRecords() audit.Records {
+	s.auditRecordsMutex.RLock()
+	defer s.auditRecordsMutex.RUnlock()
+
+	return s.orderedAuditRecords()
+}
+
+// orderedAuditRecords returns a copy of the ring buffer, oldest first
+func (s *Store) orderedAuditRecords() audit.Records {
+	rs := make(audit.Records, 0, len(s.auditRecords))
+	rs = append(rs, s.auditRecords[s.auditRecordsOldest:]...)
+	return append(rs, s.auditRecords[:s.auditRecordsOldest]...)
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRecords(t *testing.T) {
+	s := &Store{}
+	assert.Empty(t, s.GetAuditRecords())
+
+	for _, repo := range []string{"foo/a", "foo/b", "foo/c"} {
+		s.AddAuditRecord(audit.Record{Repository: repo}, 2)
+	}
+
+	assert.Equal(t, audit.Records{
+		{Repository: "foo/b"},
+		{Repository: "foo/c"},
+	}, s.GetAuditRecords())
+
+	s.AddAuditRecord(audit.Record{Repository: "foo/d"}, 2)
+	s.AddAuditRecord(audit.Record{Repository: "foo/e"}, 2)
+	assert.Equal(t, audit.Records{
+		{Repository: "foo/d"},
+		{Repository: "foo/e"},
+	}, s.GetAuditRecords())
+
+	// Growing the limit
+	s.AddAuditRecord(audit.Record{Repository: "foo/f"}, 3)
+	assert.Equal(t, audit.Records{
+		{Repository: "foo/d"},
+		{Repository: "foo/e"},
+		{Repository: "foo/f"},
+	}, s.GetAuditRecords())
+
+	// Lowering it
+	s.AddAuditRecord(audit.Record{Repository: "foo/g"}, 3)
+	s.AddAuditRecord(audit.Record{Repository: "foo/h"}, 1)
+	assert.Equal(t, audit.Records{{Repository: "foo/h"}}, s.GetAuditRecords())
+
+	// Removing it
+	s.AddAuditRecord(audit.Record{Repository: "foo/i"}, 0)
+	assert.Len(t, s.GetAuditRecords(), 2)
+}
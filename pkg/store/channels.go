@@ -0,0 +1,81 @@
+package store
+
+import (
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// BindChannelRepository binds a repository to a Slack channel
+func (s *Store) BindChannelRepository(channelID string, rk providers.RepositoryKey) {
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	if s.channelsRepositories == nil {
+		s.channelsRepositories = make(map[string][]providers.RepositoryKey)
+	}
+
+	for _, k := range s.channelsRepositories[channelID] {
+		if k == rk {
+			return
+		}
+	}
+
+	s.channelsRepositories[channelID] = append(s.channelsRepositories[channelID], rk)
+}
+
+// UnbindChannelRepository removes the binding of a repository to a Slack channel
+func (s *Store) UnbindChannelRepository(channelID string, rk providers.RepositoryKey) {
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	if _, found := s.channelsRepositories[channelID]; !found {
+		return
+	}
+
+	var keys []providers.RepositoryKey
+	for _, k := range s.channelsRepositories[channelID] {
+		if k != rk {
+			keys = append(keys, k)
+		}
+	}
+
+	s.channelsRepositories[channelID] = keys
+}
+
+// GetChannelRepositories ..
+func (s *Store) GetChannelRepositories(channelID string) []providers.RepositoryKey {
+	s.channelsMutex.RLock()
+	defer s.channelsMutex.RUnlock()
+	return s.channelsRepositories[channelID]
+}
+
+// PinChannelFavorite pins a comparison for all the members of a Slack channel
+func (s *Store) PinChannelFavorite(channelID string, uc UserComparison) {
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	if s.channelsFavorites == nil {
+		s.channelsFavorites = make(map[string]UserComparisons)
+	}
+
+	uc.ChannelID = channelID
+	s.channelsFavorites[channelID] = append(s.channelsFavorites[channelID].remove(uc.Key()), uc)
+}
+
+// UnpinChannelFavorite ..
+func (s *Store) UnpinChannelFavorite(channelID string, uc UserComparison) {
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	if _, found := s.channelsFavorites[channelID]; !found {
+		return
+	}
+
+	s.channelsFavorites[channelID] = s.channelsFavorites[channelID].remove(uc.Key())
+}
+
+// GetChannelFavorites ..
+func (s *Store) GetChannelFavorites(channelID string) UserComparisons {
+	s.channelsMutex.RLock()
+	defer s.channelsMutex.RUnlock()
+	return s.channelsFavorites[channelID]
+}
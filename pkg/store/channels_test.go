@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelRepositories(t *testing.T) {
+	s := &Store{}
+	assert.Empty(t, s.GetChannelRepositories("C1"))
+
+	// Unbinding before anything got bound
+	s.UnbindChannelRepository("C1", "foo")
+	assert.Empty(t, s.GetChannelRepositories("C1"))
+
+	s.BindChannelRepository("C1", "foo")
+	s.BindChannelRepository("C1", "bar")
+	s.BindChannelRepository("C1", "foo")
+	assert.Equal(t, []providers.RepositoryKey{"foo", "bar"}, s.GetChannelRepositories("C1"))
+	assert.Empty(t, s.GetChannelRepositories("C2"))
+
+	s.UnbindChannelRepository("C1", "foo")
+	assert.Equal(t, []providers.RepositoryKey{"bar"}, s.GetChannelRepositories("C1"))
+}
+
+func TestChannelFavorites(t *testing.T) {
+	s := &Store{}
+	uc := UserComparison{RepositoryKey: "repo", FromRefKey: "from", ToRefKey: "to"}
+
+	// Unpinning before anything got pinned
+	s.UnpinChannelFavorite("C1", uc)
+	assert.Empty(t, s.GetChannelFavorites("C1"))
+
+	s.PinChannelFavorite("C1", uc)
+	s.PinChannelFavorite("C1", uc)
+	assert.Len(t, s.GetChannelFavorites("C1"), 1)
+	assert.Equal(t, "C1", s.GetChannelFavorites("C1")[0].ChannelID)
+	assert.Empty(t, s.GetChannelFavorites("C2"))
+
+	s.UnpinChannelFavorite("C1", uc)
+	assert.Empty(t, s.GetChannelFavorites("C1"))
+}
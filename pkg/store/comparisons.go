@@ -0,0 +1,142 @@
+package store
+
+import (
+	"container/list"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// commitSizeOverhead is a rough estimate of the memory used by a Commit on top
+// of the contents of its strings
+const commitSizeOverhead = 256
+
+// ComparisonKey identifies the comparison of two commits of a repository, as
+// commits are immutable the comparison never changes
+type ComparisonKey struct {
+	ProviderType providers.ProviderType
+	Repository   string
+	FromSHA      string
+	ToSHA        string
+}
+
+// cachedComparison is an entry of the comparisons cache
+type cachedComparison struct {
+	key     ComparisonKey
+	commits providers.Commits
+	size    int
+}
+
+// comparisonsCache is a LRU cache of the commits of the comparisons, bounded by
+// an amount of entries and an estimation of their size in memory
+type comparisonsCache struct {
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	entries    map[ComparisonKey]*list.Element
+	lru        *list.List
+}
+
+// SetComparisonsCacheLimits configures the maximum amount of comparisons kept
+// in the cache and their maximum estimated size in bytes, the cache is
+// disabled if any of them is not positive
+func (s *Store) SetComparisonsCacheLimits(maxEntries, maxBytes int) {
+	s.comparisonsMutex.Lock()
+	defer s.comparisonsMutex.Unlock()
+
+	s.comparisons.maxEntries = maxEntries
+	s.comparisons.maxBytes = maxBytes
+	s.comparisons.evict()
+}
+
+// SetComparison caches the commits of a comparison
+func (s *Store) SetComparison(key ComparisonKey, commits providers.Commits) {
+	s.comparisonsMutex.Lock()
+	defer s.comparisonsMutex.Unlock()
+
+	c := &s.comparisons
+	if c.maxEntries <= 0 || c.maxBytes <= 0 {
+		return
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[ComparisonKey]*list.Element)
+		c.lru = list.New()
+	}
+
+	if e, found := c.entries[key]; found {
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	entry := &cachedComparison{
+		key:     key,
+		commits: copyCommits(commits),
+		size:    commitsSize(key, commits),
+	}
+
+	// Comparisons which would not fit on their own are not worth evicting all the others
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	c.evict()
+}
+
+// GetComparison returns a copy of the cached commits of a comparison
+func (s *Store) GetComparison(key ComparisonKey) (commits providers.Commits, found bool) {
+	s.comparisonsMutex.Lock()
+	defer s.comparisonsMutex.Unlock()
+
+	e, found := s.comparisons.entries[key]
+	if !found {
+		return
+	}
+
+	s.comparisons.lru.MoveToFront(e)
+	return copyCommits(e.Value.(*cachedComparison).commits), true
+}
+
+// GetComparisonsCacheUsage returns the amount of cached comparisons and their
+// estimated size in bytes
+func (s *Store) GetComparisonsCacheUsage() (entries, bytes int) {
+	s.comparisonsMutex.RLock()
+	defer s.comparisonsMutex.RUnlock()
+	return len(s.comparisons.entries), s.comparisons.bytes
+}
+
+// evict removes the least recently used comparisons until the limits are met
+func (c *comparisonsCache) evict() {
+	for c.lru != nil && c.lru.Len() > 0 &&
+		(len(c.entries) > c.maxEntries || c.bytes > c.maxBytes) {
+		e := c.lru.Back()
+		entry := e.Value.(*cachedComparison)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.bytes -= entry.size
+	}
+}
+
+// copyCommits returns a copy of the commits, so that hydrating them does not
+// alter the cached ones
+func copyCommits(commits providers.Commits) providers.Commits {
+	if commits == nil {
+		return nil
+	}
+
+	copied := make(providers.Commits, len(commits))
+	copy(copied, commits)
+	return copied
+}
+
+// commitsSize returns an estimation of the memory used by a cached comparison
+func commitsSize(key ComparisonKey, commits providers.Commits) (size int) {
+	size = len(key.Repository) + len(key.FromSHA) + len(key.ToSHA)
+	for _, c := range commits {
+		size += commitSizeOverhead +
+			len(c.ID) + len(c.ShortID) + len(c.Message) + len(c.WebURL) +
+			len(c.Author.Name) + len(c.Author.Email) + len(c.Author.Login)
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func testComparisonKey(toSHA string) ComparisonKey {
+	return ComparisonKey{
+		ProviderType: providers.ProviderTypeGitHub,
+		Repository:   "foo/bar",
+		FromSHA:      "aaa",
+		ToSHA:        toSHA,
+	}
+}
+
+func TestComparisonsCacheDisabled(t *testing.T) {
+	s := Store{}
+	s.SetComparison(testComparisonKey("bbb"), providers.Commits{{ID: "bbb"}})
+
+	_, found := s.GetComparison(testComparisonKey("bbb"))
+	assert.False(t, found)
+}
+
+func TestComparisonsCacheMaxEntries(t *testing.T) {
+	s := Store{}
+	s.SetComparisonsCacheLimits(2, 1<<20)
+
+	s.SetComparison(testComparisonKey("bbb"), providers.Commits{{ID: "bbb"}})
+	s.SetComparison(testComparisonKey("ccc"), providers.Commits{{ID: "ccc"}})
+
+	// Using it makes it the most recently used one
+	_, found := s.GetComparison(testComparisonKey("bbb"))
+	assert.True(t, found)
+
+	s.SetComparison(testComparisonKey("ddd"), providers.Commits{{ID: "ddd"}})
+
+	_, found = s.GetComparison(testComparisonKey("ccc"))
+	assert.False(t, found)
+
+	commits, found := s.GetComparison(testComparisonKey("bbb"))
+	assert.True(t, found)
+	assert.Equal(t, providers.Commits{{ID: "bbb"}}, commits)
+
+	entries, _ := s.GetComparisonsCacheUsage()
+	assert.Equal(t, 2, entries)
+}
+
+func TestComparisonsCacheMaxBytes(t *testing.T) {
+	s := Store{}
+	s.SetComparisonsCacheLimits(100, 2000)
+
+	large := providers.Commits{{ID: "bbb", Message: strings.Repeat("x", 1500)}}
+	s.SetComparison(testComparisonKey("bbb"), large)
+	s.SetComparison(testComparisonKey("ccc"), large)
+
+	_, found := s.GetComparison(testComparisonKey("bbb"))
+	assert.False(t, found)
+	_, found = s.GetComparison(testComparisonKey("ccc"))
+	assert.True(t, found)
+
+	// Too large to fit on its own
+	s.SetComparison(testComparisonKey("ddd"), providers.Commits{{ID: "ddd", Message: strings.Repeat("x", 3000)}})
+	_, found = s.GetComparison(testComparisonKey("ddd"))
+	assert.False(t, found)
+	_, found = s.GetComparison(testComparisonKey("ccc"))
+	assert.True(t, found)
+
+	// Lowering the limits evicts the entries
+	s.SetComparisonsCacheLimits(100, 100)
+	entries, bytes := s.GetComparisonsCacheUsage()
+	assert.Zero(t, entries)
+	assert.Zero(t, bytes)
+}
+
+func TestComparisonsCacheCopies(t *testing.T) {
+	s := Store{}
+	s.SetComparisonsCacheLimits(10, 1<<20)
+
+	commits := providers.Commits{{ID: "bbb"}}
+	s.SetComparison(testComparisonKey("bbb"), commits)
+	commits[0].Author.SlackUserID = "U123"
+
+	cached, _ := s.GetComparison(testComparisonKey("bbb"))
+	assert.Empty(t, cached[0].Author.SlackUserID)
+
+	cached[0].Author.SlackUserID = "U123"
+	cached, _ = s.GetComparison(testComparisonKey("bbb"))
+	assert.Empty(t, cached[0].Author.SlackUserID)
+}
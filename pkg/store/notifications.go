@@ -0,0 +1,52 @@
+package store
+
+// messageKey identifies a message posted in a channel
+type messageKey struct {
+	ChannelID string
+	MessageTS string
+}
+
+// MarkAuthorNotified records that the author of some commits of the comparison
+// posted in a message got notified about it, returning false if it already was
+func (s *Store) MarkAuthorNotified(channelID, messageTS, slackUserID string) bool {
+	s.authorsNotificationsMutex.Lock()
+	defer s.authorsNotificationsMutex.Unlock()
+
+	if s.authorsNotifications == nil {
+		s.authorsNotifications = make(map[messageKey]map[string]struct{})
+	}
+
+	mk := messageKey{ChannelID: channelID, MessageTS: messageTS}
+	if s.authorsNotifications[mk] == nil {
+		s.authorsNotifications[mk] = make(map[string]struct{})
+	}
+
+	if _, found := s.authorsNotifications[mk][slackUserID]; found {
+		return false
+	}
+
+	s.authorsNotifications[mk][slackUserID] = struct{}{}
+	return true
+}
+
+// UnmarkAuthorNotified reverts MarkAuthorNotified, when the author could not be
+// notified after all
+func (s *Store) UnmarkAuthorNotified(channelID, messageTS, slackUserID string) {
+	s.authorsNotificationsMutex.Lock()
+	defer s.authorsNotificationsMutex.Unlock()
+
+	mk := messageKey{ChannelID: channelID, MessageTS: messageTS}
+	delete(s.authorsNotifications[mk], slackUserID)
+	if len(s.authorsNotifications[mk]) == 0 {
+		delete(s.authorsNotifications, mk)
+	}
+}
+
+// AuthorsNotified returns whether the authors of the comparison posted in a
+// message got notified about it
+func (s *Store) AuthorsNotified(channelID, messageTS string) bool {
+	s.authorsNotificationsMutex.RLock()
+	defer s.authorsNotificationsMutex.RUnlock()
+
+	return len(s.authorsNotifications[messageKey{ChannelID: channelID, MessageTS: messageTS}]) > 0
+}
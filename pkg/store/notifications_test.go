@@ -0,0 +1,27 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkAuthorNotified(t *testing.T) {
+	s := &Store{}
+	assert.False(t, s.AuthorsNotified("C1", "1.0"))
+
+	assert.True(t, s.MarkAuthorNotified("C1", "1.0", "U1"))
+	assert.True(t, s.MarkAuthorNotified("C1", "1.0", "U2"))
+	assert.False(t, s.MarkAuthorNotified("C1", "1.0", "U1"))
+	assert.True(t, s.AuthorsNotified("C1", "1.0"))
+
+	// Notifications are tracked per message
+	assert.True(t, s.MarkAuthorNotified("C1", "2.0", "U1"))
+	assert.False(t, s.AuthorsNotified("C2", "1.0"))
+
+	// Authors who could not be notified can be notified again
+	s.UnmarkAuthorNotified("C1", "2.0", "U1")
+	assert.False(t, s.AuthorsNotified("C1", "2.0"))
+	assert.True(t, s.MarkAuthorNotified("C1", "2.0", "U1"))
+	s.UnmarkAuthorNotified("C2", "1.0", "U1")
+}
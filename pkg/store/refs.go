@@ -0,0 +1,129 @@
+package store
+
+import (
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// RefsUpdateRun holds the progress of an update of the refs of all the
+// repositories, which can be resumed if it got interrupted
+type RefsUpdateRun struct {
+	StartedAt time.Time                 `json:"started_at"`
+	Pending   []providers.RepositoryKey `json:"pending"`
+	Updated   int                       `json:"updated"`
+	Failed    int                       `json:"failed"`
+	Running   bool                      `json:"-"`
+}
+
+// RefsFailure holds why the refs of a repository could not be updated
+type RefsFailure struct {
+	LastError string `json:"last_error"`
+	Failures  int    `json:"failures"`
+}
+
+// RefsUpdateState is the state of the updates of the refs which outlives the
+// process: the progress of the current run and the failures of the repositories
+type RefsUpdateState struct {
+	Run      RefsUpdateRun                           `json:"run"`
+	Failures map[providers.RepositoryKey]RefsFailure `json:"failures,omitempty"`
+}
+
+// StartRefsUpdateRun starts a new run for the given repositories, or resumes the
+// one which got interrupted. It returns false if a run is already in progress
+func (s *Store) StartRefsUpdateRun(keys []providers.RepositoryKey) (run RefsUpdateRun, started bool) {
+	s.refsUpdateRunMutex.Lock()
+	defer s.refsUpdateRunMutex.Unlock()
+
+	if s.refsUpdateRun.Running {
+		return s.refsUpdateRun, false
+	}
+
+	if len(s.refsUpdateRun.Pending) == 0 {
+		s.refsUpdateRun = RefsUpdateRun{
+			StartedAt: time.Now(),
+			Pending:   keys,
+		}
+	}
+
+	s.refsUpdateRun.Running = true
+	return s.refsUpdateRun, true
+}
+
+// CompleteRefsUpdateRunItem removes the repository from the pending ones of the
+// run, it is a no-op if it is not part of it
+func (s *Store) CompleteRefsUpdateRunItem(rk providers.RepositoryKey, failed bool) {
+	s.refsUpdateRunMutex.Lock()
+	defer s.refsUpdateRunMutex.Unlock()
+
+	for i, k := range s.refsUpdateRun.Pending {
+		if k != rk {
+			continue
+		}
+
+		s.refsUpdateRun.Pending = append(s.refsUpdateRun.Pending[:i:i], s.refsUpdateRun.Pending[i+1:]...)
+		if failed {
+			s.refsUpdateRun.Failed++
+		} else {
+			s.refsUpdateRun.Updated++
+		}
+		return
+	}
+}
+
+// StopRefsUpdateRun marks the run as stopped, it gets resumed by the next call
+// to StartRefsUpdateRun if some repositories are still pending
+func (s *Store) StopRefsUpdateRun() RefsUpdateRun {
+	s.refsUpdateRunMutex.Lock()
+	defer s.refsUpdateRunMutex.Unlock()
+
+	s.refsUpdateRun.Running = false
+	return s.refsUpdateRun
+}
+
+// GetRefsUpdateRun ..
+func (s *Store) GetRefsUpdateRun() RefsUpdateRun {
+	s.refsUpdateRunMutex.RLock()
+	defer s.refsUpdateRunMutex.RUnlock()
+	return s.refsUpdateRun
+}
+
+// GetRefsUpdateState returns the progress of the current run and the failures
+// of the repositories, including the restored ones which have not been listed yet
+func (s *Store) GetRefsUpdateState() (state RefsUpdateState) {
+	state.Run = s.GetRefsUpdateRun()
+	state.Run.Pending = append([]providers.RepositoryKey(nil), state.Run.Pending...)
+
+	s.repositoriesMutex.RLock()
+	defer s.repositoriesMutex.RUnlock()
+
+	state.Failures = make(map[providers.RepositoryKey]RefsFailure)
+	for k, f := range s.restoredRefsFailures {
+		state.Failures[k] = f
+	}
+
+	for k, r := range s.repositories {
+		if r.RefsFailures > 0 {
+			state.Failures[k] = RefsFailure{LastError: r.RefsLastError, Failures: r.RefsFailures}
+		}
+	}
+	return
+}
+
+// RestoreRefsUpdateState restores the state of a previous process: its run gets
+// resumed by the next call to StartRefsUpdateRun, and the failures get applied
+// onto the repositories once they get listed
+func (s *Store) RestoreRefsUpdateState(state RefsUpdateState) {
+	s.refsUpdateRunMutex.Lock()
+	state.Run.Running = false
+	s.refsUpdateRun = state.Run
+	s.refsUpdateRunMutex.Unlock()
+
+	s.repositoriesMutex.Lock()
+	defer s.repositoriesMutex.Unlock()
+	s.restoredRefsFailures = make(map[providers.RepositoryKey]RefsFailure, len(state.Failures))
+	for k, f := range state.Failures {
+		s.restoredRefsFailures[k] = f
+	}
+	s.applyRestoredRefsFailures(s.repositories)
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefsUpdateRun(t *testing.T) {
+	s := &Store{}
+
+	run, started := s.StartRefsUpdateRun([]providers.RepositoryKey{"a", "b", "c"})
+	assert.True(t, started)
+	assert.True(t, run.Running)
+	assert.Equal(t, []providers.RepositoryKey{"a", "b", "c"}, run.Pending)
+
+	// Already running
+	_, started = s.StartRefsUpdateRun([]providers.RepositoryKey{"d"})
+	assert.False(t, started)
+
+	s.CompleteRefsUpdateRunItem("b", false)
+	s.CompleteRefsUpdateRunItem("a", true)
+	s.CompleteRefsUpdateRunItem("d", false)
+
+	run = s.StopRefsUpdateRun()
+	assert.False(t, run.Running)
+	assert.Equal(t, []providers.RepositoryKey{"c"}, run.Pending)
+	assert.Equal(t, 1, run.Updated)
+	assert.Equal(t, 1, run.Failed)
+
+	// Interrupted runs get resumed
+	run, started = s.StartRefsUpdateRun([]providers.RepositoryKey{"c", "d"})
+	assert.True(t, started)
+	assert.Equal(t, []providers.RepositoryKey{"c"}, run.Pending)
+	assert.Equal(t, 1, run.Updated)
+	assert.Equal(t, 1, run.Failed)
+	assert.Equal(t, s.GetRefsUpdateRun(), run)
+
+	// Completed ones do not
+	s.CompleteRefsUpdateRunItem("c", false)
+	s.StopRefsUpdateRun()
+	run, started = s.StartRefsUpdateRun([]providers.RepositoryKey{"c", "d"})
+	assert.True(t, started)
+	assert.Equal(t, []providers.RepositoryKey{"c", "d"}, run.Pending)
+	assert.Zero(t, run.Updated)
+	assert.Zero(t, run.Failed)
+}
+
+func TestRefsUpdateState(t *testing.T) {
+	s := &Store{}
+	s.UpdateRepositories(providers.Repositories{
+		"a": {Name: "a"},
+		"b": {Name: "b", RefsLastError: "boom", RefsFailures: 2},
+	})
+	s.StartRefsUpdateRun([]providers.RepositoryKey{"a", "b", "c"})
+	s.CompleteRefsUpdateRunItem("a", false)
+
+	state := s.GetRefsUpdateState()
+	assert.Equal(t, []providers.RepositoryKey{"b", "c"}, state.Run.Pending)
+	assert.Equal(t, map[providers.RepositoryKey]RefsFailure{
+		"b": {LastError: "boom", Failures: 2},
+	}, state.Failures)
+
+	// Restored by a new process, before the repositories get listed
+	restored := &Store{}
+	restored.RestoreRefsUpdateState(state)
+	assert.False(t, restored.GetRefsUpdateRun().Running)
+	state.Run.Running = false
+	assert.Equal(t, state, restored.GetRefsUpdateState())
+
+	restored.UpdateRepositories(providers.Repositories{
+		"a": {Name: "a"},
+		"b": {Name: "b"},
+	})
+	r, _ := restored.GetRepository("b")
+	assert.Equal(t, "boom", r.RefsLastError)
+	assert.Equal(t, 2, r.RefsFailures)
+	assert.Equal(t, state.Failures, restored.GetRefsUpdateState().Failures)
+
+	run, started := restored.StartRefsUpdateRun([]providers.RepositoryKey{"a", "b"})
+	assert.True(t, started)
+	assert.Equal(t, []providers.RepositoryKey{"b", "c"}, run.Pending)
+	assert.Equal(t, 1, run.Updated)
+}
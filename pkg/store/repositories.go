@@ -0,0 +1,65 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// UpdateRepositoriesFromListing updates the repositories with the ones of the
+// listing, keeping the last known repositories of the sources which failed
+// to be listed. It also records the outcome of the listing of each source
+func (s *Store) UpdateRepositoriesFromListing(l providers.RepositoriesListing) {
+	failed := l.FailedSources()
+	repos := make(providers.Repositories, len(l.Repositories))
+	for k, r := range l.Repositories {
+		repos[k] = r
+	}
+
+	s.repositoriesMutex.Lock()
+	defer s.repositoriesMutex.Unlock()
+
+	for k, r := range s.repositories {
+		if _, found := repos[k]; !found && failed.Contains(r) {
+			repos[k] = r
+		}
+	}
+
+	if s.repositoriesSources == nil {
+		s.repositoriesSources = make(map[providers.RepositoriesSource]providers.RepositoriesSourceStatus)
+	}
+
+	now := time.Now()
+	for source, err := range l.Sources {
+		status := s.repositoriesSources[source]
+		status.RepositoriesSource = source
+		if err != nil {
+			status.LastError = err.Error()
+		} else {
+			status.LastUpdate = now
+			status.LastError = ""
+		}
+		s.repositoriesSources[source] = status
+	}
+
+	s.updateRepositories(repos)
+}
+
+// GetStaleRepositoriesSources returns the status of the sources whose
+// repositories could not be listed the last time we tried, sorted
+func (s *Store) GetStaleRepositoriesSources() (sources []providers.RepositoriesSourceStatus) {
+	s.repositoriesMutex.RLock()
+	defer s.repositoriesMutex.RUnlock()
+
+	for _, status := range s.repositoriesSources {
+		if status.IsStale() {
+			sources = append(sources, status)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].String() < sources[j].String()
+	})
+	return
+}
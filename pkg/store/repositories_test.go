@@ -0,0 +1,53 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRepositoriesFromListing(t *testing.T) {
+	s := Store{}
+
+	github := providers.RepositoriesSource{ProviderType: providers.ProviderTypeGitHub, Owner: "foo"}
+	gitlab := providers.RepositoriesSource{ProviderType: providers.ProviderTypeGitLab, Owner: "bar"}
+	githubRepo := providers.Repository{ProviderType: providers.ProviderTypeGitHub, Name: "foo/foo"}
+	gitlabRepo := providers.Repository{ProviderType: providers.ProviderTypeGitLab, Name: "bar/bar"}
+
+	l := providers.NewRepositoriesListing()
+	l.Repositories[githubRepo.Key()] = githubRepo
+	l.Repositories[gitlabRepo.Key()] = gitlabRepo
+	l.Sources[github] = nil
+	l.Sources[gitlab] = nil
+	s.UpdateRepositoriesFromListing(l)
+	assert.Len(t, s.GetRepositories(), 2)
+	assert.Empty(t, s.GetStaleRepositoriesSources())
+
+	// GitLab being down, its repositories are kept
+	l = providers.NewRepositoriesListing()
+	l.Sources[github] = nil
+	l.Sources[gitlab] = errors.New("boom")
+	s.UpdateRepositoriesFromListing(l)
+
+	repos := s.GetRepositories()
+	assert.Len(t, repos, 1)
+	_, found := repos[gitlabRepo.Key()]
+	assert.True(t, found)
+
+	stale := s.GetStaleRepositoriesSources()
+	if assert.Len(t, stale, 1) {
+		assert.Equal(t, gitlab, stale[0].RepositoriesSource)
+		assert.Equal(t, "boom", stale[0].LastError)
+		assert.False(t, stale[0].LastUpdate.IsZero())
+	}
+
+	// Back to normal
+	l = providers.NewRepositoriesListing()
+	l.Sources[github] = nil
+	l.Sources[gitlab] = nil
+	s.UpdateRepositoriesFromListing(l)
+	assert.Empty(t, s.GetRepositories())
+	assert.Empty(t, s.GetStaleRepositoriesSources())
+}
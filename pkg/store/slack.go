@@ -0,0 +1,117 @@
+package store
+
+import "time"
+
+// SlackUserLookup holds the result of the lookup of a Slack user, an empty
+// SlackUserID meaning that no user could be found
+type SlackUserLookup struct {
+	SlackUserID string
+	LookedUpAt  time.Time
+}
+
+// SetSlackUserLookupsLimit configures the maximum amount of lookups kept in the
+// store, the oldest ones getting evicted first. They are not bounded if it is
+// not positive
+func (s *Store) SetSlackUserLookupsLimit(maxEntries int) {
+	s.slackUsersEmailsMutex.Lock()
+	defer s.slackUsersEmailsMutex.Unlock()
+
+	s.slackUsersLookupsMaxEntries = maxEntries
+	for maxEntries > 0 && len(s.slackUsersLookups) > maxEntries {
+		s.evictOldestSlackUserLookup()
+	}
+}
+
+// SetSlackUserLookup stores the result of the lookup of a Slack user, given the
+// key identifying the commit author (eg: its email address)
+func (s *Store) SetSlackUserLookup(key, slackUserID string) {
+	s.slackUsersEmailsMutex.Lock()
+	defer s.slackUsersEmailsMutex.Unlock()
+
+	if s.slackUsersLookups == nil {
+		s.slackUsersLookups = make(map[string]SlackUserLookup)
+	}
+
+	if _, found := s.slackUsersLookups[key]; !found && s.slackUsersLookupsMaxEntries > 0 {
+		for len(s.slackUsersLookups) >= s.slackUsersLookupsMaxEntries {
+			s.evictOldestSlackUserLookup()
+		}
+	}
+
+	s.slackUsersLookups[key] = SlackUserLookup{
+		SlackUserID: slackUserID,
+		LookedUpAt:  time.Now(),
+	}
+}
+
+// evictOldestSlackUserLookup removes the lookup which got made the longest time
+// ago. It is a linear scan, which is fine as lookups are only stored after
+// calling the Slack API
+func (s *Store) evictOldestSlackUserLookup() {
+	var oldestKey string
+	var oldest time.Time
+	for k, l := range s.slackUsersLookups {
+		if oldest.IsZero() || l.LookedUpAt.Before(oldest) {
+			oldestKey, oldest = k, l.LookedUpAt
+		}
+	}
+	delete(s.slackUsersLookups, oldestKey)
+}
+
+// GetSlackUserLookup returns the result of the lookup of a commit author if it
+// has not expired yet, given the TTLs of the positive and negative results
+func (s *Store) GetSlackUserLookup(key string, positiveTTL, negativeTTL time.Duration) (slackUserID string, found bool) {
+	s.slackUsersEmailsMutex.RLock()
+	defer s.slackUsersEmailsMutex.RUnlock()
+
+	lookup, found := s.slackUsersLookups[key]
+	if !found {
+		return
+	}
+
+	ttl := negativeTTL
+	if lookup.SlackUserID != "" {
+		ttl = positiveTTL
+	}
+
+	if time.Since(lookup.LookedUpAt) > ttl {
+		return "", false
+	}
+
+	return lookup.SlackUserID, true
+}
+
+// SlackUserGroupMembers holds the IDs of the members of a Slack user group
+type SlackUserGroupMembers struct {
+	UserIDs   []string
+	FetchedAt time.Time
+}
+
+// SetSlackUserGroupMembers ..
+func (s *Store) SetSlackUserGroupMembers(userGroupID string, userIDs []string) {
+	s.slackUserGroupsMembersMutex.Lock()
+	defer s.slackUserGroupsMembersMutex.Unlock()
+
+	if s.slackUserGroupsMembers == nil {
+		s.slackUserGroupsMembers = make(map[string]SlackUserGroupMembers)
+	}
+
+	s.slackUserGroupsMembers[userGroupID] = SlackUserGroupMembers{
+		UserIDs:   userIDs,
+		FetchedAt: time.Now(),
+	}
+}
+
+// GetSlackUserGroupMembers returns the IDs of the members of a user group if
+// they have been fetched less than ttl ago
+func (s *Store) GetSlackUserGroupMembers(userGroupID string, ttl time.Duration) (userIDs []string, found bool) {
+	s.slackUserGroupsMembersMutex.RLock()
+	defer s.slackUserGroupsMembersMutex.RUnlock()
+
+	members, found := s.slackUserGroupsMembers[userGroupID]
+	if !found || time.Since(members.FetchedAt) > ttl {
+		return nil, false
+	}
+
+	return members.UserIDs, true
+}
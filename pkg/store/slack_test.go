@@ -0,0 +1,76 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlackUserLookup(t *testing.T) {
+	s := &Store{}
+
+	_, found := s.GetSlackUserLookup("alice@foo.baz", time.Hour, time.Hour)
+	assert.False(t, found)
+
+	s.SetSlackUserLookup("alice@foo.baz", "U1")
+	s.SetSlackUserLookup("bob@foo.baz", "")
+
+	slackUserID, found := s.GetSlackUserLookup("alice@foo.baz", time.Hour, time.Hour)
+	assert.True(t, found)
+	assert.Equal(t, "U1", slackUserID)
+
+	// Negative results are cached as well
+	slackUserID, found = s.GetSlackUserLookup("bob@foo.baz", time.Hour, time.Hour)
+	assert.True(t, found)
+	assert.Equal(t, "", slackUserID)
+
+	// Expired results
+	_, found = s.GetSlackUserLookup("bob@foo.baz", time.Hour, 0)
+	assert.False(t, found)
+
+	_, found = s.GetSlackUserLookup("alice@foo.baz", 0, time.Hour)
+	assert.False(t, found)
+}
+
+func TestSlackUserGroupMembers(t *testing.T) {
+	s := &Store{}
+
+	_, found := s.GetSlackUserGroupMembers("S1", time.Hour)
+	assert.False(t, found)
+
+	s.SetSlackUserGroupMembers("S1", []string{"U1", "U2"})
+
+	userIDs, found := s.GetSlackUserGroupMembers("S1", time.Hour)
+	assert.True(t, found)
+	assert.Equal(t, []string{"U1", "U2"}, userIDs)
+
+	// Expired members
+	_, found = s.GetSlackUserGroupMembers("S1", 0)
+	assert.False(t, found)
+}
+
+func TestSlackUserLookupsLimit(t *testing.T) {
+	s := &Store{}
+	s.SetSlackUserLookup("alice@foo.baz", "U1")
+	s.SetSlackUserLookup("bob@foo.baz", "U2")
+	s.SetSlackUserLookup("carol@foo.baz", "U3")
+
+	// The oldest lookups get evicted
+	s.SetSlackUserLookupsLimit(2)
+	_, found := s.GetSlackUserLookup("alice@foo.baz", time.Hour, time.Hour)
+	assert.False(t, found)
+
+	// Updating a lookup does not evict any other
+	s.SetSlackUserLookup("bob@foo.baz", "U2")
+	_, found = s.GetSlackUserLookup("carol@foo.baz", time.Hour, time.Hour)
+	assert.True(t, found)
+
+	s.SetSlackUserLookup("dave@foo.baz", "U4")
+	_, found = s.GetSlackUserLookup("carol@foo.baz", time.Hour, time.Hour)
+	assert.False(t, found)
+	_, found = s.GetSlackUserLookup("bob@foo.baz", time.Hour, time.Hour)
+	assert.True(t, found)
+	_, found = s.GetSlackUserLookup("dave@foo.baz", time.Hour, time.Hour)
+	assert.True(t, found)
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mvisonneau/slack-git-compare/pkg/audit"
 	"github.com/mvisonneau/slack-git-compare/pkg/providers"
 )
 
@@ -14,18 +15,54 @@ import (
 type Store struct {
 	repositories           providers.Repositories
 	repositoriesLastUpdate time.Time
+	repositoriesSources    map[providers.RepositoriesSource]providers.RepositoriesSourceStatus
+	restoredRefsFailures   map[providers.RepositoryKey]RefsFailure
 	repositoriesMutex      sync.RWMutex
 
-	slackUsersEmails           map[string]string
-	slackUsersEmailsLastUpdate time.Time
-	slackUsersEmailsMutex      sync.RWMutex
+	slackUsersEmails            map[string]string
+	slackUsersEmailsLastUpdate  time.Time
+	slackUsersLookups           map[string]SlackUserLookup
+	slackUsersLookupsMaxEntries int
+	slackUsersEmailsMutex       sync.RWMutex
+
+	slackUserGroupsMembers      map[string]SlackUserGroupMembers
+	slackUserGroupsMembersMutex sync.RWMutex
+
+	authorsNotifications      map[messageKey]map[string]struct{}
+	authorsNotificationsMutex sync.RWMutex
+
+	usersComparisons map[string]UserComparisons
+	usersFavorites   map[string]UserComparisons
+	usersPreferences map[string]UserPreferences
+	usersMutex       sync.RWMutex
+
+	channelsRepositories map[string][]providers.RepositoryKey
+	channelsFavorites    map[string]UserComparisons
+	channelsMutex        sync.RWMutex
+
+	auditRecords       audit.Records
+	auditRecordsOldest int
+	auditRecordsMutex  sync.RWMutex
+
+	refsUpdateRun      RefsUpdateRun
+	refsUpdateRunMutex sync.RWMutex
+
+	comparisons      comparisonsCache
+	comparisonsMutex sync.RWMutex
+
+	usersUsage  map[string]*usageCounts
+	globalUsage usageCounts
+	usageMutex  sync.RWMutex
 }
 
 // UpdateRepositories ..
 func (s *Store) UpdateRepositories(repos providers.Repositories) {
 	s.repositoriesMutex.Lock()
 	defer s.repositoriesMutex.Unlock()
+	s.updateRepositories(repos)
+}
 
+func (s *Store) updateRepositories(repos providers.Repositories) {
 	// We do not want to lose refs details
 	for k, v := range s.repositories {
 		if _, found := repos[k]; found {
@@ -33,15 +70,36 @@ func (s *Store) UpdateRepositories(repos providers.Repositories) {
 		}
 	}
 
+	// Nor the failures of the refs updates of a previous process
+	s.applyRestoredRefsFailures(repos)
+
 	s.repositories = repos
 	s.repositoriesLastUpdate = time.Now()
 }
 
-// GetRepositories ..
+func (s *Store) applyRestoredRefsFailures(repos providers.Repositories) {
+	for k, f := range s.restoredRefsFailures {
+		if r, found := repos[k]; found {
+			if r.RefsFailures == 0 {
+				r.RefsLastError, r.RefsFailures = f.LastError, f.Failures
+				repos[k] = r
+			}
+			delete(s.restoredRefsFailures, k)
+		}
+	}
+}
+
+// GetRepositories returns a copy of the repositories, as they get updated
+// concurrently by the tasks
 func (s *Store) GetRepositories() providers.Repositories {
 	s.repositoriesMutex.RLock()
 	defer s.repositoriesMutex.RUnlock()
-	return s.repositories
+
+	repos := make(providers.Repositories, len(s.repositories))
+	for k, r := range s.repositories {
+		repos[k] = r
+	}
+	return repos
 }
 
 // GetRepositoriesLastUpdate ..
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// usageCounts holds how many times the repositories and their refs got compared
+type usageCounts struct {
+	repositories map[providers.RepositoryKey]int
+	refs         map[providers.RepositoryKey]map[providers.RefKey]int
+}
+
+// add counts the use of the repository and refs of a comparison
+func (uc *usageCounts) add(c UserComparison) {
+	if uc.repositories == nil {
+		uc.repositories = make(map[providers.RepositoryKey]int)
+		uc.refs = make(map[providers.RepositoryKey]map[providers.RefKey]int)
+	}
+
+	uc.repositories[c.RepositoryKey]++
+
+	if uc.refs[c.RepositoryKey] == nil {
+		uc.refs[c.RepositoryKey] = make(map[providers.RefKey]int)
+	}
+
+	uc.refs[c.RepositoryKey][c.FromRefKey]++
+	if c.ToRefKey != c.FromRefKey {
+		uc.refs[c.RepositoryKey][c.ToRefKey]++
+	}
+}
+
+// RecordUsage counts the use of the repository and refs of a comparison, by the
+// user who requested it and overall
+func (s *Store) RecordUsage(userID string, uc UserComparison) {
+	s.usageMutex.Lock()
+	defer s.usageMutex.Unlock()
+
+	if s.usersUsage == nil {
+		s.usersUsage = make(map[string]*usageCounts)
+	}
+
+	if s.usersUsage[userID] == nil {
+		s.usersUsage[userID] = &usageCounts{}
+	}
+
+	s.usersUsage[userID].add(uc)
+	s.globalUsage.add(uc)
+}
+
+// GetRepositoriesUsage returns how many times the repositories got compared by
+// the user and overall
+func (s *Store) GetRepositoriesUsage(userID string) (usage providers.RepositoriesUsage) {
+	s.usageMutex.RLock()
+	defer s.usageMutex.RUnlock()
+
+	usage.Global = copyCounts(s.globalUsage.repositories)
+	if uc, found := s.usersUsage[userID]; found {
+		usage.User = copyCounts(uc.repositories)
+	}
+	return
+}
+
+// GetRefsUsage returns how many times the refs of a repository got compared by
+// the user and overall
+func (s *Store) GetRefsUsage(userID string, rk providers.RepositoryKey) (usage providers.RefsUsage) {
+	s.usageMutex.RLock()
+	defer s.usageMutex.RUnlock()
+
+	usage.Global = copyRefsCounts(s.globalUsage.refs[rk])
+	if uc, found := s.usersUsage[userID]; found {
+		usage.User = copyRefsCounts(uc.refs[rk])
+	}
+	return
+}
+
+// copyCounts returns a copy of the usage counts of the repositories
+func copyCounts(counts map[providers.RepositoryKey]int) map[providers.RepositoryKey]int {
+	copied := make(map[providers.RepositoryKey]int, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
+}
+
+// copyRefsCounts returns a copy of the usage counts of the refs
+func copyRefsCounts(counts map[providers.RefKey]int) map[providers.RefKey]int {
+	copied := make(map[providers.RefKey]int, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordUsage(t *testing.T) {
+	s := Store{}
+	assert.Empty(t, s.GetRepositoriesUsage("U1").Global)
+
+	uc := UserComparison{RepositoryKey: "repo", FromRefKey: "main", ToRefKey: "prod"}
+	s.RecordUsage("U1", uc)
+	s.RecordUsage("U1", uc)
+	s.RecordUsage("U2", UserComparison{RepositoryKey: "repo", FromRefKey: "main", ToRefKey: "main"})
+
+	ru := s.GetRepositoriesUsage("U1")
+	assert.Equal(t, map[providers.RepositoryKey]int{"repo": 2}, ru.User)
+	assert.Equal(t, map[providers.RepositoryKey]int{"repo": 3}, ru.Global)
+	assert.Nil(t, s.GetRepositoriesUsage("").User)
+
+	rfu := s.GetRefsUsage("U2", "repo")
+	assert.Equal(t, map[providers.RefKey]int{"main": 1}, rfu.User)
+	assert.Equal(t, map[providers.RefKey]int{"main": 3, "prod": 2}, rfu.Global)
+	assert.Empty(t, s.GetRefsUsage("U2", "other").Global)
+
+	// Copies are returned
+	ru.Global["repo"] = 10
+	assert.Equal(t, 3, s.GetRepositoriesUsage("U1").Global["repo"])
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+)
+
+// UserComparisonsHistoryLimit is the maximum amount of comparisons we keep
+// in the history of each user
+const UserComparisonsHistoryLimit = 10
+
+// UserComparison holds the repository and refs of a comparison requested by a user
+type UserComparison struct {
+	RepositoryKey providers.RepositoryKey
+	FromRefKey    providers.RefKey
+	ToRefKey      providers.RefKey
+	ComparedAt    time.Time
+
+	// ChannelID is the conversation the comparison got requested from, it is
+	// not part of the key
+	ChannelID string
+}
+
+// UserComparisons is a slice of UserComparison
+type UserComparisons []UserComparison
+
+// Key returns a unique identifier based upon the repository and refs of the
+// UserComparison
+func (uc UserComparison) Key() string {
+	return strings.Join([]string{string(uc.RepositoryKey), string(uc.FromRefKey), string(uc.ToRefKey)}, "/")
+}
+
+// KeyWithChannel returns the key of the UserComparison followed by the
+// conversation it got requested from, if known
+func (uc UserComparison) KeyWithChannel() string {
+	if uc.ChannelID == "" {
+		return uc.Key()
+	}
+	return uc.Key() + "/" + uc.ChannelID
+}
+
+// ParseUserComparisonKey returns a UserComparison given its key, optionally
+// followed by its conversation (see KeyWithChannel)
+func ParseUserComparisonKey(key string) (uc UserComparison, ok bool) {
+	values := strings.Split(key, "/")
+	if len(values) != 3 && len(values) != 4 {
+		return
+	}
+
+	uc = UserComparison{
+		RepositoryKey: providers.RepositoryKey(values[0]),
+		FromRefKey:    providers.RefKey(values[1]),
+		ToRefKey:      providers.RefKey(values[2]),
+	}
+
+	if len(values) == 4 {
+		uc.ChannelID = values[3]
+	}
+	return uc, true
+}
+
+// remove returns the UserComparisons without the one matching the given key
+func (ucs UserComparisons) remove(key string) (out UserComparisons) {
+	for _, uc := range ucs {
+		if uc.Key() != key {
+			out = append(out, uc)
+		}
+	}
+	return
+}
+
+// AddUserComparison records a comparison onto the history of a user, most
+// recent first
+func (s *Store) AddUserComparison(userID string, uc UserComparison) {
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+
+	if s.usersComparisons == nil {
+		s.usersComparisons = make(map[string]UserComparisons)
+	}
+
+	history := append(UserComparisons{uc}, s.usersComparisons[userID].remove(uc.Key())...)
+	if len(history) > UserComparisonsHistoryLimit {
+		history = history[:UserComparisonsHistoryLimit]
+	}
+
+	s.usersComparisons[userID] = history
+}
+
+// GetUserComparisons ..
+func (s *Store) GetUserComparisons(userID string) UserComparisons {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	return s.usersComparisons[userID]
+}
+
+// PinUserFavorite ..
+func (s *Store) PinUserFavorite(userID string, uc UserComparison) {
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+
+	if s.usersFavorites == nil {
+		s.usersFavorites = make(map[string]UserComparisons)
+	}
+
+	s.usersFavorites[userID] = append(s.usersFavorites[userID].remove(uc.Key()), uc)
+}
+
+// UnpinUserFavorite ..
+func (s *Store) UnpinUserFavorite(userID string, uc UserComparison) {
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+
+	if s.usersFavorites == nil {
+		s.usersFavorites = make(map[string]UserComparisons)
+	}
+
+	s.usersFavorites[userID] = s.usersFavorites[userID].remove(uc.Key())
+}
+
+// GetUserFavorites ..
+func (s *Store) GetUserFavorites(userID string) UserComparisons {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	return s.usersFavorites[userID]
+}
+
+// UserPreferences holds the preferences of a user
+type UserPreferences struct {
+	// DirectPost posts the comparison straight into the channel when the
+	// repository and refs given to the command are resolved unambiguously
+	DirectPost bool
+}
+
+// SetUserPreferences ..
+func (s *Store) SetUserPreferences(userID string, up UserPreferences) {
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+
+	if s.usersPreferences == nil {
+		s.usersPreferences = make(map[string]UserPreferences)
+	}
+
+	s.usersPreferences[userID] = up
+}
+
+// GetUserPreferences ..
+func (s *Store) GetUserPreferences(userID string) UserPreferences {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	return s.usersPreferences[userID]
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mvisonneau/slack-git-compare/pkg/providers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserComparisonKey(t *testing.T) {
+	uc := UserComparison{
+		RepositoryKey: "1",
+		FromRefKey:    "2",
+		ToRefKey:      "3",
+	}
+	assert.Equal(t, "1/2/3", uc.Key())
+
+	parsed, ok := ParseUserComparisonKey(uc.Key())
+	assert.True(t, ok)
+	assert.Equal(t, uc, parsed)
+
+	_, ok = ParseUserComparisonKey("1/2")
+	assert.False(t, ok)
+
+	// With the channel it got requested from
+	assert.Equal(t, "1/2/3", uc.KeyWithChannel())
+	uc.ChannelID = "C1"
+	assert.Equal(t, "1/2/3", uc.Key())
+	assert.Equal(t, "1/2/3/C1", uc.KeyWithChannel())
+
+	parsed, ok = ParseUserComparisonKey(uc.KeyWithChannel())
+	assert.True(t, ok)
+	assert.Equal(t, uc, parsed)
+}
+
+func TestAddUserComparison(t *testing.T) {
+	s := &Store{}
+	for i := 0; i < UserComparisonsHistoryLimit+2; i++ {
+		s.AddUserComparison("U1", UserComparison{RepositoryKey: "repo", FromRefKey: "from", ToRefKey: refKey(i)})
+	}
+
+	history := s.GetUserComparisons("U1")
+	assert.Len(t, history, UserComparisonsHistoryLimit)
+	assert.Equal(t, refKey(UserComparisonsHistoryLimit+1), history[0].ToRefKey)
+
+	// Comparing again moves the entry to the top of the history
+	s.AddUserComparison("U1", history[3])
+	assert.Len(t, s.GetUserComparisons("U1"), UserComparisonsHistoryLimit)
+	assert.Equal(t, history[3].Key(), s.GetUserComparisons("U1")[0].Key())
+	assert.Empty(t, s.GetUserComparisons("U2"))
+}
+
+func TestUserFavorites(t *testing.T) {
+	s := &Store{}
+	uc := UserComparison{RepositoryKey: "repo", FromRefKey: "from", ToRefKey: "to"}
+
+	// Unpinning before anything got pinned
+	s.UnpinUserFavorite("U1", uc)
+	assert.Empty(t, s.GetUserFavorites("U1"))
+
+	s.PinUserFavorite("U1", uc)
+	s.PinUserFavorite("U1", uc)
+	assert.Len(t, s.GetUserFavorites("U1"), 1)
+
+	s.UnpinUserFavorite("U1", uc)
+	assert.Empty(t, s.GetUserFavorites("U1"))
+}
+
+func refKey(i int) providers.RefKey {
+	return providers.RefKey(fmt.Sprintf("%d", i))
+}
+
+func TestUserPreferences(t *testing.T) {
+	s := &Store{}
+	assert.Equal(t, UserPreferences{}, s.GetUserPreferences("U1"))
+
+	s.SetUserPreferences("U1", UserPreferences{DirectPost: true})
+	assert.True(t, s.GetUserPreferences("U1").DirectPost)
+	assert.False(t, s.GetUserPreferences("U2").DirectPost)
+}